@@ -12,15 +12,84 @@ import (
 var newLimit types.ContainerLimits = types.ContainerLimits{
 	MemoryLimit: config.InvalidLimit,
 	PidsLimit:   config.InvalidLimit,
-	CPULimit:    config.InvalidLimit,
+	CPUMillis:   config.InvalidLimit,
+	CPUWeight:   config.InvalidLimit,
+	BlkioWeight: config.InvalidLimit,
 }
+var adjustCPUShares int
+var (
+	adjustCPUs       float64
+	adjustCpusetCpus string
+	adjustCpusetMems string
+)
+var (
+	adjustMemory            string
+	adjustMemorySwap        string
+	adjustMemoryReservation string
+	adjustMemoryHigh        string
+	adjustOOMKillDisable    bool
+	adjustOOMKillGroup      bool
+)
+var (
+	adjustDeviceReadBps   []string
+	adjustDeviceWriteBps  []string
+	adjustDeviceReadIOps  []string
+	adjustDeviceWriteIOps []string
+)
 var adjustCommand = &cobra.Command{
 	Use:   "adjust CONTAINER",
 	Short: "Adjust the resources of a running container",
-	Long:  `Adjust the CPU and memory limits of a running container.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Adjust the CPU, cpuset, memory, swap, OOM killer, block IO and pids limits of a running container.
+Only the specified limits are changed, the others keep their current values.
+Device rate limits only replace the limits of the given devices; use a rate of 0 to remove a limit.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		identifier := args[0]
+		if err := parseMemoryLimits(&newLimit, adjustMemory, adjustMemorySwap, adjustMemoryReservation, adjustMemoryHigh,
+			config.InvalidLimit, config.InvalidLimit); err != nil {
+			logrus.Fatalf("Invalid memory limit: %v", err)
+		}
+		if cmd.Flags().Changed("oom-kill-disable") {
+			newLimit.OOMKillDisable = &adjustOOMKillDisable
+		}
+		if cmd.Flags().Changed("oom-kill-group") {
+			newLimit.OOMKillGroup = &adjustOOMKillGroup
+		}
+		if err := parseIOLimits(&newLimit, adjustDeviceReadBps, adjustDeviceWriteBps, adjustDeviceReadIOps, adjustDeviceWriteIOps); err != nil {
+			logrus.Fatalf("Invalid block IO limit: %v", err)
+		}
+		if cmd.Flags().Changed("cpu-shares") || cmd.Flags().Changed("cpu-weight") {
+			weight := newLimit.CPUWeight
+			if !cmd.Flags().Changed("cpu-weight") {
+				weight = 0
+			}
+			shares := adjustCPUShares
+			if !cmd.Flags().Changed("cpu-shares") {
+				shares = 0
+			}
+			resolved, err := resolveCPUWeight(shares, weight)
+			if err != nil {
+				logrus.Fatalf("Invalid CPU weight: %v", err)
+			}
+			if resolved == 0 {
+				logrus.Fatalf("Invalid CPU weight: must be greater than 0")
+			}
+			newLimit.CPUWeight = resolved
+		}
+		if cmd.Flags().Changed("cpus") {
+			millis, err := parseCPUs(adjustCPUs)
+			if err != nil {
+				logrus.Fatalf("Invalid CPU limit: %v", err)
+			}
+			newLimit.CPUMillis = millis
+		}
+		// 以 --cpuset-cpus "" 清除限制
+		if cmd.Flags().Changed("cpuset-cpus") {
+			newLimit.CpusetCpus = &adjustCpusetCpus
+		}
+		if cmd.Flags().Changed("cpuset-mems") {
+			newLimit.CpusetMems = &adjustCpusetMems
+		}
 		mgr := container.NewManager()
 		if err := mgr.AdjustResourceLimits(identifier, newLimit); err != nil {
 			logrus.Fatalf("Failed to adjust resources for container %s: %v", identifier, err)
@@ -31,8 +100,22 @@ var adjustCommand = &cobra.Command{
 
 func init() {
 	adjustCommand.Flags().IntVar(&newLimit.PidsLimit, "pids-limit", config.InvalidLimit, "Limit the number of container tasks")
-	adjustCommand.Flags().IntVarP(&newLimit.MemoryLimit, "memory", "m", config.InvalidLimit, "Limit the memory")
-	adjustCommand.Flags().IntVar(&newLimit.CPULimit, "cpus", config.InvalidLimit, "Limit the number of CPUs")
+	adjustCommand.Flags().StringVarP(&adjustMemory, "memory", "m", "", "Memory limit (e.g. 512m, 2g, 0 for unlimited)")
+	adjustCommand.Flags().StringVar(&adjustMemorySwap, "memory-swap", "", "Total memory plus swap limit (-1 for unlimited swap)")
+	adjustCommand.Flags().StringVar(&adjustMemoryReservation, "memory-reservation", "", "Memory soft limit protected from reclaim (written to memory.low, 0 to remove)")
+	adjustCommand.Flags().StringVar(&adjustMemoryHigh, "memory-high", "", "Memory usage throttle limit (written to memory.high, 0 to remove)")
+	adjustCommand.Flags().BoolVar(&adjustOOMKillDisable, "oom-kill-disable", false, "Disable OOM Killer for the container (--oom-kill-disable=false to enable it again; requires a memory limit)")
+	adjustCommand.Flags().BoolVar(&adjustOOMKillGroup, "oom-kill-group", false, "Kill all processes of the container together on OOM (--oom-kill-group=false to kill single processes)")
+	adjustCommand.Flags().Float64Var(&adjustCPUs, "cpus", 0, "Number of CPUs (e.g. 0.5, with millicore precision; 0 to remove the limit)")
+	adjustCommand.Flags().IntVar(&adjustCPUShares, "cpu-shares", config.InvalidLimit, "CPU shares (relative weight, 2-262144, converted to cpu.weight)")
+	adjustCommand.Flags().IntVar(&newLimit.CPUWeight, "cpu-weight", config.InvalidLimit, "CPU weight (1-10000, written to cpu.weight)")
+	adjustCommand.Flags().StringVar(&adjustCpusetCpus, "cpuset-cpus", "", `CPUs in which to allow execution (0-3, 0,1; "" to remove the limit)`)
+	adjustCommand.Flags().StringVar(&adjustCpusetMems, "cpuset-mems", "", `MEMs in which to allow execution (0-3, 0,1; "" to remove the limit)`)
+	adjustCommand.Flags().IntVar(&newLimit.BlkioWeight, "blkio-weight", config.InvalidLimit, "Block IO (relative weight), between 10 and 1000, or 0 to reset to the default")
+	adjustCommand.Flags().StringArrayVar(&adjustDeviceReadBps, "device-read-bps", nil, "Limit read rate (bytes per second) from a device (e.g. /dev/sda:10mb, 0 to remove)")
+	adjustCommand.Flags().StringArrayVar(&adjustDeviceWriteBps, "device-write-bps", nil, "Limit write rate (bytes per second) to a device (e.g. /dev/sda:10mb, 0 to remove)")
+	adjustCommand.Flags().StringArrayVar(&adjustDeviceReadIOps, "device-read-iops", nil, "Limit read rate (IO per second) from a device (e.g. /dev/sda:1000, 0 to remove)")
+	adjustCommand.Flags().StringArrayVar(&adjustDeviceWriteIOps, "device-write-iops", nil, "Limit write rate (IO per second) to a device (e.g. /dev/sda:1000, 0 to remove)")
 
 	rootCmd.AddCommand(adjustCommand)
 }
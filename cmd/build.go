@@ -0,0 +1,111 @@
+// cmd/build.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/auth"
+	"gocker/internal/build"
+	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildTags       []string
+	buildGockerfile string
+	buildNoCache    bool
+)
+
+var buildCommand = &cobra.Command{
+	Use:   "build [OPTIONS] PATH",
+	Short: "Build an image from a Gockerfile",
+	Long: `Build an image from a Gockerfile and a build context directory.
+Supported instructions: FROM, RUN, COPY, ADD, ENV, WORKDIR, USER, ENTRYPOINT, CMD, EXPOSE and LABEL.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// 建置環境由 daemon 讀取，因此需要轉換為絕對路徑
+		contextDir, err := filepath.Abs(args[0])
+		if err != nil {
+			logrus.Fatalf("解析建置環境路徑 %s 失敗: %v", args[0], err)
+		}
+		gockerfile := buildGockerfile
+		if gockerfile == "" {
+			gockerfile = filepath.Join(contextDir, config.DefaultInitInstructionFile)
+		}
+		if gockerfile, err = filepath.Abs(gockerfile); err != nil {
+			logrus.Fatalf("解析 Gockerfile 路徑失敗: %v", err)
+		}
+		for _, tag := range buildTags {
+			if _, err := image.NormalizeReference(tag); err != nil {
+				logrus.Fatalf("無效的 tag %s: %v", tag, err)
+			}
+		}
+
+		// 先在本機解析一次，提早回報語法錯誤並取得 FROM 映像所需的憑證
+		instructions, err := build.ParseFile(gockerfile)
+		if err != nil {
+			logrus.Fatalf("解析 Gockerfile 失敗: %v", err)
+		}
+		registryAuth, err := buildAuth(instructions)
+		if err != nil {
+			logrus.Fatalf("解析倉庫憑證失敗: %v", err)
+		}
+
+		res := sendDaemonStreamRequest("build", types.BuildRequest{
+			ContextDir: contextDir,
+			Gockerfile: gockerfile,
+			Tags:       buildTags,
+			Auth:       registryAuth,
+			NoCache:    buildNoCache,
+		}, func(data json.RawMessage) {
+			var ev types.BuildEvent
+			if err := json.Unmarshal(data, &ev); err == nil {
+				fmt.Print(ev.Stream)
+			}
+		})
+
+		var result types.BuildResult
+		if err := json.Unmarshal(res.Data, &result); err != nil {
+			logrus.Fatalf("解析建置結果失敗: %v", err)
+		}
+		logrus.Infof("成功建置映像: %s", pkg.TruncateID(result.ImageID))
+	},
+}
+
+// buildAuth 解析 FROM 映像所屬倉庫的憑證，以倉庫位址為 key
+func buildAuth(instructions []*build.Instruction) (map[string]*types.RegistryAuth, error) {
+	result := map[string]*types.RegistryAuth{}
+	for _, inst := range instructions {
+		fields := strings.Fields(inst.Raw)
+		if inst.Command != "FROM" || len(fields) == 0 || fields[0] == "scratch" || strings.Contains(fields[0], "$") {
+			continue
+		}
+		ref, err := image.ParseReference(fields[0])
+		if err != nil {
+			continue
+		}
+		registryAuth, err := auth.ForReference(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if registryAuth != nil {
+			result[ref.Context().RegistryStr()] = registryAuth
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	buildCommand.Flags().StringArrayVarP(&buildTags, "tag", "t", nil, "Name and optionally a tag in the 'name:tag' format")
+	buildCommand.Flags().StringVarP(&buildGockerfile, "file", "f", "", fmt.Sprintf("Name of the Gockerfile (default \"PATH/%s\")", config.DefaultInitInstructionFile))
+	buildCommand.Flags().BoolVar(&buildNoCache, "no-cache", false, "Do not use cache when building the image")
+	rootCmd.AddCommand(buildCommand)
+}
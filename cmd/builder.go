@@ -0,0 +1,47 @@
+// cmd/builder.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var builderCommand = &cobra.Command{
+	Use:   "builder",
+	Short: "Manage builds",
+}
+
+var builderPruneCommand = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove build cache",
+	Long:  "Remove unused intermediate images created by 'gocker build' and --init-file, and invalidate the remaining build cache.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("builder_prune", nil)
+
+		var report types.ImageDeleteReport
+		if err := json.Unmarshal(res.Data, &report); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的結果失敗: %v", err)
+		}
+
+		if len(report.Deleted) > 0 {
+			fmt.Println("Deleted build cache objects:")
+			for _, id := range report.Deleted {
+				fmt.Println(pkg.TruncateID(id))
+			}
+			fmt.Println()
+		}
+		fmt.Printf("Total reclaimed space: %s\n", pkg.HumanSize(report.SpaceReclaimed))
+	},
+}
+
+func init() {
+	builderCommand.AddCommand(builderPruneCommand)
+	rootCmd.AddCommand(builderCommand)
+}
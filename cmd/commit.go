@@ -0,0 +1,56 @@
+// cmd/commit.go
+package cmd
+
+import (
+	"fmt"
+
+	"gocker/internal/image"
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitChanges []string
+	commitMessage string
+	commitAuthor  string
+	commitPause   bool
+)
+
+var commitCommand = &cobra.Command{
+	Use:   "commit [OPTIONS] CONTAINER [REPOSITORY[:TAG]]",
+	Short: "Create a new image from a container's changes",
+	Long: `Create a new image from a container's changes.
+The container's filesystem changes become a new layer on top of its image.
+Use -c to apply Gockerfile instructions (CMD, ENTRYPOINT, ENV, EXPOSE, LABEL, USER, WORKDIR) to the new image.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		req := types.CommitRequest{
+			Container: args[0],
+			Changes:   commitChanges,
+			Message:   commitMessage,
+			Author:    commitAuthor,
+			Pause:     commitPause,
+		}
+		if len(args) == 2 {
+			if _, err := image.NormalizeReference(args[1]); err != nil {
+				logrus.Fatalf("無效的映像名稱 %s: %v", args[1], err)
+			}
+			req.Reference = args[1]
+		}
+
+		res := sendDaemonRequest("commit", req)
+		fmt.Println("sha256:" + res.Message)
+		logrus.Infof("已將容器 %s 提交為映像 %s", args[0], pkg.TruncateID(res.Message))
+	},
+}
+
+func init() {
+	commitCommand.Flags().StringArrayVarP(&commitChanges, "change", "c", nil, "Apply Gockerfile instruction to the created image")
+	commitCommand.Flags().StringVarP(&commitMessage, "message", "m", "", "Commit message")
+	commitCommand.Flags().StringVarP(&commitAuthor, "author", "a", "", "Author (e.g., \"John Hannibal Smith <hannibal@a-team.com>\")")
+	commitCommand.Flags().BoolVarP(&commitPause, "pause", "p", true, "Pause container during commit")
+	rootCmd.AddCommand(commitCommand)
+}
@@ -0,0 +1,165 @@
+// cmd/cp.go
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var cpCommand = &cobra.Command{
+	Use:   "cp CONTAINER:SRC_PATH DEST_PATH|-\n  gocker cp SRC_PATH|- CONTAINER:DEST_PATH",
+	Short: "Copy files/folders between a container and the local filesystem",
+	Long: `Copy files/folders between a container and the local filesystem.
+Container paths are relative to the container's root directory. Ownership and permissions are preserved.
+A SRC_PATH ending with "/." copies the contents of the directory instead of the directory itself.
+Use "-" as DEST_PATH to write a tar archive to STDOUT, or as SRC_PATH to read a tar archive from STDIN.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		srcContainer, srcPath := splitCopyArg(args[0])
+		dstContainer, dstPath := splitCopyArg(args[1])
+		switch {
+		case srcContainer != "" && dstContainer != "":
+			logrus.Fatal("不支援在兩個容器之間複製")
+		case srcContainer != "":
+			copyFromContainer(srcContainer, srcPath, dstPath)
+		case dstContainer != "":
+			copyToContainer(srcPath, dstContainer, dstPath)
+		default:
+			logrus.Fatal("必須以 CONTAINER:PATH 的格式指定其中一方為容器")
+		}
+	},
+}
+
+// splitCopyArg 將 CONTAINER:PATH 拆成容器與路徑，本機路徑回傳空的容器名稱
+// 以 "/" 或 "." 開頭的參數一律視為本機路徑，因此含有 ":" 的本機檔案可以寫成 ./a:b
+func splitCopyArg(arg string) (string, string) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	container, p, ok := strings.Cut(arg, ":")
+	if !ok {
+		return "", arg
+	}
+	return container, p
+}
+
+// copiesContents 判斷來源是否只複製目錄的內容 (以 "/." 結尾或是根目錄)
+func copiesContents(p string) bool {
+	return strings.HasSuffix(p, "/.") || path.Clean("/"+p) == "/"
+}
+
+// copyFromContainer 從容器複製到本機，daemon 串流回傳的 tar 直接解開到目的地
+func copyFromContainer(container, srcPath, dst string) {
+	req := types.CopyFromRequest{Container: container, Path: srcPath, Name: path.Base(path.Clean("/" + srcPath))}
+	if copiesContents(srcPath) {
+		req.Name = "."
+	}
+
+	if dst == "-" {
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			logrus.Fatal("拒絕將 tar 資料輸出到終端機，請重新導向輸出")
+		}
+		// tar 資料寫到 stdout，日誌改寫到 stderr 以免混入
+		logrus.SetOutput(os.Stderr)
+		receiveArchive(req, os.Stdout)
+		return
+	}
+
+	// 目的地為已存在的目錄時放到其中；否則以目的地的名稱放到它的父目錄
+	extractDir := dst
+	fi, err := os.Stat(dst)
+	switch {
+	case err == nil && fi.IsDir():
+	case err == nil:
+		if req.Name == "." {
+			logrus.Fatalf("%s 不是目錄", dst)
+		}
+		extractDir, req.Name, req.FileOnly = filepath.Dir(dst), filepath.Base(dst), true
+	case os.IsNotExist(err):
+		if pfi, err := os.Stat(filepath.Dir(dst)); err != nil || !pfi.IsDir() {
+			logrus.Fatalf("目的地 %s 的父目錄不存在", dst)
+		}
+		if req.Name != "." {
+			extractDir, req.Name = filepath.Dir(dst), filepath.Base(dst)
+		}
+	default:
+		logrus.Fatalf("讀取 %s 失敗: %v", dst, err)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := image.ExtractLayer(pr, extractDir, image.WhiteoutIgnore)
+		if err == nil {
+			// 讀完 tar 結尾的填充資料，避免寫入端被阻塞
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	receiveArchive(req, pw)
+	pw.Close()
+	if err := <-done; err != nil {
+		logrus.Fatalf("複製到 %s 失敗: %v", dst, err)
+	}
+}
+
+// receiveArchive 送出 cp_from 請求，並將回傳的 tar 資料寫入 out
+func receiveArchive(req types.CopyFromRequest, out io.Writer) {
+	var writeErr error
+	sendDaemonStreamRequest("cp_from", req, func(data json.RawMessage) {
+		if writeErr != nil {
+			return
+		}
+		var chunk types.ArchiveChunk
+		if writeErr = json.Unmarshal(data, &chunk); writeErr == nil {
+			_, writeErr = out.Write(chunk.Data)
+		}
+	})
+	if writeErr != nil {
+		logrus.Fatalf("寫入複製的資料失敗: %v", writeErr)
+	}
+}
+
+// copyToContainer 將本機的檔案或目錄寫成 tar 串流傳給 daemon，由 daemon 解開到容器中
+func copyToContainer(src, container, dstPath string) {
+	req := types.CopyToRequest{Container: container, Path: dstPath}
+	if src == "-" {
+		sendDaemonUploadRequest("cp_to", req, os.Stdin)
+		return
+	}
+
+	fi, err := os.Lstat(src)
+	if err != nil {
+		logrus.Fatalf("讀取 %s 失敗: %v", src, err)
+	}
+	req.IsDir = fi.IsDir()
+	req.Name = filepath.Base(src)
+	if copiesContents(src) {
+		if !fi.IsDir() {
+			logrus.Fatalf("%s 不是目錄", src)
+		}
+		req.Name = "."
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(image.WriteArchive(pw, src, req.Name))
+	}()
+	sendDaemonUploadRequest("cp_to", req, pr)
+}
+
+func init() {
+	rootCmd.AddCommand(cpCommand)
+}
@@ -0,0 +1,35 @@
+// cmd/diff.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var diffCommand = &cobra.Command{
+	Use:   "diff CONTAINER",
+	Short: "Inspect changes to files or directories on a container's filesystem",
+	Long: `List the files and directories changed in a container's filesystem since it was created from its image.
+A = added, C = changed, D = deleted.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("diff", types.DiffRequest{Container: args[0]})
+
+		var changes []types.ContainerChange
+		if err := json.Unmarshal(res.Data, &changes); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的數據失敗: %v", err)
+		}
+		for _, change := range changes {
+			fmt.Printf("%s %s\n", change.Kind, change.Path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCommand)
+}
@@ -0,0 +1,59 @@
+// cmd/export.go
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var exportOutput string
+
+var exportCommand = &cobra.Command{
+	Use:   "export [OPTIONS] CONTAINER",
+	Short: "Export a container's filesystem as a tar archive",
+	Long:  "Export a container's merged filesystem as a tar archive. The archive is written to STDOUT by default.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var out io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				logrus.Fatalf("建立輸出檔 %s 失敗: %v", exportOutput, err)
+			}
+			defer f.Close()
+			out = f
+		} else {
+			if term.IsTerminal(int(os.Stdout.Fd())) {
+				logrus.Fatal("拒絕將 tar 資料輸出到終端機，請使用 -o 或重新導向輸出")
+			}
+			// tar 資料寫到 stdout，日誌改寫到 stderr 以免混入
+			logrus.SetOutput(os.Stderr)
+		}
+
+		var writeErr error
+		sendDaemonStreamRequest("export", types.ExportRequest{Container: args[0]}, func(data json.RawMessage) {
+			if writeErr != nil {
+				return
+			}
+			var chunk types.ArchiveChunk
+			if writeErr = json.Unmarshal(data, &chunk); writeErr == nil {
+				_, writeErr = out.Write(chunk.Data)
+			}
+		})
+		if writeErr != nil {
+			logrus.Fatalf("寫入匯出資料失敗: %v", writeErr)
+		}
+	},
+}
+
+func init() {
+	exportCommand.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to a file, instead of STDOUT")
+	rootCmd.AddCommand(exportCommand)
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 
+	"gocker/internal/config"
 	"gocker/internal/container"
 	"gocker/internal/daemon"
 	"gocker/internal/image"
+	"gocker/internal/storage"
+	"gocker/internal/volume"
 )
 
 func main() {
@@ -21,10 +25,25 @@ func main() {
 
 	log.Println("--- Daemon in server mode ---")
 
+	configPath := flag.String("config", config.DaemonConfigPath, "daemon 設定檔的路徑")
+	flag.Parse()
+
+	daemonConfig, err := config.LoadDaemonConfig(*configPath)
+	if err != nil {
+		log.Fatalf("讀取 daemon 設定檔失敗: %v", err)
+	}
+	if err := storage.SetDefault(daemonConfig.StorageDriver); err != nil {
+		log.Fatalf("套用 storage driver 設定失敗: %v", err)
+	}
+
 	containerManager := container.NewManager()
 	imageManager := image.NewManager()
+	if err := imageManager.ConfigureRegistries(daemonConfig); err != nil {
+		log.Fatalf("套用倉庫設定失敗: %v", err)
+	}
+	volumeManager := volume.NewManager()
 
-	server := daemon.NewServer(containerManager, imageManager)
+	server := daemon.NewServer(containerManager, imageManager, volumeManager)
 
 	if err := server.Run(); err != nil {
 		log.Fatalf("Daemon 啟動失敗: %v", err)
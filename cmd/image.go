@@ -0,0 +1,49 @@
+// cmd/image.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var imagePruneAll bool
+
+var imageCommand = &cobra.Command{
+	Use:   "image",
+	Short: "Manage images",
+}
+
+var imagePruneCommand = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove unused images",
+	Long:  "Remove dangling images. With --all, remove all images not used by any container.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("image_prune", types.ImageRequest{All: imagePruneAll})
+
+		var report types.ImageDeleteReport
+		if err := json.Unmarshal(res.Data, &report); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的結果失敗: %v", err)
+		}
+
+		if len(report.Untagged) > 0 || len(report.Deleted) > 0 {
+			fmt.Println("Deleted Images:")
+			printImageDeleteReport(&report)
+			fmt.Println()
+		}
+		fmt.Printf("Total reclaimed space: %s\n", pkg.HumanSize(report.SpaceReclaimed))
+	},
+}
+
+func init() {
+	imagePruneCommand.Flags().BoolVarP(&imagePruneAll, "all", "a", false, "Remove all unused images, not just dangling ones")
+
+	imageCommand.AddCommand(imagePruneCommand)
+	rootCmd.AddCommand(imageCommand)
+}
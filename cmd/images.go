@@ -7,45 +7,66 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"time"
 
-	"gocker/internal/api"
 	"gocker/internal/types"
+	"gocker/pkg"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var (
+	imagesDigests bool
+	imagesNoTrunc bool
+)
+
 var imagesCmd = &cobra.Command{
 	Use:   "images",
 	Short: "List all locally stored images",
 	Long:  `Lists all images that have been pulled and are stored locally in the gocker storage path.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		req := types.Request{Command: "images"}
-
-		res, err := api.SendRequest(req)
-		if err != nil {
-			logrus.Fatalf("與 gocker-daemon 通訊失敗: %v", err)
-		}
+		res := sendDaemonRequest("images", nil)
 
-		if res.Status != "success" {
-			logrus.Fatalf("來自 Daemon 的錯誤: %s", res.Message)
-		}
-
-		var imageList []string
+		var imageList []types.ImageManifest
 		if err := json.Unmarshal(res.Data, &imageList); err != nil {
 			logrus.Fatalf("解析來自 Daemon 的映像檔列表失敗: %v", err)
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-		fmt.Fprint(w, "REPOSITORY\tTAG\n")
-		for _, imgName := range imageList {
-			parts := strings.Split(imgName, ":")
-			repo := parts[0]
-			tag := "latest"
-			if len(parts) > 1 {
-				tag = parts[1]
+		if imagesDigests {
+			fmt.Fprint(w, "REPOSITORY\tTAG\tDIGEST\tIMAGE ID\tARCH\tCREATED\tSIZE\n")
+		} else {
+			fmt.Fprint(w, "REPOSITORY\tTAG\tIMAGE ID\tARCH\tCREATED\tSIZE\n")
+		}
+		for _, img := range imageList {
+			repo, tag := splitRepoTag(img.RepoTag)
+
+			imageID := "sha256:" + img.ImageID
+			if !imagesNoTrunc {
+				imageID = pkg.TruncateID(img.ImageID)
+			}
+
+			arch := "N/A"
+			if img.Platform != "" {
+				// 只顯示 arch[/variant]，OS 一律為 linux
+				_, arch, _ = strings.Cut(img.Platform, "/")
+			}
+
+			created := "N/A"
+			if !img.Created.IsZero() {
+				created = pkg.HumanDuration(time.Since(img.Created)) + " ago"
+			}
+
+			if imagesDigests {
+				digest := img.Digest
+				if digest == "" {
+					digest = "<none>"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", repo, tag, digest, imageID, arch, created, pkg.HumanSize(img.Size))
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", repo, tag, imageID, arch, created, pkg.HumanSize(img.Size))
 			}
-			fmt.Fprintf(w, "%s\t%s\n", repo, tag)
 		}
 
 		if err := w.Flush(); err != nil {
@@ -54,6 +75,22 @@ var imagesCmd = &cobra.Command{
 	},
 }
 
+// splitRepoTag 將 manifest 中的 repoTag 拆成 REPOSITORY 與 TAG 欄位，digest 參照與沒有 tag 的映像顯示為 <none>
+func splitRepoTag(repoTag string) (string, string) {
+	if repoTag == "" {
+		return "<none>", "<none>"
+	}
+	if i := strings.Index(repoTag, "@"); i >= 0 {
+		return repoTag[:i], "<none>"
+	}
+	if i := strings.LastIndex(repoTag, ":"); i > strings.LastIndex(repoTag, "/") {
+		return repoTag[:i], repoTag[i+1:]
+	}
+	return repoTag, "latest"
+}
+
 func init() {
+	imagesCmd.Flags().BoolVar(&imagesDigests, "digests", false, "Show digests")
+	imagesCmd.Flags().BoolVar(&imagesNoTrunc, "no-trunc", false, "Don't truncate output")
 	rootCmd.AddCommand(imagesCmd)
 }
@@ -0,0 +1,53 @@
+// cmd/import.go
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importChanges []string
+	importMessage string
+)
+
+var importCommand = &cobra.Command{
+	Use:   "import [OPTIONS] FILE|DIRECTORY [REPOSITORY[:TAG]]",
+	Short: "Import the contents from a tarball or directory to create a filesystem image",
+	Long: `Create a single-layer image from a root filesystem tarball (optionally gzip or zstd compressed) or a directory.
+Use -c to apply Gockerfile instructions (CMD, ENTRYPOINT, ENV, EXPOSE, LABEL, USER, WORKDIR) to the new image.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// 檔案由 daemon 讀取，因此需要轉換為絕對路徑
+		source, err := filepath.Abs(args[0])
+		if err != nil {
+			logrus.Fatalf("解析路徑 %s 失敗: %v", args[0], err)
+		}
+		req := types.ImportRequest{
+			Source:  source,
+			Changes: importChanges,
+			Message: importMessage,
+		}
+		if len(args) == 2 {
+			if _, err := image.NormalizeReference(args[1]); err != nil {
+				logrus.Fatalf("無效的映像名稱 %s: %v", args[1], err)
+			}
+			req.Reference = args[1]
+		}
+
+		res := sendDaemonRequest("import", req)
+		fmt.Println("sha256:" + res.Message)
+	},
+}
+
+func init() {
+	importCommand.Flags().StringArrayVarP(&importChanges, "change", "c", nil, "Apply Gockerfile instruction to the created image")
+	importCommand.Flags().StringVarP(&importMessage, "message", "m", "", "Set commit message for imported image")
+	rootCmd.AddCommand(importCommand)
+}
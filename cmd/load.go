@@ -0,0 +1,50 @@
+// cmd/load.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var loadInput string
+
+var loadCommand = &cobra.Command{
+	Use:   "load -i FILE",
+	Short: "Load images from a tar archive",
+	Long:  "Load images from a tar archive created by 'gocker save' or 'docker save', or containing an OCI image layout.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 檔案由 daemon 讀取，因此需要轉換為絕對路徑
+		input, err := filepath.Abs(loadInput)
+		if err != nil {
+			logrus.Fatalf("解析輸入路徑 %s 失敗: %v", loadInput, err)
+		}
+
+		res := sendDaemonRequest("load", types.ImageLoadRequest{Input: input})
+
+		var loaded []string
+		if err := json.Unmarshal(res.Data, &loaded); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的結果失敗: %v", err)
+		}
+		for _, ref := range loaded {
+			if strings.HasPrefix(ref, "sha256:") {
+				fmt.Printf("Loaded image ID: %s\n", ref)
+			} else {
+				fmt.Printf("Loaded image: %s\n", ref)
+			}
+		}
+	},
+}
+
+func init() {
+	loadCommand.Flags().StringVarP(&loadInput, "input", "i", "", "Read from tar archive file")
+	loadCommand.MarkFlagRequired("input")
+	rootCmd.AddCommand(loadCommand)
+}
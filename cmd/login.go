@@ -0,0 +1,98 @@
+// cmd/login.go
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"gocker/internal/auth"
+	"gocker/internal/config"
+	"gocker/internal/image"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	loginUsername      string
+	loginPassword      string
+	loginPasswordStdin bool
+)
+
+var loginCommand = &cobra.Command{
+	Use:   "login [SERVER]",
+	Short: "Log in to a registry",
+	Long: `Log in to a registry. If no server is specified, Docker Hub is used.
+Credentials are stored in $GOCKER_CONFIG/config.json (default ~/.gocker/config.json),
+or in the credential helper configured by "credsStore" / "credHelpers" in that file.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server := ""
+		if len(args) == 1 {
+			server = args[0]
+		}
+
+		if loginPasswordStdin {
+			if loginPassword != "" {
+				logrus.Fatal("--password 與 --password-stdin 不可同時使用")
+			}
+			if loginUsername == "" {
+				logrus.Fatal("使用 --password-stdin 時必須指定 --username")
+			}
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				logrus.Fatalf("從標準輸入讀取密碼失敗: %v", err)
+			}
+			loginPassword = strings.TrimRight(string(data), "\r\n")
+		}
+
+		reader := bufio.NewReader(os.Stdin)
+		if loginUsername == "" {
+			fmt.Print("Username: ")
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				logrus.Fatalf("讀取使用者名稱失敗: %v", err)
+			}
+			loginUsername = strings.TrimSpace(line)
+		}
+		if loginPassword == "" {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				logrus.Fatal("無法在非終端機環境中輸入密碼，請使用 --password-stdin")
+			}
+			fmt.Print("Password: ")
+			password, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				logrus.Fatalf("讀取密碼失敗: %v", err)
+			}
+			loginPassword = string(password)
+		}
+		if loginUsername == "" || loginPassword == "" {
+			logrus.Fatal("使用者名稱與密碼不可為空")
+		}
+
+		daemonConfig, err := config.LoadDaemonConfig(config.DaemonConfigPath)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		transportFor := func(host string) (http.RoundTripper, bool, error) {
+			return image.RegistryTransport(daemonConfig, host)
+		}
+		if _, err := auth.Login(server, loginUsername, loginPassword, transportFor); err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		fmt.Println("Login Succeeded")
+	},
+}
+
+func init() {
+	loginCommand.Flags().StringVarP(&loginUsername, "username", "u", "", "Username")
+	loginCommand.Flags().StringVarP(&loginPassword, "password", "p", "", "Password")
+	loginCommand.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "Take the password from stdin")
+	rootCmd.AddCommand(loginCommand)
+}
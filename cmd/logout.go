@@ -0,0 +1,38 @@
+// cmd/logout.go
+package cmd
+
+import (
+	"fmt"
+
+	"gocker/internal/auth"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var logoutCommand = &cobra.Command{
+	Use:   "logout [SERVER]",
+	Short: "Log out from a registry",
+	Long:  "Log out from a registry. If no server is specified, Docker Hub is used.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server := ""
+		if len(args) == 1 {
+			server = args[0]
+		}
+
+		key, loggedIn, err := auth.Logout(server)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		if !loggedIn {
+			fmt.Printf("Not logged in to %s\n", key)
+			return
+		}
+		fmt.Printf("Removing login credentials for %s\n", key)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCommand)
+}
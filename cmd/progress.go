@@ -0,0 +1,118 @@
+// cmd/progress.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"golang.org/x/term"
+)
+
+// progressBarWidth 為進度條的寬度 (字元數)
+const progressBarWidth = 40
+
+// progressRenderer 將 daemon 串流的 pull 進度輸出到終端機
+// 在終端機上每個 layer 佔一行並原地更新進度條，否則只在 layer 的狀態改變時輸出一行
+type progressRenderer struct {
+	out   io.Writer
+	tty   bool
+	lines int            // 已輸出的行數
+	index map[string]int // layer ID 所在的行
+	last  map[string]string
+}
+
+func newProgressRenderer(out *os.File) *progressRenderer {
+	return &progressRenderer{
+		out:   out,
+		tty:   term.IsTerminal(int(out.Fd())),
+		index: map[string]int{},
+		last:  map[string]string{},
+	}
+}
+
+// handle 解析一個進度回應並更新輸出
+func (r *progressRenderer) handle(data json.RawMessage) {
+	var ev types.ProgressEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+	r.update(ev)
+}
+
+func (r *progressRenderer) update(ev types.ProgressEvent) {
+	line := r.format(ev)
+	if ev.ID == "" {
+		fmt.Fprintln(r.out, line)
+		r.lines++
+		return
+	}
+
+	if !r.tty {
+		if r.last[ev.ID] == ev.Status {
+			return
+		}
+		r.last[ev.ID] = ev.Status
+		fmt.Fprintln(r.out, line)
+		return
+	}
+
+	i, ok := r.index[ev.ID]
+	if !ok {
+		r.index[ev.ID] = r.lines
+		fmt.Fprintln(r.out, line)
+		r.lines++
+		return
+	}
+	// 移到該 layer 所在的行，清除後重寫，再回到最後一行
+	up := r.lines - i
+	fmt.Fprintf(r.out, "\033[%dA\r\033[2K%s\033[%dB\r", up, line, up)
+}
+
+// format 將事件轉換為顯示的文字
+func (r *progressRenderer) format(ev types.ProgressEvent) string {
+	switch ev.Status {
+	case types.ProgressResolving:
+		return "Resolving " + ev.Message
+	case types.ProgressDone:
+		return "Digest: " + ev.Message
+	case types.ProgressWaiting:
+		return ev.ID + ": Waiting"
+	case types.ProgressLayerExists:
+		return ev.ID + ": Already exists"
+	case types.ProgressLayerComplete:
+		return ev.ID + ": Pull complete"
+	case types.ProgressDownloading, types.ProgressExtracting:
+		label := "Downloading"
+		if ev.Status == types.ProgressExtracting {
+			label = "Extracting"
+		}
+		if !r.tty {
+			return fmt.Sprintf("%s: %s %s", ev.ID, label, pkg.HumanSize(ev.Total))
+		}
+		return fmt.Sprintf("%s: %-11s %s %s/%s", ev.ID, label, progressBar(ev.Current, ev.Total),
+			pkg.HumanSize(ev.Current), pkg.HumanSize(ev.Total))
+	default:
+		return strings.TrimSpace(ev.ID + " " + ev.Status + " " + ev.Message)
+	}
+}
+
+// progressBar 回傳 [=====>    ] 形式的進度條
+func progressBar(current, total int64) string {
+	filled := 0
+	if total > 0 {
+		filled = int(current * progressBarWidth / total)
+	}
+	filled = min(max(filled, 0), progressBarWidth)
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return "[" + bar + "]"
+}
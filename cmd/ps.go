@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"gocker/internal/api"
 	"gocker/internal/types"
+	"gocker/pkg"
 	"os"
 	"text/tabwriter"
 
@@ -13,11 +14,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var psSize bool
+
 var psCommand = &cobra.Command{
 	Use:   "ps",
 	Short: "List all containers",
 	Run: func(cmd *cobra.Command, args []string) {
-		req := types.Request{Command: "ps"}
+		req := newDaemonRequest("ps", types.PsRequest{Size: psSize})
 
 		res, err := api.SendRequest(req)
 		if err != nil {
@@ -32,17 +35,25 @@ var psCommand = &cobra.Command{
 			logrus.Fatalf("解析來自 Daemon 的數據失敗: %v", err)
 		}
 		w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-		fmt.Fprint(w, "ID\tNAME\tIMAGE\tCOMMAND\tSTATUS\n")
+		if psSize {
+			fmt.Fprint(w, "ID\tNAME\tIMAGE\tCOMMAND\tSTATUS\tSIZE\n")
+		} else {
+			fmt.Fprint(w, "ID\tNAME\tIMAGE\tCOMMAND\tSTATUS\n")
+		}
 		for _, c := range containers {
 			if len(c.ID) < 12 {
 				continue
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s",
 				c.ID[:12],
 				c.Name,
 				c.Image,
 				c.Command,
 				c.Status)
+			if psSize {
+				fmt.Fprintf(w, "\t%s (virtual %s)", pkg.HumanSize(c.SizeRw), pkg.HumanSize(c.SizeRootFs))
+			}
+			fmt.Fprintln(w)
 		}
 		if err := w.Flush(); err != nil {
 			logrus.Errorf("Failed to flush output: %v", err)
@@ -51,5 +62,6 @@ var psCommand = &cobra.Command{
 }
 
 func init() {
+	psCommand.Flags().BoolVarP(&psSize, "size", "s", false, "Display total file sizes")
 	rootCmd.AddCommand(psCommand)
 }
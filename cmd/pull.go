@@ -2,43 +2,45 @@
 package cmd
 
 import (
-	"encoding/json"
-	"gocker/internal/api"
+	"os"
+
+	"gocker/internal/auth"
+	"gocker/internal/image"
 	"gocker/internal/types"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var pullPlatform string
+
 var pullCommand = &cobra.Command{
 	Use:   "pull [IMAGE_NAME]",
 	Short: "Pull an image from a remote repository",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		imageName := args[0]
-		pullReq := types.PullRequest{
-			Image: imageName,
-		}
-		payload, err := json.Marshal(pullReq)
-		if err != nil {
-			logrus.Fatalf("序列化 pull 請求失敗: %v", err)
+		if _, err := image.ParsePlatform(pullPlatform); err != nil {
+			logrus.Fatalf("%v", err)
 		}
-		req := types.Request{
-			Command: "pull",
-			Payload: payload,
-		}
-		res, err := api.SendRequest(req)
+
+		// 憑證由 CLI 以執行者的身分解析後隨請求送出，daemon 不會讀取 root 的設定
+		registryAuth, err := auth.ForReference(imageName)
 		if err != nil {
-			logrus.Fatalf("與 gocker-daemon 通訊失敗: %v", err)
-		}
-		if res.Status != "success" {
-			logrus.Fatalf("來自 Daemon 的錯誤: %s", res.Message)
+			logrus.Fatalf("解析倉庫憑證失敗: %v", err)
 		}
 
+		renderer := newProgressRenderer(os.Stdout)
+		sendDaemonStreamRequest("pull", types.PullRequest{
+			Image:    imageName,
+			Platform: pullPlatform,
+			Auth:     registryAuth,
+		}, renderer.handle)
 		logrus.Infof("成功拉取映像: %s", imageName)
 	},
 }
 
 func init() {
+	pullCommand.Flags().StringVar(&pullPlatform, "platform", "", "Pull the image for this platform (os/arch[/variant]), default is the host platform")
 	rootCmd.AddCommand(pullCommand)
 }
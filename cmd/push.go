@@ -0,0 +1,38 @@
+// cmd/push.go
+package cmd
+
+import (
+	"fmt"
+
+	"gocker/internal/auth"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var pushInsecure bool
+
+var pushCommand = &cobra.Command{
+	Use:   "push NAME[:TAG]",
+	Short: "Push an image to a registry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		registryAuth, err := auth.ForReference(args[0])
+		if err != nil {
+			logrus.Fatalf("解析倉庫憑證失敗: %v", err)
+		}
+
+		res := sendDaemonRequest("push", types.PushRequest{
+			Image:    args[0],
+			Insecure: pushInsecure,
+			Auth:     registryAuth,
+		})
+		fmt.Printf("%s: digest: %s\n", args[0], res.Message)
+	},
+}
+
+func init() {
+	pushCommand.Flags().BoolVar(&pushInsecure, "insecure", false, "Allow pushing to a registry over plain HTTP")
+	rootCmd.AddCommand(pushCommand)
+}
@@ -0,0 +1,46 @@
+// cmd/rmi.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rmiForce bool
+
+var rmiCommand = &cobra.Command{
+	Use:   "rmi IMAGE [IMAGE...]",
+	Short: "Remove one or more images",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, ref := range args {
+			res := sendDaemonRequest("rmi", types.ImageRequest{Image: ref, Force: rmiForce})
+
+			var report types.ImageDeleteReport
+			if err := json.Unmarshal(res.Data, &report); err != nil {
+				logrus.Fatalf("解析來自 Daemon 的結果失敗: %v", err)
+			}
+			printImageDeleteReport(&report)
+		}
+	},
+}
+
+// printImageDeleteReport 以 Docker 的格式輸出被移除的 tag 與映像
+func printImageDeleteReport(report *types.ImageDeleteReport) {
+	for _, tag := range report.Untagged {
+		fmt.Printf("Untagged: %s\n", tag)
+	}
+	for _, id := range report.Deleted {
+		fmt.Printf("Deleted: %s\n", id)
+	}
+}
+
+func init() {
+	rmiCommand.Flags().BoolVarP(&rmiForce, "force", "f", false, "Force removal of the image")
+	rootCmd.AddCommand(rmiCommand)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"encoding/json"
+	"io"
 	"log"
 	// "net/http"
 	"os"
@@ -9,8 +11,10 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"gocker/internal/api"
 	"gocker/internal/config"
 	"gocker/internal/network"
+	"gocker/internal/types"
 )
 
 var logLevel string
@@ -46,3 +50,43 @@ func Execute() {
 		logrus.Fatal(err)
 	}
 }
+
+// sendDaemonRequest 發送請求給 daemon，通訊失敗或 daemon 回傳錯誤時直接結束程式
+func sendDaemonRequest(command string, payload any) *types.Response {
+	res, err := api.SendRequest(newDaemonRequest(command, payload))
+	return checkDaemonResponse(res, err)
+}
+
+// sendDaemonStreamRequest 與 sendDaemonRequest 相同，但會將過程中的進度回應交給 onProgress
+func sendDaemonStreamRequest(command string, payload any, onProgress func(json.RawMessage)) *types.Response {
+	res, err := api.SendStreamRequest(newDaemonRequest(command, payload), onProgress)
+	return checkDaemonResponse(res, err)
+}
+
+// sendDaemonUploadRequest 與 sendDaemonRequest 相同，但會在請求之後傳送 body 的內容
+func sendDaemonUploadRequest(command string, payload any, body io.Reader) *types.Response {
+	res, err := api.SendUploadRequest(newDaemonRequest(command, payload), body)
+	return checkDaemonResponse(res, err)
+}
+
+func newDaemonRequest(command string, payload any) types.Request {
+	req := types.Request{Command: command}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			logrus.Fatalf("序列化 %s 請求失敗: %v", command, err)
+		}
+		req.Payload = data
+	}
+	return req
+}
+
+func checkDaemonResponse(res *types.Response, err error) *types.Response {
+	if err != nil {
+		logrus.Fatalf("與 gocker-daemon 通訊失敗: %v", err)
+	}
+	if res.Status != "success" {
+		logrus.Fatalf("來自 Daemon 的錯誤: %s", res.Message)
+	}
+	return res
+}
@@ -5,7 +5,9 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 
 	"gocker/internal"
@@ -13,13 +15,43 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 
 	"gocker/internal/config"
+	"gocker/internal/storage"
 	"gocker/internal/types"
+	"gocker/internal/volume"
 )
 
 var request types.RunRequest
 var initInstructionFile string
+var volumeSpecs []string
+var storageOpts []string
+var cpuShares int
+var (
+	runCPUs       float64
+	runCpusetCpus string
+	runCpusetMems string
+)
+var (
+	runMemory            string
+	runMemorySwap        string
+	runMemoryReservation string
+	runMemoryHigh        string
+	runOOMKillDisable    bool
+	runOOMKillGroup      bool
+)
+var (
+	runDeviceReadBps   []string
+	runDeviceWriteBps  []string
+	runDeviceReadIOps  []string
+	runDeviceWriteIOps []string
+)
+var (
+	runEntrypoint string
+	runEnv        []string
+	runEnvFiles   []string
+)
 
 var runCommand = &cobra.Command{
 	Use:   "run [OPTIONS] IMAGE COMMAND [ARG...]",
@@ -30,14 +62,17 @@ Use double dashes (--) if you want to pass arguments to the command. like 'gocke
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		imageName, imageTag := pkg.Parse(args[0])
+		if imageName == "" {
+			logrus.Fatalf("無效的映像名稱: %s", args[0])
+		}
 		logrus.Infof("Image: %s, Tag: %s", imageName, imageTag)
 
 		request.ImageName = imageName
 		request.ImageTag = imageTag
 
 		if len(args) == 1 {
-			logrus.Info("沒有指定容器命令，預設使用 /bin/sh")
-			request.ContainerCommand = config.DefaultCommand
+			logrus.Info("沒有指定容器命令，使用映像的 Entrypoint/Cmd")
+			request.ContainerCommand = ""
 			request.ContainerArgs = []string{}
 		} else {
 			request.ContainerCommand = args[1]
@@ -52,7 +87,8 @@ Use double dashes (--) if you want to pass arguments to the command. like 'gocke
 		 * If the file is specified but does not exist, we will exit with error
 		 * If the file is not specified and does not exist, we will skip the initialization step
 		 * If the file exists, we will read the commands from the file and pass it to the container
-		 * The commands will be executed in the container before the main command
+		 * The commands will be applied to the image as cached layers before the main command,
+		 * so unchanged commands are not executed again on the next run
 		 */
 		instructionPath := initInstructionFile
 		if instructionPath != "" {
@@ -69,6 +105,64 @@ Use double dashes (--) if you want to pass arguments to the command. like 'gocke
 				}
 			}
 		}
+		if cmd.Flags().Changed("entrypoint") {
+			request.Entrypoint = &runEntrypoint
+		}
+		env, err := loadEnv(runEnvFiles, runEnv)
+		if err != nil {
+			logrus.Fatalf("Failed to load environment variables: %v", err)
+		}
+		request.Env = env
+
+		for _, spec := range volumeSpecs {
+			mount, err := volume.ParseMount(spec)
+			if err != nil {
+				logrus.Fatalf("Invalid volume specification: %v", err)
+			}
+			request.Mounts = append(request.Mounts, mount)
+		}
+		storageSize, err := parseStorageOpts(storageOpts)
+		if err != nil {
+			logrus.Fatalf("Invalid storage option: %v", err)
+		}
+		request.StorageSize = storageSize
+		request.CPUWeight, err = resolveCPUWeight(cpuShares, request.CPUWeight)
+		if err != nil {
+			logrus.Fatalf("Invalid CPU weight: %v", err)
+		}
+		if request.CPUMillis, err = parseCPUs(runCPUs); err != nil {
+			logrus.Fatalf("Invalid CPU limit: %v", err)
+		}
+		if cmd.Flags().Changed("cpuset-cpus") {
+			request.CpusetCpus = &runCpusetCpus
+		}
+		if cmd.Flags().Changed("cpuset-mems") {
+			request.CpusetMems = &runCpusetMems
+		}
+		// gocker run 在本行程中建立容器，因此同樣要套用 daemon 設定的 storage driver 與預設的記憶體上限
+		daemonConfig, err := config.LoadDaemonConfig(config.DaemonConfigPath)
+		if err != nil {
+			logrus.Fatalf("Failed to load daemon config: %v", err)
+		}
+		defaultMemory, err := defaultMemoryLimit(daemonConfig)
+		if err != nil {
+			logrus.Fatalf("Invalid default-memory in daemon config: %v", err)
+		}
+		if err := parseMemoryLimits(&request.ContainerLimits, runMemory, runMemorySwap, runMemoryReservation, runMemoryHigh, defaultMemory, 0); err != nil {
+			logrus.Fatalf("Invalid memory limit: %v", err)
+		}
+		if runOOMKillDisable {
+			request.OOMKillDisable = &runOOMKillDisable
+		}
+		if runOOMKillGroup {
+			request.OOMKillGroup = &runOOMKillGroup
+		}
+		if err := parseIOLimits(&request.ContainerLimits, runDeviceReadBps, runDeviceWriteBps, runDeviceReadIOps, runDeviceWriteIOps); err != nil {
+			logrus.Fatalf("Invalid block IO limit: %v", err)
+		}
+		if err := storage.SetDefault(daemonConfig.StorageDriver); err != nil {
+			logrus.Fatalf("Invalid storage driver: %v", err)
+		}
 		if err := internal.RunContainer(&request); err != nil {
 			logrus.Fatalf("Failed to run container: %v", err)
 		}
@@ -78,9 +172,31 @@ Use double dashes (--) if you want to pass arguments to the command. like 'gocke
 func init() {
 	runCommand.Flags().StringVarP(&request.ContainerName, "name", "", "", "Assign a name to the container")
 	runCommand.Flags().IntVar(&request.PidsLimit, "pids-limit", config.DefaultPidsLimit, "Limit the number of container tasks")
-	runCommand.Flags().IntVarP(&request.MemoryLimit, "memory", "m", config.DefaultMemoryLimit, "Limit the memory")
-	runCommand.Flags().IntVar(&request.CPULimit, "cpus", config.DefaultCPULimit, "Limit the number of CPUs")
+	runCommand.Flags().StringVarP(&runMemory, "memory", "m", "", `Memory limit (e.g. 512m, 2g, 0 for unlimited; defaults to "default-memory" in daemon.json, or 200m)`)
+	runCommand.Flags().StringVar(&runMemorySwap, "memory-swap", "", "Total memory plus swap limit (-1 for unlimited swap; defaults to twice the memory limit)")
+	runCommand.Flags().StringVar(&runMemoryReservation, "memory-reservation", "", "Memory soft limit protected from reclaim (written to memory.low)")
+	runCommand.Flags().StringVar(&runMemoryHigh, "memory-high", "", "Memory usage throttle limit (written to memory.high)")
+	runCommand.Flags().BoolVar(&runOOMKillDisable, "oom-kill-disable", false, "Disable OOM Killer for the container (requires a memory limit; the host OOM killer also skips its processes)")
+	runCommand.Flags().BoolVar(&runOOMKillGroup, "oom-kill-group", false, "Kill all processes of the container together on OOM (written to memory.oom.group)")
+	runCommand.Flags().Float64Var(&runCPUs, "cpus", float64(config.DefaultCPUMillis)/1000, "Number of CPUs (e.g. 0.5, with millicore precision)")
+	runCommand.Flags().IntVar(&cpuShares, "cpu-shares", 0, "CPU shares (relative weight, 2-262144, converted to cpu.weight)")
+	runCommand.Flags().IntVar(&request.CPUWeight, "cpu-weight", 0, "CPU weight (1-10000, written to cpu.weight)")
+	runCommand.Flags().StringVar(&runCpusetCpus, "cpuset-cpus", "", "CPUs in which to allow execution (0-3, 0,1)")
+	runCommand.Flags().StringVar(&runCpusetMems, "cpuset-mems", "", "MEMs in which to allow execution (0-3, 0,1)")
+	runCommand.Flags().IntVar(&request.BlkioWeight, "blkio-weight", 0, "Block IO (relative weight), between 10 and 1000, or 0 to disable (default 0)")
+	runCommand.Flags().StringArrayVar(&runDeviceReadBps, "device-read-bps", nil, "Limit read rate (bytes per second) from a device (e.g. /dev/sda:10mb)")
+	runCommand.Flags().StringArrayVar(&runDeviceWriteBps, "device-write-bps", nil, "Limit write rate (bytes per second) to a device (e.g. /dev/sda:10mb)")
+	runCommand.Flags().StringArrayVar(&runDeviceReadIOps, "device-read-iops", nil, "Limit read rate (IO per second) from a device (e.g. /dev/sda:1000)")
+	runCommand.Flags().StringArrayVar(&runDeviceWriteIOps, "device-write-iops", nil, "Limit write rate (IO per second) to a device (e.g. /dev/sda:1000)")
 	runCommand.Flags().StringVar(&request.RequestedIP, "ip", "", "Request a specific IPv4 address for the container")
+	runCommand.Flags().StringVar(&runEntrypoint, "entrypoint", "", "Overwrite the default ENTRYPOINT of the image")
+	runCommand.Flags().StringArrayVarP(&runEnv, "env", "e", nil, "Set environment variables (KEY=VALUE, or KEY to pass through the current value)")
+	runCommand.Flags().StringArrayVar(&runEnvFiles, "env-file", nil, "Read in a file of environment variables")
+	runCommand.Flags().StringVarP(&request.WorkingDir, "workdir", "w", "", "Working directory inside the container")
+	runCommand.Flags().StringVarP(&request.User, "user", "u", "", "Username or UID (format: <name|uid>[:<group|gid>])")
+	runCommand.Flags().StringVar(&request.Platform, "platform", "", "Require the image to match this platform (os/arch[/variant])")
+	runCommand.Flags().StringArrayVarP(&volumeSpecs, "volume", "v", nil, "Bind mount a volume (NAME:/path, /host/path:/path or /path, optionally suffixed with :ro)")
+	runCommand.Flags().StringArrayVar(&storageOpts, "storage-opt", nil, "Storage driver options for the container (size=10G limits the writable layer)")
 	runCommand.Flags().StringVar(&initInstructionFile, "init-file", "", fmt.Sprintf("Path to initialization instructions file (default %s)",
 		config.DefaultInitInstructionFile))
 	rootCmd.AddCommand(runCommand)
@@ -118,3 +234,203 @@ func loadInitCommands(path string) ([]string, error) {
 
 	return commands, nil
 }
+
+// parseStorageOpts 解析 --storage-opt 的 key=value，目前只支援 size (可寫入層的大小上限)
+func parseStorageOpts(opts []string) (int64, error) {
+	var size int64
+	for _, opt := range opts {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return 0, fmt.Errorf("invalid storage option %q, expected key=value", opt)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "size":
+			parsed, err := pkg.ParseSize(value)
+			if err != nil {
+				return 0, err
+			}
+			if parsed <= 0 {
+				return 0, fmt.Errorf("storage size must be greater than 0")
+			}
+			size = parsed
+		default:
+			return 0, fmt.Errorf("unknown storage option %q", key)
+		}
+	}
+	return size, nil
+}
+
+// defaultMemoryLimit 回傳沒有指定 --memory 時的記憶體上限，daemon.json 沒有設定時為 config.DefaultMemoryLimit
+func defaultMemoryLimit(cfg *config.DaemonConfig) (int64, error) {
+	if cfg.DefaultMemory == "" {
+		return config.DefaultMemoryLimit, nil
+	}
+	return pkg.ParseSize(cfg.DefaultMemory)
+}
+
+// parseMemoryLimits 解析記憶體相關的參數並填入 limits，沒有指定的記憶體上限為 memoryUnset，
+// 保留量與 memory.high 為 otherUnset；--memory-swap 沒有指定時為 0，-1 表示不限制 swap
+func parseMemoryLimits(limits *types.ContainerLimits, memory, swap, reservation, high string, memoryUnset, otherUnset int64) error {
+	parse := func(name, value string, unset int64) (int64, error) {
+		if value == "" {
+			return unset, nil
+		}
+		size, err := pkg.ParseSize(value)
+		if err != nil {
+			return 0, fmt.Errorf("--%s: %w", name, err)
+		}
+		return size, nil
+	}
+
+	var err error
+	if limits.MemoryLimit, err = parse("memory", memory, memoryUnset); err != nil {
+		return err
+	}
+	if limits.MemoryReservation, err = parse("memory-reservation", reservation, otherUnset); err != nil {
+		return err
+	}
+	if limits.MemoryHigh, err = parse("memory-high", high, otherUnset); err != nil {
+		return err
+	}
+	if swap == "-1" {
+		limits.MemorySwap = -1
+		return nil
+	}
+	if limits.MemorySwap, err = parse("memory-swap", swap, 0); err != nil {
+		return err
+	}
+	if swap != "" && limits.MemorySwap == 0 {
+		return fmt.Errorf("--memory-swap must be greater than 0, or -1 for unlimited swap")
+	}
+	return nil
+}
+
+// parseIOLimits 解析 --device-{read,write}-{bps,iops} 並填入 limits
+func parseIOLimits(limits *types.ContainerLimits, readBps, writeBps, readIOps, writeIOps []string) error {
+	var err error
+	if limits.DeviceReadBps, err = parseThrottleDevices(readBps, false); err != nil {
+		return err
+	}
+	if limits.DeviceWriteBps, err = parseThrottleDevices(writeBps, false); err != nil {
+		return err
+	}
+	if limits.DeviceReadIOps, err = parseThrottleDevices(readIOps, true); err != nil {
+		return err
+	}
+	limits.DeviceWriteIOps, err = parseThrottleDevices(writeIOps, true)
+	return err
+}
+
+// parseThrottleDevices 解析 PATH:RATE 格式的裝置速率上限，並將裝置路徑轉換為 major:minor
+// bps 的速率可以帶單位 (例如 10mb)，iops 的速率為整數；速率為 0 表示解除限制
+func parseThrottleDevices(specs []string, iops bool) ([]types.ThrottleDevice, error) {
+	var devices []types.ThrottleDevice
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid device rate %q, expected PATH:RATE", spec)
+		}
+		path, value := spec[:i], spec[i+1:]
+
+		var rate uint64
+		if iops {
+			parsed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IO rate %q for %s: expected a non-negative integer", value, path)
+			}
+			rate = parsed
+		} else {
+			parsed, err := pkg.ParseSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate %q for %s: %w", value, path, err)
+			}
+			rate = uint64(parsed)
+		}
+
+		var st unix.Stat_t
+		if err := unix.Stat(path, &st); err != nil {
+			return nil, fmt.Errorf("failed to stat device %s: %w", path, err)
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+			return nil, fmt.Errorf("%s is not a block device", path)
+		}
+		devices = append(devices, types.ThrottleDevice{
+			Path:  path,
+			Major: int64(unix.Major(uint64(st.Rdev))),
+			Minor: int64(unix.Minor(uint64(st.Rdev))),
+			Rate:  rate,
+		})
+	}
+	return devices, nil
+}
+
+// resolveCPUWeight 將 --cpu-shares (cgroup v1 的 cpu.shares) 換算為 cgroup v2 的 cpu.weight
+// 換算方式與 runc 相同；兩者都沒有指定時回傳 0，表示使用預設值
+func resolveCPUWeight(shares, weight int) (int, error) {
+	if shares > 0 && weight > 0 {
+		return 0, fmt.Errorf("--cpu-shares and --cpu-weight cannot be used together")
+	}
+	if shares > 0 {
+		if shares < 2 || shares > 262144 {
+			return 0, fmt.Errorf("CPU shares %d out of range (2-262144)", shares)
+		}
+		return 1 + ((shares-2)*9999)/262142, nil
+	}
+	if weight > 0 {
+		if weight > 10000 {
+			return 0, fmt.Errorf("CPU weight %d out of range (1-10000)", weight)
+		}
+		return weight, nil
+	}
+	return 0, nil
+}
+
+// parseCPUs 將 --cpus 的 CPU 數量換算為 millicore，0 表示不限制
+func parseCPUs(cpus float64) (int64, error) {
+	if cpus < 0 {
+		return 0, fmt.Errorf("CPU limit %g must not be negative", cpus)
+	}
+	return int64(math.Round(cpus * 1000)), nil
+}
+
+/*
+* loadEnv 依照 Docker 的規則組合環境變數：先讀取 --env-file，再套用 -e。
+* 只有 KEY 沒有值的項目會沿用目前終端機環境中的值，若目前環境沒有設定則略過。
+ */
+func loadEnv(envFiles, envs []string) ([]string, error) {
+	var result []string
+	add := func(entry string) {
+		if strings.Contains(entry, "=") {
+			result = append(result, entry)
+			return
+		}
+		if value, ok := os.LookupEnv(entry); ok {
+			result = append(result, entry+"="+value)
+		}
+	}
+
+	for _, path := range envFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open env file: %w", err)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			add(line)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file %s: %w", path, err)
+		}
+	}
+
+	for _, entry := range envs {
+		add(entry)
+	}
+	return result, nil
+}
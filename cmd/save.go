@@ -0,0 +1,44 @@
+// cmd/save.go
+package cmd
+
+import (
+	"path/filepath"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	saveOutput string
+	saveFormat string
+)
+
+var saveCommand = &cobra.Command{
+	Use:   "save -o FILE IMAGE [IMAGE...]",
+	Short: "Save one or more images to a tar archive",
+	Long:  "Save one or more images to a tar archive, in docker save format (default) or as an OCI image layout (--format oci).",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// 檔案由 daemon 寫入，因此需要轉換為絕對路徑
+		output, err := filepath.Abs(saveOutput)
+		if err != nil {
+			logrus.Fatalf("解析輸出路徑 %s 失敗: %v", saveOutput, err)
+		}
+
+		sendDaemonRequest("save", types.ImageSaveRequest{
+			Images: args,
+			Output: output,
+			Format: saveFormat,
+		})
+		logrus.Infof("已將映像匯出到 %s", output)
+	},
+}
+
+func init() {
+	saveCommand.Flags().StringVarP(&saveOutput, "output", "o", "", "Write to a file")
+	saveCommand.Flags().StringVar(&saveFormat, "format", types.ImageArchiveDocker, "Archive format (docker or oci)")
+	saveCommand.MarkFlagRequired("output")
+	rootCmd.AddCommand(saveCommand)
+}
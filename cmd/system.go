@@ -0,0 +1,294 @@
+// cmd/system.go
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	systemDfVerbose    bool
+	systemPruneAll     bool
+	systemPruneVolumes bool
+	systemPruneForce   bool
+	systemPruneFilters []string
+)
+
+var systemCommand = &cobra.Command{
+	Use:   "system",
+	Short: "Manage gocker",
+}
+
+var systemDfCommand = &cobra.Command{
+	Use:   "df",
+	Short: "Show gocker disk usage",
+	Long: `Show the disk space used by images, containers, local volumes and build cache.
+Layers shared between images are counted only once in the totals.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("system_df", nil)
+
+		var usage types.DiskUsage
+		if err := json.Unmarshal(res.Data, &usage); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的空間使用量失敗: %v", err)
+		}
+		if systemDfVerbose {
+			printDiskUsageVerbose(&usage)
+		} else {
+			printDiskUsageSummary(&usage)
+		}
+	},
+}
+
+var systemPruneCommand = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove unused data",
+	Long: `Remove all stopped containers, dangling images, IP allocations left by removed containers and build cache.
+With --all, remove all images not used by any container. With --volumes, also remove unused volumes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := types.SystemPruneRequest{All: systemPruneAll, Volumes: systemPruneVolumes}
+		until, err := parsePruneFilters(systemPruneFilters)
+		if err != nil {
+			logrus.Fatalf("Invalid filter: %v", err)
+		}
+		req.Until = until
+		if req.Volumes && !req.Until.IsZero() {
+			logrus.Fatal(`The "until" filter is not supported with --volumes`)
+		}
+		if !systemPruneForce && !confirmSystemPrune(req) {
+			return
+		}
+
+		res := sendDaemonRequest("system_prune", req)
+		var report types.SystemPruneReport
+		if err := json.Unmarshal(res.Data, &report); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的清理結果失敗: %v", err)
+		}
+		printPruneSection("Deleted Containers:", report.Containers)
+		printPruneSection("Released IP allocations:", report.ReleasedIPs)
+		printPruneSection("Deleted Volumes:", report.Volumes)
+		if report.Images != nil && (len(report.Images.Untagged) > 0 || len(report.Images.Deleted) > 0) {
+			fmt.Println("Deleted Images:")
+			printImageDeleteReport(report.Images)
+			fmt.Println()
+		}
+		cache := make([]string, len(report.BuildCache))
+		for i, id := range report.BuildCache {
+			cache[i] = pkg.TruncateID(id)
+		}
+		printPruneSection("Deleted build cache objects:", cache)
+		fmt.Printf("Total reclaimed space: %s\n", pkg.HumanSize(report.SpaceReclaimed))
+	},
+}
+
+// confirmSystemPrune 列出將被刪除的項目，並詢問使用者是否繼續
+func confirmSystemPrune(req types.SystemPruneRequest) bool {
+	fmt.Println("WARNING! This will remove:")
+	fmt.Println("  - all stopped containers")
+	fmt.Println("  - all IP allocations left by removed containers")
+	if req.Volumes {
+		fmt.Println("  - all volumes not used by at least one container")
+	}
+	if req.All {
+		fmt.Println("  - all images without at least one container associated to them")
+	} else {
+		fmt.Println("  - all dangling images")
+	}
+	fmt.Println("  - all build cache")
+	if !req.Until.IsZero() {
+		fmt.Printf("\nItems to be pruned will be filtered with: until=%s\n", req.Until.Format(time.RFC3339))
+	}
+	fmt.Print("\nAre you sure you want to continue? [y/N] ")
+
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && input == "" {
+		return false
+	}
+	choice := strings.TrimSpace(strings.ToLower(input))
+	return choice == "y" || choice == "yes"
+}
+
+// parsePruneFilters 解析 --filter，目前只支援 until (Go 的時間長度如 24h，或 RFC3339、YYYY-MM-DD、Unix 時間戳記)
+func parsePruneFilters(filters []string) (time.Time, error) {
+	var until time.Time
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok {
+			return time.Time{}, fmt.Errorf("%q is not of the form key=value", filter)
+		}
+		if key != "until" {
+			return time.Time{}, fmt.Errorf("unsupported filter %q", key)
+		}
+		t, err := parseUntil(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		until = t
+	}
+	return until, nil
+}
+
+// parseUntil 將 until 的值轉換為時間點，時間長度表示從現在往前推算
+func parseUntil(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid until value %q", value)
+}
+
+// printPruneSection 印出清理結果中的一類項目，沒有項目時不輸出
+func printPruneSection(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Println(title)
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	fmt.Println()
+}
+
+// printDiskUsageSummary 以 TYPE、TOTAL、ACTIVE、SIZE、RECLAIMABLE 的表格列出各類資源的總計
+func printDiskUsageSummary(usage *types.DiskUsage) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "TYPE\tTOTAL\tACTIVE\tSIZE\tRECLAIMABLE\n")
+	row := func(name string, total, active int, size, reclaimable int64) {
+		percent := 0
+		if size > 0 {
+			percent = int(reclaimable * 100 / size)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s (%d%%)\n", name, total, active,
+			pkg.HumanSize(size), pkg.HumanSize(reclaimable), percent)
+	}
+
+	activeImages := 0
+	for _, img := range usage.Images {
+		if img.Containers > 0 {
+			activeImages++
+		}
+	}
+	row("Images", len(usage.Images), activeImages, usage.ImagesSize, usage.ImagesReclaimable)
+
+	activeContainers := 0
+	var containersSize, containersReclaimable int64
+	for _, c := range usage.Containers {
+		containersSize += c.SizeRw
+		if c.Status == types.Running {
+			activeContainers++
+		} else {
+			containersReclaimable += c.SizeRw
+		}
+	}
+	row("Containers", len(usage.Containers), activeContainers, containersSize, containersReclaimable)
+
+	activeVolumes := 0
+	var volumesSize, volumesReclaimable int64
+	for _, v := range usage.Volumes {
+		volumesSize += v.Size
+		if len(v.Containers) > 0 {
+			activeVolumes++
+		} else {
+			volumesReclaimable += v.Size
+		}
+	}
+	row("Local Volumes", len(usage.Volumes), activeVolumes, volumesSize, volumesReclaimable)
+
+	activeCache := 0
+	for _, img := range usage.BuildCache {
+		if img.Containers > 0 {
+			activeCache++
+		}
+	}
+	row("Build Cache", len(usage.BuildCache), activeCache, usage.BuildCacheSize, usage.BuildCacheReclaimable)
+
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Failed to flush output: %v", err)
+	}
+}
+
+// printDiskUsageVerbose 分別列出每個映像、容器、volume 與建置快取占用的空間
+func printDiskUsageVerbose(usage *types.DiskUsage) {
+	created := func(t time.Time) string {
+		if t.IsZero() {
+			return "N/A"
+		}
+		return pkg.HumanDuration(time.Since(t)) + " ago"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+
+	fmt.Fprint(w, "Images space usage:\n\n")
+	fmt.Fprint(w, "REPOSITORY\tTAG\tIMAGE ID\tCREATED\tSIZE\tSHARED SIZE\tUNIQUE SIZE\tCONTAINERS\n")
+	for _, img := range usage.Images {
+		tags := img.RepoTags
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			repo, t := splitRepoTag(tag)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", repo, t, pkg.TruncateID(img.ImageID), created(img.Created),
+				pkg.HumanSize(img.Size), pkg.HumanSize(img.SharedSize), pkg.HumanSize(img.UniqueSize), img.Containers)
+		}
+	}
+
+	fmt.Fprint(w, "\nContainers space usage:\n\n")
+	fmt.Fprint(w, "CONTAINER ID\tIMAGE\tCOMMAND\tSIZE\tCREATED\tSTATUS\tNAMES\n")
+	for _, c := range usage.Containers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pkg.TruncateID(c.ID), c.Image, c.Command,
+			pkg.HumanSize(c.SizeRw), created(c.CreatedAt), c.Status, c.Name)
+	}
+
+	fmt.Fprint(w, "\nLocal Volumes space usage:\n\n")
+	fmt.Fprint(w, "VOLUME NAME\tLINKS\tSIZE\n")
+	for _, v := range usage.Volumes {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", v.Name, len(v.Containers), pkg.HumanSize(v.Size))
+	}
+
+	fmt.Fprint(w, "\nBuild cache usage:\n\n")
+	fmt.Fprint(w, "CACHE ID\tCREATED\tSIZE\tSHARED SIZE\tUNIQUE SIZE\tIN USE\n")
+	for _, img := range usage.BuildCache {
+		inUse := "false"
+		if img.Containers > 0 {
+			inUse = "true"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", pkg.TruncateID(img.ImageID), created(img.Created),
+			pkg.HumanSize(img.Size), pkg.HumanSize(img.SharedSize), pkg.HumanSize(img.UniqueSize), inUse)
+	}
+
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Failed to flush output: %v", err)
+	}
+}
+
+func init() {
+	systemDfCommand.Flags().BoolVarP(&systemDfVerbose, "verbose", "v", false, "Show detailed information on space usage")
+
+	systemPruneCommand.Flags().BoolVarP(&systemPruneAll, "all", "a", false, "Remove all unused images, not just dangling ones")
+	systemPruneCommand.Flags().BoolVar(&systemPruneVolumes, "volumes", false, "Prune volumes")
+	systemPruneCommand.Flags().BoolVarP(&systemPruneForce, "force", "f", false, "Do not prompt for confirmation")
+	systemPruneCommand.Flags().StringArrayVar(&systemPruneFilters, "filter", nil, `Provide filter values (e.g. "until=24h")`)
+
+	systemCommand.AddCommand(systemDfCommand)
+	systemCommand.AddCommand(systemPruneCommand)
+	rootCmd.AddCommand(systemCommand)
+}
@@ -0,0 +1,23 @@
+// cmd/tag.go
+package cmd
+
+import (
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var tagCommand = &cobra.Command{
+	Use:   "tag SOURCE_IMAGE[:TAG] TARGET_IMAGE[:TAG]",
+	Short: "Create a tag TARGET_IMAGE that refers to SOURCE_IMAGE",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sendDaemonRequest("tag", types.ImageRequest{Image: args[0], Target: args[1]})
+		logrus.Infof("Tagged %s as %s", args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCommand)
+}
@@ -0,0 +1,137 @@
+// cmd/volume.go
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var volumeLabels []string
+
+var volumeCommand = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage volumes",
+}
+
+var volumeCreateCommand = &cobra.Command{
+	Use:   "create [VOLUME]",
+	Short: "Create a volume",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		volReq := types.VolumeRequest{Labels: map[string]string{}}
+		if len(args) == 1 {
+			volReq.Name = args[0]
+		}
+		for _, label := range volumeLabels {
+			key, value, _ := strings.Cut(label, "=")
+			volReq.Labels[key] = value
+		}
+
+		res := sendDaemonRequest("volume_create", volReq)
+		fmt.Println(res.Message)
+	},
+}
+
+var volumeListCommand = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List volumes",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("volume_ls", nil)
+
+		var volumes []types.VolumeInfo
+		if err := json.Unmarshal(res.Data, &volumes); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的 volume 列表失敗: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+		fmt.Fprint(w, "DRIVER\tVOLUME NAME\tREFS\n")
+		for _, v := range volumes {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", v.Driver, v.Name, len(v.Containers))
+		}
+		if err := w.Flush(); err != nil {
+			logrus.Errorf("Failed to flush output: %v", err)
+		}
+	},
+}
+
+var volumeInspectCommand = &cobra.Command{
+	Use:   "inspect VOLUME [VOLUME...]",
+	Short: "Display detailed information on one or more volumes",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		volumes := []types.VolumeInfo{}
+		for _, name := range args {
+			res := sendDaemonRequest("volume_inspect", types.VolumeRequest{Name: name})
+
+			var info types.VolumeInfo
+			if err := json.Unmarshal(res.Data, &info); err != nil {
+				logrus.Fatalf("解析來自 Daemon 的 volume 資訊失敗: %v", err)
+			}
+			volumes = append(volumes, info)
+		}
+
+		out, err := json.MarshalIndent(volumes, "", "    ")
+		if err != nil {
+			logrus.Fatalf("序列化 volume 資訊失敗: %v", err)
+		}
+		fmt.Println(string(out))
+	},
+}
+
+var volumeRemoveCommand = &cobra.Command{
+	Use:     "rm VOLUME [VOLUME...]",
+	Aliases: []string{"remove"},
+	Short:   "Remove one or more volumes",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range args {
+			res := sendDaemonRequest("volume_rm", types.VolumeRequest{Name: name})
+			fmt.Println(res.Message)
+		}
+	},
+}
+
+var volumePruneCommand = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove all unused volumes",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res := sendDaemonRequest("volume_prune", nil)
+
+		var report types.VolumePruneReport
+		if err := json.Unmarshal(res.Data, &report); err != nil {
+			logrus.Fatalf("解析來自 Daemon 的清理結果失敗: %v", err)
+		}
+
+		if len(report.Deleted) > 0 {
+			fmt.Println("Deleted Volumes:")
+			for _, name := range report.Deleted {
+				fmt.Println(name)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("Total reclaimed space: %s\n", pkg.HumanSize(report.SpaceReclaimed))
+	},
+}
+
+func init() {
+	volumeCreateCommand.Flags().StringArrayVar(&volumeLabels, "label", nil, "Set metadata for a volume (KEY=VALUE)")
+
+	volumeCommand.AddCommand(volumeCreateCommand)
+	volumeCommand.AddCommand(volumeListCommand)
+	volumeCommand.AddCommand(volumeInspectCommand)
+	volumeCommand.AddCommand(volumeRemoveCommand)
+	volumeCommand.AddCommand(volumePruneCommand)
+	rootCmd.AddCommand(volumeCommand)
+}
@@ -4,12 +4,16 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 
 	"gocker/internal/config"
 	"gocker/internal/types"
 )
 
+// uploadChunkSize 為 SendUploadRequest 每次傳送的資料大小
+const uploadChunkSize = 256 * 1024
+
 func SendRequest(req types.Request) (*types.Response, error) {
 	conn, err := net.Dial("unix", config.SocketPath)
 	if err != nil {
@@ -28,3 +32,71 @@ func SendRequest(req types.Request) (*types.Response, error) {
 
 	return &res, nil
 }
+
+// SendStreamRequest 發送請求並持續讀取 Status 為 "progress" 的回應，交給 onProgress 處理，
+// 直到收到最後的結果為止 (例如 pull 的下載進度)
+func SendStreamRequest(req types.Request, onProgress func(json.RawMessage)) (*types.Response, error) {
+	conn, err := net.Dial("unix", config.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("無法連接到 gocker-daemon: %w", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("發送請求失敗: %w", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var res types.Response
+		if err := decoder.Decode(&res); err != nil {
+			return nil, fmt.Errorf("讀取回應失敗: %w", err)
+		}
+		if res.Status != "progress" {
+			return &res, nil
+		}
+		if onProgress != nil {
+			onProgress(res.Data)
+		}
+	}
+}
+
+// SendUploadRequest 發送請求後將 body 的內容以 ArchiveChunk 分段傳送，再讀取最後的結果
+// (例如 cp 複製到容器的 tar 資料)
+func SendUploadRequest(req types.Request, body io.Reader) (*types.Response, error) {
+	conn, err := net.Dial("unix", config.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("無法連接到 gocker-daemon: %w", err)
+	}
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(req); err != nil {
+		return nil, fmt.Errorf("發送請求失敗: %w", err)
+	}
+
+	buf := make([]byte, uploadChunkSize)
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			if err := encoder.Encode(types.ArchiveChunk{Data: buf[:n]}); err != nil {
+				return nil, fmt.Errorf("發送資料失敗: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("讀取資料失敗: %w", err)
+		}
+	}
+	if err := encoder.Encode(types.ArchiveChunk{EOF: true}); err != nil {
+		return nil, fmt.Errorf("發送資料失敗: %w", err)
+	}
+
+	var res types.Response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return nil, fmt.Errorf("讀取回應失敗: %w", err)
+	}
+	return &res, nil
+}
@@ -0,0 +1,249 @@
+// internal/auth/auth.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gocker/internal/types"
+
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	clitypes "github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// ConfigDirEnv 可用來指定 gocker 設定檔的目錄
+const ConfigDirEnv = "GOCKER_CONFIG"
+
+// ConfigDir 回傳 gocker 設定檔 (config.json) 所在的目錄，預設為 ~/.gocker
+// 透過 sudo 執行時使用原本使用者的家目錄，讓憑證屬於執行 CLI 的使用者而不是 root
+func ConfigDir() string {
+	if dir := os.Getenv(ConfigDirEnv); dir != "" {
+		return dir
+	}
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		if u, err := user.Lookup(sudoUser); err == nil {
+			return filepath.Join(u.HomeDir, ".gocker")
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".gocker"
+	}
+	return filepath.Join(home, ".gocker")
+}
+
+// LoadConfig 讀取 gocker 設定檔，格式與 docker 的 config.json 相同，
+// 因此也支援 credsStore 與 credHelpers 等 credential helper 設定
+func LoadConfig() (*configfile.ConfigFile, error) {
+	cf, err := dockerconfig.Load(ConfigDir())
+	if err != nil {
+		return nil, fmt.Errorf("讀取設定檔 %s 失敗: %w", ConfigDir(), err)
+	}
+	return cf, nil
+}
+
+// ServerKey 回傳倉庫在設定檔中的 key 以及對應的 registry
+// Docker Hub 沿用 docker 的 "https://index.docker.io/v1/"，讓既有的 credential helper 可以共用
+func ServerKey(server string) (string, name.Registry, error) {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.TrimSuffix(server, "/")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	if server == "" {
+		server = name.DefaultRegistry
+	}
+
+	reg, err := name.NewRegistry(server)
+	if err != nil {
+		return "", name.Registry{}, fmt.Errorf("無效的倉庫位址 %q: %w", server, err)
+	}
+	if reg.RegistryStr() == name.DefaultRegistry {
+		return authn.DefaultAuthKey, reg, nil
+	}
+	return reg.RegistryStr(), reg, nil
+}
+
+// TransportFunc 回傳存取倉庫 host 時使用的 HTTP transport，以及該倉庫是否允許退回 HTTP
+type TransportFunc func(host string) (http.RoundTripper, bool, error)
+
+// Login 向倉庫驗證帳號密碼，成功後才寫入設定檔或 credential helper
+// transportFor 提供與 pull/push 相同的倉庫設定 (insecure-registries 與 certs-dir)
+func Login(server, username, password string, transportFor TransportFunc) (string, error) {
+	key, reg, err := ServerKey(server)
+	if err != nil {
+		return "", err
+	}
+	tr, insecure, err := transportFor(reg.RegistryStr())
+	if err != nil {
+		return "", fmt.Errorf("建立倉庫 %s 的連線設定失敗: %w", reg.RegistryStr(), err)
+	}
+	if insecure {
+		if reg, err = name.NewRegistry(reg.RegistryStr(), name.Insecure); err != nil {
+			return "", fmt.Errorf("無效的倉庫位址 %q: %w", server, err)
+		}
+	}
+	if err := verify(reg, username, password, tr); err != nil {
+		return "", err
+	}
+
+	cf, err := LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	err = cf.GetCredentialsStore(key).Store(clitypes.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("儲存 %s 的憑證失敗: %w", key, err)
+	}
+	chownToSudoUser(ConfigDir(), cf.Filename)
+	return key, nil
+}
+
+// Logout 移除倉庫的憑證，回傳的 bool 表示原本是否已登入
+func Logout(server string) (string, bool, error) {
+	key, _, err := ServerKey(server)
+	if err != nil {
+		return "", false, err
+	}
+	cf, err := LoadConfig()
+	if err != nil {
+		return "", false, err
+	}
+
+	store := cf.GetCredentialsStore(key)
+	existing, err := store.Get(key)
+	if err != nil {
+		return key, false, fmt.Errorf("讀取 %s 的憑證失敗: %w", key, err)
+	}
+	if existing.Username == "" && existing.Password == "" && existing.IdentityToken == "" {
+		return key, false, nil
+	}
+	if err := store.Erase(key); err != nil {
+		return key, true, fmt.Errorf("移除 %s 的憑證失敗: %w", key, err)
+	}
+	return key, true, nil
+}
+
+// ForReference 解析映像所屬倉庫的憑證，隨 pull/push 請求傳給 daemon
+// 優先使用 gocker 設定檔，找不到時退回 docker 的設定檔 (~/.docker/config.json)，都沒有時回傳 nil (匿名存取)
+func ForReference(ref string) (*types.RegistryAuth, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("無效的映像參照 %q: %w", ref, err)
+	}
+	reg := parsed.Context().Registry
+	key, _, err := ServerKey(reg.RegistryStr())
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 %s 的憑證失敗: %w", key, err)
+	}
+	if auth := fromAuthConfig(cfg.Username, cfg.Password, cfg.IdentityToken, cfg.RegistryToken); auth != nil {
+		return auth, nil
+	}
+
+	authenticator, err := authn.DefaultKeychain.Resolve(reg)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 docker 設定檔中的憑證失敗: %w", err)
+	}
+	if authenticator == authn.Anonymous {
+		return nil, nil
+	}
+	a, err := authenticator.Authorization()
+	if err != nil {
+		return nil, err
+	}
+	return fromAuthConfig(a.Username, a.Password, a.IdentityToken, a.RegistryToken), nil
+}
+
+func fromAuthConfig(username, password, identityToken, registryToken string) *types.RegistryAuth {
+	if username == "" && password == "" && identityToken == "" && registryToken == "" {
+		return nil
+	}
+	return &types.RegistryAuth{
+		Username:      username,
+		Password:      password,
+		IdentityToken: identityToken,
+		RegistryToken: registryToken,
+	}
+}
+
+// verify 以帳號密碼存取倉庫的 /v2/ 端點，確認憑證有效
+// 允許 HTTP 的倉庫與 pull/push 相同，先嘗試 HTTPS，連線失敗時才退回 HTTP
+func verify(reg name.Registry, username, password string, tr http.RoundTripper) error {
+	ctx := context.Background()
+	basic := &authn.Basic{Username: username, Password: password}
+
+	// 使用 bearer token 的倉庫會在此進行 token 交換，憑證錯誤時會直接失敗
+	rt, err := transport.NewWithContext(ctx, reg, basic, tr, []string{})
+	if err != nil {
+		return loginError(reg, err)
+	}
+
+	schemes := []string{"https"}
+	if reg.Scheme() == "http" {
+		schemes = append(schemes, "http")
+	}
+	client := &http.Client{Transport: rt}
+	var connErr error
+	for _, scheme := range schemes {
+		url := fmt.Sprintf("%s://%s/v2/", scheme, reg.RegistryStr())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			connErr = fmt.Errorf("連線到倉庫 %s 失敗: %w", reg.RegistryStr(), err)
+			continue
+		}
+		defer resp.Body.Close()
+		if err := transport.CheckError(resp, http.StatusOK); err != nil {
+			return loginError(reg, err)
+		}
+		return nil
+	}
+	return connErr
+}
+
+func loginError(reg name.Registry, err error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) && (terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("登入 %s 失敗: 帳號或密碼錯誤", reg.RegistryStr())
+	}
+	return fmt.Errorf("登入 %s 失敗: %w", reg.RegistryStr(), err)
+}
+
+// chownToSudoUser 透過 sudo 執行時，將設定檔的擁有者改回原本的使用者
+func chownToSudoUser(paths ...string) {
+	uid, err1 := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, err2 := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err1 != nil || err2 != nil || os.Getenv(ConfigDirEnv) != "" {
+		return
+	}
+	for _, path := range paths {
+		_ = os.Chown(path, uid, gid)
+	}
+}
@@ -0,0 +1,369 @@
+// internal/build/builder.go
+package build
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/container"
+	"gocker/internal/image"
+	"gocker/internal/types"
+	"gocker/pkg"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// excludedPaths 為執行 RUN 時由 gocker 寫入容器、不屬於映像內容的檔案
+var excludedPaths = []string{"/etc/resolv.conf", "/.old_root"}
+
+// Builder 依照 Gockerfile 建置映像 (gocker build)
+type Builder struct {
+	images     *image.Manager
+	containers *container.Manager
+}
+
+// NewBuilder 建立新的映像建置器
+func NewBuilder(im *image.Manager, cm *container.Manager) *Builder {
+	return &Builder{images: im, containers: cm}
+}
+
+// buildState 為建置過程中目前的映像
+type buildState struct {
+	req     *types.BuildRequest
+	out     io.Writer
+	imageID string // 目前的映像 ID，FROM scratch 且尚未有任何步驟時為空字串
+	config  v1.Config
+	cmdSet  bool // 此次建置是否設定過 CMD，用於決定 ENTRYPOINT 是否要清除基礎映像的 CMD
+	unpin   func()
+
+	// 以下只用於 --init-file 的初始化命令：以 root 身分在根目錄執行，並加上 gocker run 指定的環境變數
+	initEnv []string
+	init    bool
+}
+
+// Build 依照 req.Gockerfile 逐步建置映像，建置輸出寫入 out，回傳最終的映像 ID
+// 每個步驟都會產生一個中間映像：RUN 在暫時的容器中執行並將變更存成新的 layer，
+// COPY/ADD 直接由建置環境產生 layer，其他指令只修改映像的 config
+func (b *Builder) Build(req *types.BuildRequest, out io.Writer) (string, error) {
+	instructions, err := ParseFile(req.Gockerfile)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(config.BuildDir, 0755); err != nil {
+		return "", fmt.Errorf("建立建置目錄失敗: %w", err)
+	}
+
+	state := &buildState{req: req, out: out, unpin: func() {}}
+	defer func() { state.unpin() }()
+
+	for i, inst := range instructions {
+		fmt.Fprintf(out, "Step %d/%d : %s\n", i+1, len(instructions), inst)
+		if err := b.dispatch(state, inst); err != nil {
+			return "", fmt.Errorf("第 %d 行 %s: %w", inst.Line, inst.Command, err)
+		}
+		if state.imageID != "" {
+			fmt.Fprintf(out, " ---> %s\n", pkg.TruncateID(state.imageID))
+		}
+	}
+	if state.imageID == "" {
+		return "", fmt.Errorf("建置結果沒有任何內容")
+	}
+
+	fmt.Fprintf(out, "Successfully built %s\n", pkg.TruncateID(state.imageID))
+	for _, tag := range req.Tags {
+		if err := b.images.TagImage(state.imageID, tag); err != nil {
+			return "", fmt.Errorf("為映像加上 tag %s 失敗: %w", tag, err)
+		}
+		fmt.Fprintf(out, "Successfully tagged %s\n", tag)
+	}
+	return state.imageID, nil
+}
+
+// BuildInit 將 --init-file 的初始化命令依序當作 RUN 套用在 imageID 上，回傳產生的映像 ID
+// 命令以 root 身分在根目錄執行，並可以使用 env 中的環境變數；
+// 與建置相同，每個命令都會存成中間映像，沒有變化的命令會直接沿用快取而不重新執行
+// 產生的映像會維持 PinImage 標記，呼叫者在容器的根檔案系統建立之後必須呼叫回傳的函式解除
+func (b *Builder) BuildInit(imageID string, commands, env []string, out io.Writer) (string, func(), error) {
+	if err := os.MkdirAll(config.BuildDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("建立建置目錄失敗: %w", err)
+	}
+	cfg, err := image.ReadImageConfig(imageID)
+	if err != nil {
+		return "", nil, fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+
+	state := &buildState{req: &types.BuildRequest{}, out: out, unpin: func() {}, initEnv: env, init: true}
+	state.setImage(b.images, imageID)
+	state.config = cfg.Config
+
+	for i, command := range commands {
+		inst := &Instruction{Line: i + 1, Command: "RUN", Raw: command}
+		fmt.Fprintf(out, "Init %d/%d : %s\n", i+1, len(commands), command)
+		if err := b.run(state, inst); err != nil {
+			state.unpin()
+			return "", nil, fmt.Errorf("初始化命令 '%s': %w", command, err)
+		}
+		fmt.Fprintf(out, " ---> %s\n", pkg.TruncateID(state.imageID))
+	}
+	return state.imageID, state.unpin, nil
+}
+
+// dispatch 執行單一指令
+func (b *Builder) dispatch(state *buildState, inst *Instruction) error {
+	switch inst.Command {
+	case "FROM":
+		return b.from(state, inst)
+	case "RUN":
+		return b.run(state, inst)
+	case "COPY", "ADD":
+		return b.copy(state, inst)
+	}
+
+	if err := state.applyConfig(inst); err != nil {
+		return err
+	}
+	key := state.cacheKey(inst, "")
+	if b.useCache(state, key) {
+		return nil
+	}
+	return b.commit(state, inst, "", key)
+}
+
+// applyConfig 執行只修改映像 config 的指令 (ENV、LABEL、WORKDIR、USER、EXPOSE、CMD、ENTRYPOINT)
+func (s *buildState) applyConfig(inst *Instruction) error {
+	lookup := envLookup(s.config.Env)
+
+	switch inst.Command {
+	case "ENV":
+		words, err := splitWords(inst.Raw, lookup)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(words[0], "=") {
+			// 舊的 "ENV KEY value" 形式，值為其餘所有內容
+			words = []string{words[0] + "=" + strings.Join(words[1:], " ")}
+		}
+		for _, kv := range words {
+			if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+				return fmt.Errorf("無效的環境變數 %q，格式應為 KEY=VALUE", kv)
+			}
+		}
+		s.config.Env = container.MergeEnv(s.config.Env, words)
+	case "LABEL":
+		words, err := splitWords(inst.Raw, lookup)
+		if err != nil {
+			return err
+		}
+		labels := maps.Clone(s.config.Labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for _, kv := range words {
+			key, value, ok := strings.Cut(kv, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("無效的 label %q，格式應為 KEY=VALUE", kv)
+			}
+			labels[key] = value
+		}
+		s.config.Labels = labels
+	case "WORKDIR":
+		dir, err := processWord(inst.Raw, lookup)
+		if err != nil {
+			return err
+		}
+		if !path.IsAbs(dir) {
+			base := s.config.WorkingDir
+			if base == "" {
+				base = config.DefaultWorkingDir
+			}
+			dir = path.Join(base, dir)
+		}
+		s.config.WorkingDir = path.Clean(dir)
+	case "USER":
+		user, err := processWord(inst.Raw, lookup)
+		if err != nil {
+			return err
+		}
+		s.config.User = user
+	case "EXPOSE":
+		words, err := splitWords(inst.Raw, lookup)
+		if err != nil {
+			return err
+		}
+		ports := maps.Clone(s.config.ExposedPorts)
+		if ports == nil {
+			ports = map[string]struct{}{}
+		}
+		for _, port := range words {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			ports[strings.ToLower(port)] = struct{}{}
+		}
+		s.config.ExposedPorts = ports
+	case "CMD":
+		s.config.Cmd = commandArgs(inst)
+		s.cmdSet = true
+	case "ENTRYPOINT":
+		s.config.Entrypoint = commandArgs(inst)
+		// 與 docker 相同，設定 ENTRYPOINT 時會清除從基礎映像繼承的 CMD
+		if !s.cmdSet {
+			s.config.Cmd = nil
+		}
+	default:
+		return fmt.Errorf("不支援的指令 %s", inst.Command)
+	}
+	return nil
+}
+
+// from 設定基礎映像，本機沒有時自動從倉庫拉取
+func (b *Builder) from(state *buildState, inst *Instruction) error {
+	ref, err := processWord(inst.Raw, envLookup(nil))
+	if err != nil {
+		return err
+	}
+	if fields := strings.Fields(ref); len(fields) != 1 {
+		return fmt.Errorf("無效的基礎映像 %q (不支援 AS 與多階段建置)", inst.Raw)
+	}
+	if ref == "scratch" {
+		state.imageID = ""
+		state.config = v1.Config{}
+		return nil
+	}
+
+	platform := inst.Flags["platform"]
+	entry, err := image.LookupImage(ref)
+	if err != nil {
+		fmt.Fprintf(state.out, "Pulling %s...\n", ref)
+		pullReq := &types.PullRequest{Image: ref, Platform: platform, Auth: state.req.Auth[registryOf(ref)]}
+		if err := b.images.PullImage(pullReq, nil); err != nil {
+			return err
+		}
+		if entry, err = image.LookupImage(ref); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := image.ReadImageConfig(entry.ImageID)
+	if err != nil {
+		return fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	if err := image.CheckPlatform(cfg, platform); err != nil {
+		return err
+	}
+	state.setImage(b.images, entry.ImageID)
+	state.config = cfg.Config
+	return nil
+}
+
+// run 在以目前映像啟動的暫時容器中執行命令，並將檔案系統的變更存成新的 layer
+func (b *Builder) run(state *buildState, inst *Instruction) error {
+	if state.imageID == "" {
+		return fmt.Errorf("無法在空白映像 (scratch) 中執行命令")
+	}
+	argv := commandArgs(inst)
+	if len(argv) == 0 {
+		return fmt.Errorf("沒有指定命令")
+	}
+	key := state.cacheKey(inst, "")
+	if b.useCache(state, key) {
+		return nil
+	}
+
+	// 清除 Entrypoint，並沿用映像的 Env、WorkingDir 與 User
+	noEntrypoint := ""
+	runReq := &types.RunRequest{
+		ImageID:          state.imageID,
+		ContainerCommand: argv[0],
+		ContainerArgs:    argv[1:],
+		Entrypoint:       &noEntrypoint,
+		Env:              state.initEnv,
+	}
+	if state.init {
+		runReq.User, runReq.WorkingDir = "0", "/"
+	}
+	if err := container.ApplyImageConfig(runReq); err != nil {
+		return err
+	}
+
+	step, err := b.containers.RunBuildStep(runReq, state.out)
+	if step != nil {
+		defer func() {
+			if err := step.Remove(); err != nil {
+				logrus.Warnf("刪除建置容器 %s 失敗: %v", step.ID, err)
+			}
+		}()
+	}
+	if err != nil {
+		return fmt.Errorf("命令 '%s' 執行失敗: %w", strings.Join(argv, " "), err)
+	}
+
+	layer, err := os.CreateTemp(config.BuildDir, "layer-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(layer.Name())
+	err = step.Diff(layer, excludedPaths)
+	if closeErr := layer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return b.commit(state, inst, layer.Name(), key)
+}
+
+// commit 將目前的狀態存成新的中間映像，layer 為空字串時只修改 config
+// key 會記錄在新映像上，之後相同的步驟可以直接沿用
+func (b *Builder) commit(state *buildState, inst *Instruction, layer, key string) error {
+	entry, err := b.images.CommitImage(image.CommitOptions{
+		Parent:   state.imageID,
+		Layer:    layer,
+		Config:   state.config,
+		History:  v1.History{CreatedBy: inst.String(), Comment: "gocker build"},
+		CacheKey: key,
+	})
+	if err != nil {
+		return fmt.Errorf("建立中間映像失敗: %w", err)
+	}
+	state.setImage(b.images, entry.ImageID)
+	return nil
+}
+
+// setImage 切換目前的映像，並確保建置完成前它不會被刪除
+func (s *buildState) setImage(images *image.Manager, imageID string) {
+	s.setPinnedImage(imageID, images.PinImage(imageID))
+}
+
+// setPinnedImage 切換到已經以 PinImage 標記的映像，unpin 會在切換到下一個映像或建置結束時呼叫
+func (s *buildState) setPinnedImage(imageID string, unpin func()) {
+	s.unpin()
+	s.unpin = unpin
+	s.imageID = imageID
+}
+
+// commandArgs 回傳 RUN、CMD 與 ENTRYPOINT 的命令，shell form 會以 /bin/sh -c 執行
+func commandArgs(inst *Instruction) []string {
+	if inst.JSON {
+		return inst.Args
+	}
+	if inst.Raw == "" {
+		return nil
+	}
+	return []string{"/bin/sh", "-c", inst.Raw}
+}
+
+// registryOf 回傳映像參照所屬的倉庫位址，與 CLI 傳送憑證時使用的 key 相同
+func registryOf(ref string) string {
+	parsed, err := image.ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	return parsed.Context().RegistryStr()
+}
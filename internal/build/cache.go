@@ -0,0 +1,81 @@
+// internal/build/cache.go
+package build
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+)
+
+// cacheKey 計算步驟的快取 key：由目前的映像 ID (包含所有 layer 與 config)、指令內容
+// 以及 COPY/ADD 的檔案內容雜湊組成，任何一項不同都不會沿用快取
+func (s *buildState) cacheKey(inst *Instruction, content string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "parent=%s\n", s.imageID)
+	fmt.Fprintf(h, "instruction=%s\n", inst)
+	if content != "" {
+		fmt.Fprintf(h, "content=%s\n", content)
+	}
+	if s.init {
+		// 初始化命令的執行環境與 RUN 不同，不能共用快取
+		fmt.Fprintf(h, "init\n")
+		for _, kv := range s.initEnv {
+			fmt.Fprintf(h, "env=%s\n", kv)
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// useCache 尋找 key 對應的快取映像，找到時切換到該映像並回傳 true
+func (b *Builder) useCache(state *buildState, key string) bool {
+	if state.req.NoCache {
+		return false
+	}
+	imageID, unpin, ok := b.images.LookupBuildCache(state.imageID, key)
+	if !ok {
+		return false
+	}
+	fmt.Fprintln(state.out, " ---> Using cache")
+	state.setPinnedImage(imageID, unpin)
+	return true
+}
+
+// contentDigest 計算 layer tar 檔內容的雜湊，用於 COPY/ADD 的快取 key
+// 只包含路徑、類型、權限、擁有者、連結目標、xattr 與檔案內容，不包含修改時間，
+// 因此重新 checkout 或 touch 建置環境中的檔案不會讓快取失效
+func contentDigest(layerPath string) (string, error) {
+	f, err := os.Open(layerPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("讀取 layer 失敗: %w", err)
+		}
+		fmt.Fprintf(h, "%q %c %o %d:%d %q %d\n", header.Name, header.Typeflag, header.Mode,
+			header.Uid, header.Gid, header.Linkname, header.Size)
+
+		for _, key := range slices.Sorted(maps.Keys(header.PAXRecords)) {
+			if key != "mtime" && key != "atime" && key != "ctime" {
+				fmt.Fprintf(h, "%q=%q\n", key, header.PAXRecords[key])
+			}
+		}
+		if _, err := io.Copy(h, tr); err != nil {
+			return "", fmt.Errorf("讀取 layer 失敗: %w", err)
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
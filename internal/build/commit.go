@@ -0,0 +1,157 @@
+// internal/build/commit.go
+package build
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// commitExcludedPaths 為容器啟動時由 gocker 寫入、不屬於容器變更的檔案
+var commitExcludedPaths = append(slices.Clone(excludedPaths), config.BPFServiceExeContainer, config.BPFServiceOutputLog)
+
+// commitChanges 為 gocker commit --change 可以使用的指令
+var commitChanges = []string{"CMD", "ENTRYPOINT", "ENV", "EXPOSE", "LABEL", "USER", "WORKDIR"}
+
+// CommitContainer 將容器對映像所做的變更存成新的 layer (gocker commit)
+// 新映像以容器的映像為基礎，並沿用容器的命令、環境變數、工作目錄與使用者，
+// 再依序套用 req.Changes；req.Pause 為 true 時，讀取變更期間會以 cgroup freezer 暫停運行中的容器
+func (b *Builder) CommitContainer(req *types.CommitRequest) (string, error) {
+	changes := make([]*Instruction, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		inst, err := parseChange(change)
+		if err != nil {
+			return "", err
+		}
+		changes = append(changes, inst)
+	}
+
+	info, err := b.containers.GetInfo(req.Container)
+	if err != nil {
+		return "", err
+	}
+	imageID := info.ImageID
+	if imageID == "" {
+		// 舊版容器沒有記錄映像 ID，改用 name:tag 查詢
+		entry, err := image.LookupImage(info.Image)
+		if err != nil {
+			return "", fmt.Errorf("找不到容器 %s 的映像: %w", info.Name, err)
+		}
+		imageID = entry.ImageID
+	}
+	unpin := b.images.PinImage(imageID)
+	defer unpin()
+
+	cfg, err := image.ReadImageConfig(imageID)
+	if err != nil {
+		return "", fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	state := &buildState{config: containerConfig(cfg.Config, info)}
+	for _, inst := range changes {
+		if err := state.applyConfig(inst); err != nil {
+			return "", fmt.Errorf("套用變更 '%s' 失敗: %w", inst, err)
+		}
+	}
+
+	layer, err := b.containerDiff(info, req.Pause)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(layer)
+
+	entry, err := b.images.CommitImage(image.CommitOptions{
+		Parent:  imageID,
+		Layer:   layer,
+		Config:  state.config,
+		History: v1.History{CreatedBy: "gocker commit " + info.Name, Comment: req.Message, Author: req.Author},
+		Author:  req.Author,
+	})
+	if err != nil {
+		return "", fmt.Errorf("建立映像失敗: %w", err)
+	}
+	if req.Reference != "" {
+		if err := b.images.TagImage(entry.ImageID, req.Reference); err != nil {
+			return "", fmt.Errorf("為映像加上 tag %s 失敗: %w", req.Reference, err)
+		}
+	}
+	return entry.ImageID, nil
+}
+
+// containerDiff 將容器的變更寫成暫存的 layer tar 檔並回傳路徑
+func (b *Builder) containerDiff(info *types.ContainerInfo, pause bool) (string, error) {
+	if err := os.MkdirAll(config.BuildDir, 0755); err != nil {
+		return "", fmt.Errorf("建立建置目錄失敗: %w", err)
+	}
+	layer, err := os.CreateTemp(config.BuildDir, "commit-*.tar")
+	if err != nil {
+		return "", err
+	}
+
+	if pause && info.Status == types.Running {
+		resume, err := b.containers.Freeze(info.ID)
+		if err != nil {
+			layer.Close()
+			os.Remove(layer.Name())
+			return "", err
+		}
+		defer resume()
+	}
+
+	err = b.containers.WriteDiff(info, layer, commitExcludedPaths)
+	if closeErr := layer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(layer.Name())
+		return "", err
+	}
+	logrus.Infof("已讀取容器 %s 的變更", info.Name)
+	return layer.Name(), nil
+}
+
+// containerConfig 以映像的 config 為基礎，換成容器實際使用的命令、環境變數、工作目錄與使用者
+func containerConfig(base v1.Config, info *types.ContainerInfo) v1.Config {
+	cfg := base
+	argv := append([]string{info.Command}, info.Args...)
+	if !slices.Equal(argv, append(slices.Clone(base.Entrypoint), base.Cmd...)) {
+		// 容器以 gocker run 指定的命令執行，新映像直接以該命令作為 CMD
+		cfg.Entrypoint = nil
+		cfg.Cmd = argv
+	}
+	if len(info.Env) > 0 {
+		cfg.Env = info.Env
+	}
+	if info.WorkingDir != "" {
+		cfg.WorkingDir = info.WorkingDir
+	}
+	cfg.User = info.User
+	return cfg
+}
+
+// parseChange 解析 commit --change 的內容，格式與 Gockerfile 的指令相同 (例如 'CMD ["sh"]')，
+// 也接受 "CMD=..." 的寫法
+func parseChange(change string) (*Instruction, error) {
+	text := strings.TrimSpace(change)
+	if i := strings.IndexAny(text, " ="); i > 0 && text[i] == '=' {
+		if command := strings.ToUpper(text[:i]); slices.Contains(commitChanges, command) {
+			text = command + " " + text[i+1:]
+		}
+	}
+	command, _, _ := strings.Cut(text, " ")
+	if !slices.Contains(commitChanges, strings.ToUpper(command)) {
+		return nil, fmt.Errorf("無效的變更 %q: 只支援 %s", change, strings.Join(commitChanges, "、"))
+	}
+	inst, err := parseInstruction(1, text)
+	if err != nil {
+		return nil, fmt.Errorf("無效的變更 %q: %w", change, err)
+	}
+	return inst, nil
+}
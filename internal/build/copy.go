@@ -0,0 +1,298 @@
+// internal/build/copy.go
+package build
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocker/internal/config"
+	"gocker/internal/fsutil"
+	"gocker/internal/image"
+)
+
+// copy 執行 COPY 與 ADD，將建置環境中的檔案寫成新的 layer
+// ADD 另外支援從 URL 下載檔案，以及自動解開 tar 檔 (未壓縮、gzip 或 zstd)
+func (b *Builder) copy(state *buildState, inst *Instruction) error {
+	args := inst.Args
+	if !inst.JSON {
+		var err error
+		if args, err = splitWords(inst.Raw, envLookup(state.config.Env)); err != nil {
+			return err
+		}
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("至少需要一個來源與一個目的地")
+	}
+	sources, dest := args[:len(args)-1], args[len(args)-1]
+
+	uid, gid, err := parseChown(inst.Flags["chown"])
+	if err != nil {
+		return err
+	}
+
+	// 目的地為相對路徑時以 WORKDIR 為基準，以 "/" 結尾或有多個來源時視為目錄
+	destIsDir := strings.HasSuffix(dest, "/") || len(sources) > 1
+	if !path.IsAbs(dest) {
+		base := state.config.WorkingDir
+		if base == "" {
+			base = config.DefaultWorkingDir
+		}
+		dest = path.Join(base, dest)
+	}
+	dest = path.Clean(dest)
+
+	layer, err := os.CreateTemp(config.BuildDir, "layer-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(layer.Name())
+
+	c := &copier{
+		lw:         image.NewLayerWriter(layer),
+		contextDir: state.req.ContextDir,
+		add:        inst.Command == "ADD",
+		owner: func(h *tar.Header) {
+			h.Uid, h.Gid = uid, gid
+		},
+	}
+	for _, src := range sources {
+		if err = c.copySource(src, dest, destIsDir); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = c.lw.Close()
+	}
+	if closeErr := layer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// 先產生 layer 再以內容計算快取 key，來源檔案沒有變化時沿用快取
+	digest, err := contentDigest(layer.Name())
+	if err != nil {
+		return err
+	}
+	key := state.cacheKey(inst, digest)
+	if b.useCache(state, key) {
+		return nil
+	}
+	return b.commit(state, inst, layer.Name(), key)
+}
+
+// copier 將來源寫入 layer
+type copier struct {
+	lw         *image.LayerWriter
+	contextDir string
+	add        bool
+	owner      func(*tar.Header)
+}
+
+// copySource 處理單一來源，來源可以包含萬用字元
+func (c *copier) copySource(src, dest string, destIsDir bool) error {
+	if c.add && isURL(src) {
+		return c.download(src, dest, destIsDir)
+	}
+
+	// 來源一律限制在建置環境之內
+	pattern := filepath.Join(c.contextDir, filepath.Clean("/"+src))
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("無效的來源 %s: %w", src, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("在建置環境中找不到 %s", src)
+	}
+	if len(matches) > 1 {
+		destIsDir = true
+	}
+
+	for _, match := range matches {
+		rel, err := filepath.Rel(c.contextDir, match)
+		if err != nil {
+			return err
+		}
+		resolved, err := fsutil.SecureJoin(c.contextDir, rel)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(resolved)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case fi.IsDir():
+			// 目錄只複製其中的內容，不包含目錄本身
+			err = c.copyDir(resolved, dest)
+		case c.add && isArchive(resolved):
+			err = c.extractArchive(resolved, dest)
+		default:
+			target := dest
+			if destIsDir {
+				target = path.Join(dest, filepath.Base(match))
+			}
+			err = c.lw.AddEntry(resolved, target, fi, c.owner)
+		}
+		if err != nil {
+			return fmt.Errorf("複製 %s 失敗: %w", src, err)
+		}
+	}
+	return nil
+}
+
+// copyDir 將目錄的內容寫到 dest 之下
+func (c *copier) copyDir(dir, dest string) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return c.lw.AddEntry(p, path.Join(dest, filepath.ToSlash(rel)), fi, c.owner)
+	})
+}
+
+// extractArchive 將 tar 檔的內容解開到 dest 目錄之下 (ADD)
+func (c *copier) extractArchive(archive, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rc, err := image.Decompress(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fsutil.ValidateRelativePath(header.Name); err != nil {
+			return err
+		}
+		header.Name = strings.TrimPrefix(path.Join(dest, header.Name), "/")
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+		}
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = strings.TrimPrefix(path.Join(dest, header.Linkname), "/")
+		}
+		if err := c.lw.AddHeader(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// download 下載 URL 的內容到 dest (ADD)，檔案權限與 docker 相同為 0600
+func (c *copier) download(src, dest string, destIsDir bool) error {
+	u, err := url.Parse(src)
+	if err != nil {
+		return err
+	}
+	target := dest
+	if destIsDir {
+		base := path.Base(u.Path)
+		if base == "/" || base == "." {
+			return fmt.Errorf("無法從 %s 判斷檔名，請指定目的地的檔名", src)
+		}
+		target = path.Join(dest, base)
+	}
+
+	resp, err := http.Get(src)
+	if err != nil {
+		return fmt.Errorf("下載 %s 失敗: %w", src, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下載 %s 失敗: %s", src, resp.Status)
+	}
+
+	// tar header 需要事先知道大小，因此先下載到暫存檔
+	tmp, err := os.CreateTemp(config.BuildDir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		return fmt.Errorf("下載 %s 失敗: %w", src, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	modTime := time.Now()
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		modTime = t
+	}
+	header := &tar.Header{
+		Name:     strings.TrimPrefix(target, "/"),
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     size,
+		ModTime:  modTime,
+	}
+	c.owner(header)
+	return c.lw.AddHeader(header, tmp)
+}
+
+// parseChown 解析 --chown=uid[:gid]，只支援數字形式，未指定時為 root
+func parseChown(spec string) (int, int, error) {
+	if spec == "" {
+		return 0, 0, nil
+	}
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+	uid, err := strconv.Atoi(userPart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("--chown 目前只支援數字的 uid[:gid]: %s", spec)
+	}
+	gid := uid
+	if hasGroup {
+		if gid, err = strconv.Atoi(groupPart); err != nil {
+			return 0, 0, fmt.Errorf("--chown 目前只支援數字的 uid[:gid]: %s", spec)
+		}
+	}
+	return uid, gid, nil
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// isArchive 判斷檔案是否為可以解開的 tar 檔
+func isArchive(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	rc, err := image.Decompress(f)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	_, err = tar.NewReader(rc).Next()
+	return err == nil
+}
@@ -0,0 +1,139 @@
+// internal/build/import.go
+package build
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Import 以根檔案系統的 tar 檔 (可以是 gzip 或 zstd 壓縮) 或目錄建立只有一個 layer 的映像 (gocker import)
+// 新映像沒有任何執行設定，可以用 req.Changes 指定 CMD、ENV 等
+func (b *Builder) Import(req *types.ImportRequest) (string, error) {
+	state := &buildState{}
+	for _, change := range req.Changes {
+		inst, err := parseChange(change)
+		if err != nil {
+			return "", err
+		}
+		if err := state.applyConfig(inst); err != nil {
+			return "", fmt.Errorf("套用變更 '%s' 失敗: %w", inst, err)
+		}
+	}
+
+	fi, err := os.Stat(req.Source)
+	if err != nil {
+		return "", fmt.Errorf("讀取 %s 失敗: %w", req.Source, err)
+	}
+	if err := os.MkdirAll(config.BuildDir, 0755); err != nil {
+		return "", fmt.Errorf("建立建置目錄失敗: %w", err)
+	}
+	layer, err := os.CreateTemp(config.BuildDir, "import-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(layer.Name())
+
+	if fi.IsDir() {
+		err = writeDirLayer(layer, req.Source)
+	} else {
+		err = writeArchiveLayer(layer, req.Source)
+	}
+	if closeErr := layer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("讀取 %s 失敗: %w", req.Source, err)
+	}
+
+	entry, err := b.images.CommitImage(image.CommitOptions{
+		Layer:   layer.Name(),
+		Config:  state.config,
+		History: v1.History{CreatedBy: "gocker import " + filepath.Base(req.Source), Comment: req.Message},
+	})
+	if err != nil {
+		return "", fmt.Errorf("建立映像失敗: %w", err)
+	}
+	if req.Reference != "" {
+		if err := b.images.TagImage(entry.ImageID, req.Reference); err != nil {
+			return "", fmt.Errorf("為映像加上 tag %s 失敗: %w", req.Reference, err)
+		}
+	}
+	return entry.ImageID, nil
+}
+
+// writeDirLayer 將目錄的內容寫成 layer，目錄本身對應到映像的根目錄
+func writeDirLayer(w io.Writer, dir string) error {
+	lw := image.NewLayerWriter(w)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		return lw.AddEntry(p, filepath.ToSlash(rel), fi, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return lw.Close()
+}
+
+// writeArchiveLayer 將 tar 檔解壓縮並整理路徑後寫成 layer
+// 路徑開頭的 "./" 或 "/" 會被移除，".." 不會超出映像的根目錄
+func writeArchiveLayer(w io.Writer, archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rc, err := image.Decompress(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	lw := image.NewLayerWriter(w)
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := cleanArchivePath(header.Name)
+		if name == "" {
+			continue
+		}
+		header.Name = name
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+		}
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = cleanArchivePath(header.Linkname)
+		}
+		if err := lw.AddHeader(header, tr); err != nil {
+			return err
+		}
+	}
+	return lw.Close()
+}
+
+// cleanArchivePath 將 tar 中的路徑轉換為相對於根目錄的形式，根目錄本身回傳空字串
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
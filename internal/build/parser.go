@@ -0,0 +1,177 @@
+// internal/build/parser.go
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Instruction 為 Gockerfile 中的一個指令
+type Instruction struct {
+	Line    int               // 指令開始的行號
+	Command string            // 大寫的指令名稱，例如 RUN
+	Flags   map[string]string // 指令的旗標，例如 COPY --chown=1000:1000
+	Raw     string            // 去除旗標後的參數原文，變數會在建置時才展開
+	JSON    bool              // 參數是否以 JSON 陣列 (exec form) 撰寫
+	Args    []string          // JSON 形式的參數
+}
+
+// String 回傳建置輸出中顯示的指令內容
+func (i *Instruction) String() string {
+	var b strings.Builder
+	b.WriteString(i.Command)
+	for _, key := range slices.Sorted(maps.Keys(i.Flags)) {
+		fmt.Fprintf(&b, " --%s=%s", key, i.Flags[key])
+	}
+	if i.Raw != "" {
+		b.WriteString(" " + i.Raw)
+	}
+	return b.String()
+}
+
+// allowedFlags 為各指令支援的旗標
+var allowedFlags = map[string][]string{
+	"FROM": {"platform"},
+	"COPY": {"chown"},
+	"ADD":  {"chown"},
+}
+
+// jsonForms 為可以使用 JSON 陣列撰寫的指令
+var jsonForms = map[string]bool{
+	"RUN": true, "CMD": true, "ENTRYPOINT": true, "COPY": true, "ADD": true,
+}
+
+// ParseFile 讀取並解析 Gockerfile
+func ParseFile(path string) ([]*Instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("開啟 %s 失敗: %w", path, err)
+	}
+	defer f.Close()
+
+	instructions, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return instructions, nil
+}
+
+// Parse 解析 Gockerfile 的內容
+// 支援 "#" 開頭的註解與以 "\" 結尾的行接續，第一個指令必須是 FROM，且只能有一個 FROM
+func Parse(r io.Reader) ([]*Instruction, error) {
+	var (
+		instructions []*Instruction
+		current      strings.Builder
+		startLine    int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if current.Len() == 0 {
+			startLine = lineNo
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\"))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(line)
+
+		inst, err := parseInstruction(startLine, current.String())
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, inst)
+		current.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current.Len() > 0 {
+		inst, err := parseInstruction(startLine, current.String())
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, inst)
+	}
+
+	if len(instructions) == 0 {
+		return nil, fmt.Errorf("沒有任何指令")
+	}
+	if instructions[0].Command != "FROM" {
+		return nil, fmt.Errorf("第 %d 行: 第一個指令必須是 FROM", instructions[0].Line)
+	}
+	for _, inst := range instructions[1:] {
+		if inst.Command == "FROM" {
+			return nil, fmt.Errorf("第 %d 行: 不支援多階段建置 (只能有一個 FROM)", inst.Line)
+		}
+	}
+	return instructions, nil
+}
+
+// parseInstruction 解析單一指令 (已合併行接續)
+func parseInstruction(line int, text string) (*Instruction, error) {
+	command, rest, _ := strings.Cut(strings.TrimSpace(text), " ")
+	inst := &Instruction{
+		Line:    line,
+		Command: strings.ToUpper(command),
+		Flags:   map[string]string{},
+	}
+	rest = strings.TrimSpace(rest)
+
+	switch inst.Command {
+	case "FROM", "RUN", "CMD", "ENTRYPOINT", "COPY", "ADD", "ENV", "WORKDIR", "USER", "EXPOSE", "LABEL":
+	default:
+		return nil, fmt.Errorf("第 %d 行: 不支援的指令 %s", line, command)
+	}
+
+	// 1. 旗標 (--name=value) 只能出現在參數的最前面
+	for strings.HasPrefix(rest, "--") {
+		flag, remain, _ := strings.Cut(rest, " ")
+		key, value, ok := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if !ok || !slices.Contains(allowedFlags[inst.Command], key) {
+			return nil, fmt.Errorf("第 %d 行: %s 不支援旗標 %s", line, inst.Command, flag)
+		}
+		inst.Flags[key] = value
+		rest = strings.TrimSpace(remain)
+	}
+	inst.Raw = rest
+
+	// 2. exec form
+	if jsonForms[inst.Command] && strings.HasPrefix(rest, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			inst.JSON = true
+			inst.Args = args
+		}
+	}
+
+	// 3. 檢查參數的數量
+	switch inst.Command {
+	case "CMD", "ENTRYPOINT":
+		// 可以為空，表示清除設定
+	case "COPY", "ADD":
+		if inst.JSON && len(inst.Args) < 2 || !inst.JSON && len(strings.Fields(rest)) < 2 {
+			return nil, fmt.Errorf("第 %d 行: %s 至少需要一個來源與一個目的地", line, inst.Command)
+		}
+	default:
+		if rest == "" || inst.JSON && len(inst.Args) == 0 {
+			return nil, fmt.Errorf("第 %d 行: %s 缺少參數", line, inst.Command)
+		}
+	}
+	return inst, nil
+}
@@ -0,0 +1,155 @@
+// internal/build/shell.go
+package build
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// lookupFunc 回傳變數的值以及變數是否存在
+type lookupFunc func(name string) (string, bool)
+
+// splitWords 依照 shell 的規則將參數切成多個字，並展開 $VAR 與 ${VAR}
+// 支援單引號 (不展開)、雙引號與反斜線跳脫，用於 ENV、LABEL、COPY 等指令
+func splitWords(s string, lookup lookupFunc) ([]string, error) {
+	return lex(s, lookup, true)
+}
+
+// processWord 與 splitWords 相同，但不切割空白，用於 WORKDIR 與 USER 等只有一個值的指令
+func processWord(s string, lookup lookupFunc) (string, error) {
+	words, err := lex(s, lookup, false)
+	if err != nil || len(words) == 0 {
+		return "", err
+	}
+	return words[0], nil
+}
+
+func lex(s string, lookup lookupFunc, split bool) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		runes  = []rune(s)
+		quote  rune
+		flush  = func() {
+			if inWord {
+				words = append(words, word.String())
+			}
+			word.Reset()
+			inWord = false
+		}
+	)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			// 雙引號中只有 $ " \ 需要跳脫，其他反斜線保留原樣
+			inWord = true
+			if i+1 >= len(runes) || quote == '"' && !strings.ContainsRune(`$"\`, runes[i+1]) {
+				word.WriteRune(r)
+				continue
+			}
+			i++
+			word.WriteRune(runes[i])
+		case r == '$':
+			value, n, err := expandVariable(runes[i+1:], lookup)
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(value)
+			inWord = true
+			i += n
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case split && unicode.IsSpace(r):
+			flush()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("引號沒有成對: %s", s)
+	}
+	flush()
+	return words, nil
+}
+
+// expandVariable 展開 "$" 之後的變數，回傳展開的值與使用掉的字元數
+// 支援 $VAR、${VAR}、${VAR:-default} 與 ${VAR:+alternative}
+func expandVariable(runes []rune, lookup lookupFunc) (string, int, error) {
+	if len(runes) == 0 {
+		return "$", 0, nil
+	}
+
+	if runes[0] != '{' {
+		n := 0
+		for n < len(runes) && (runes[n] == '_' || unicode.IsLetter(runes[n]) || unicode.IsDigit(runes[n])) {
+			n++
+		}
+		if n == 0 {
+			return "$", 0, nil
+		}
+		value, _ := lookup(string(runes[:n]))
+		return value, n, nil
+	}
+
+	end := -1
+	for i, r := range runes {
+		if r == '}' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", 0, fmt.Errorf("變數缺少結尾的 '}': ${%s", string(runes[1:]))
+	}
+	expr := string(runes[1:end])
+
+	name, modifier, hasModifier := strings.Cut(expr, ":")
+	value, ok := lookup(name)
+	if !hasModifier {
+		return value, end + 1, nil
+	}
+	switch {
+	case strings.HasPrefix(modifier, "-"):
+		if !ok || value == "" {
+			value = strings.TrimPrefix(modifier, "-")
+		}
+	case strings.HasPrefix(modifier, "+"):
+		if ok && value != "" {
+			value = strings.TrimPrefix(modifier, "+")
+		}
+	default:
+		return "", 0, fmt.Errorf("不支援的變數語法: ${%s}", expr)
+	}
+	return value, end + 1, nil
+}
+
+// envLookup 回傳在 KEY=VALUE 形式的環境變數中尋找變數的 lookupFunc
+func envLookup(env []string) lookupFunc {
+	return func(name string) (string, bool) {
+		for i := len(env) - 1; i >= 0; i-- {
+			key, value, _ := strings.Cut(env[i], "=")
+			if key == name {
+				return value, true
+			}
+		}
+		return "", false
+	}
+}
@@ -8,6 +8,9 @@ const (
 	ContainersDir        = GockerStorage + "/containers"
 	ContainerStoragePath = "/var/lib/gocker/containers"
 	ManifestPath         = ImagesDir + "/manifest.json"
+	LayersDir            = ImagesDir + "/layers"
+	VolumesDir           = GockerStorage + "/volumes"
+	BuildDir             = GockerStorage + "/build"
 
 	// 網路設定
 	BridgeName            = "gocker0"
@@ -28,9 +31,9 @@ const (
 	CgroupRoot = "/sys/fs/cgroup"
 	CgroupName = "gocker"
 
-	// 資源限制 (可在未來改為可配置)
-	DefaultCPULimit    = 1                 // 1 core CPU
-	DefaultMemoryLimit = 200 * 1024 * 1024 // 100MB Memory
+	// 資源限制 (記憶體的預設值可以在 daemon.json 的 default-memory 中修改)
+	DefaultCPUMillis   = 1000              // 1 core CPU
+	DefaultMemoryLimit = 200 * 1024 * 1024 // 200MB Memory
 	DefaultPidsLimit   = 100               // 100 processes
 	InvalidLimit       = -1
 
@@ -39,6 +42,8 @@ const (
 
 	// 執行檔相關
 	DefaultCommand         = "/bin/sh"
+	DefaultPathEnv         = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	DefaultWorkingDir      = "/"
 	BPFServiceExeHost      = "ebpf-sched-monitor"
 	BPFServiceExeContainer = "/usr/bin/ebpf-sched-monitor"
 	BPFServiceOutputLog    = "/var/log/ebpf-sched-monitor.log"
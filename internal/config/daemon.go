@@ -0,0 +1,53 @@
+// internal/config/daemon.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// DaemonConfigPath 為 daemon 設定檔的預設路徑
+	DaemonConfigPath = "/etc/gocker/daemon.json"
+	// DefaultCertsDir 存放各倉庫的 CA 與用戶端憑證，結構為 <certs-dir>/<registry>/*.crt
+	DefaultCertsDir = "/etc/gocker/certs.d"
+)
+
+// DaemonConfig 為 daemon 設定檔 (daemon.json) 的內容，欄位名稱與 dockerd 相同
+type DaemonConfig struct {
+	// RegistryMirrors 為 Docker Hub 的鏡像，拉取時依序嘗試，全部失敗時才回到 Docker Hub
+	RegistryMirrors []string `json:"registry-mirrors,omitempty"`
+	// InsecureRegistries 允許使用 HTTP 或不驗證憑證的倉庫，可以是 host[:port] 或 CIDR
+	InsecureRegistries []string `json:"insecure-registries,omitempty"`
+	// CertsDir 為各倉庫 CA 憑證的目錄，預設為 /etc/gocker/certs.d
+	CertsDir string `json:"certs-dir,omitempty"`
+	// StorageDriver 為新容器與建置步驟使用的 storage driver (overlay 或 vfs)，預設為 overlay
+	StorageDriver string `json:"storage-driver,omitempty"`
+	// DefaultMemory 為沒有指定 --memory 的容器的記憶體上限 (例如 "512m"，"0" 表示不限制)，預設為 200m
+	DefaultMemory string `json:"default-memory,omitempty"`
+}
+
+// LoadDaemonConfig 讀取 daemon 設定檔，檔案不存在時回傳預設值
+func LoadDaemonConfig(path string) (*DaemonConfig, error) {
+	cfg := &DaemonConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			cfg.applyDefaults()
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("讀取設定檔 %s 失敗: %w", path, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析設定檔 %s 失敗: %w", path, err)
+	}
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+func (c *DaemonConfig) applyDefaults() {
+	if c.CertsDir == "" {
+		c.CertsDir = DefaultCertsDir
+	}
+}
@@ -1,10 +1,13 @@
 package container
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"gocker/internal/config"
 	"gocker/internal/types"
@@ -41,12 +44,9 @@ func (m *Manager) SetupCgroup(limits types.ContainerLimits, pid int, containerID
 	}
 
 	// 2. 啟用必要的 cgroup 控制器
-	controllers := "+cpu +memory +pids"
-	controlFilePath := filepath.Join(parentCgroupPath, "cgroup.subtree_control")
-	log.Infof("正在啟用 cgroup 控制器: %s", controllers)
-	if err := os.WriteFile(controlFilePath, []byte(controllers), 0644); err != nil {
-		log.Warnf("啟用 cgroup 控制器可能失敗 (可忽略): %v", err)
-	}
+	// cpuset 與 io 預設不一定在根 cgroup 啟用，必須先啟用，父 cgroup 才能再往下啟用
+	enableControllers(config.CgroupRoot, []string{"cpuset", "io"}, log)
+	enableControllers(parentCgroupPath, cgroupControllers, log)
 
 	// 3. 為每個容器建立一個獨立的 cgroup 路徑
 	containerCgroupPath := filepath.Join(parentCgroupPath, containerID)
@@ -72,12 +72,33 @@ func (m *Manager) SetupCgroup(limits types.ContainerLimits, pid int, containerID
 		_ = m.CleanupCgroup(containerCgroupPath)
 		return "", fmt.Errorf("將 PID 加入 cgroup.procs 失敗: %w", err)
 	}
+	if limits.OOMKillDisable != nil && *limits.OOMKillDisable {
+		if err := setOOMScoreAdj(containerCgroupPath, true); err != nil {
+			_ = m.CleanupCgroup(containerCgroupPath)
+			return "", err
+		}
+	}
 
 	log.Info("Cgroup 設定成功")
 	// 6. 回傳建立的 cgroup 路徑，以便後續清理
 	return containerCgroupPath, nil
 }
 
+// cgroupControllers 為容器的 cgroup 需要的控制器
+var cgroupControllers = []string{"cpu", "cpuset", "io", "memory", "pids"}
+
+// enableControllers 在 cgroupPath 的 cgroup.subtree_control 中逐一啟用控制器
+// 逐一寫入以免其中一個控制器不可用時，其他控制器也無法啟用
+func enableControllers(cgroupPath string, controllers []string, log *logrus.Entry) {
+	controlFilePath := filepath.Join(cgroupPath, "cgroup.subtree_control")
+	log.Infof("正在啟用 cgroup 控制器: %v", controllers)
+	for _, controller := range controllers {
+		if err := os.WriteFile(controlFilePath, []byte("+"+controller), 0644); err != nil {
+			log.Warnf("啟用 cgroup 控制器 %s 可能失敗 (可忽略): %v", controller, err)
+		}
+	}
+}
+
 // CleanupCgroup 負責在容器停止後，清理其對應的 cgroup 目錄
 func (m *Manager) CleanupCgroup(cgroupPath string) error {
 	log := logrus.WithField("cgroupPath", cgroupPath)
@@ -106,15 +127,47 @@ func (m *Manager) AdjustResourceLimits(identifier string, limits types.Container
 
 	// Keep original limits if new limits are invalid
 	originalLimits := info.Limits
-	if limits.CPULimit == config.InvalidLimit {
-		limits.CPULimit = originalLimits.CPULimit
+	if limits.CPUMillis == config.InvalidLimit {
+		limits.CPUMillis = originalLimits.CPUMillis
 	}
 	if limits.MemoryLimit == config.InvalidLimit {
 		limits.MemoryLimit = originalLimits.MemoryLimit
 	}
+	if limits.MemorySwap == 0 {
+		limits.MemorySwap = originalLimits.MemorySwap
+	}
+	if limits.MemoryReservation == config.InvalidLimit {
+		limits.MemoryReservation = originalLimits.MemoryReservation
+	}
+	if limits.MemoryHigh == config.InvalidLimit {
+		limits.MemoryHigh = originalLimits.MemoryHigh
+	}
+	if limits.BlkioWeight == config.InvalidLimit {
+		limits.BlkioWeight = originalLimits.BlkioWeight
+	}
+	limits.DeviceReadBps = mergeThrottleDevices(originalLimits.DeviceReadBps, limits.DeviceReadBps)
+	limits.DeviceWriteBps = mergeThrottleDevices(originalLimits.DeviceWriteBps, limits.DeviceWriteBps)
+	limits.DeviceReadIOps = mergeThrottleDevices(originalLimits.DeviceReadIOps, limits.DeviceReadIOps)
+	limits.DeviceWriteIOps = mergeThrottleDevices(originalLimits.DeviceWriteIOps, limits.DeviceWriteIOps)
+	oomKillDisableChanged := limits.OOMKillDisable != nil
+	if !oomKillDisableChanged {
+		limits.OOMKillDisable = originalLimits.OOMKillDisable
+	}
+	if limits.OOMKillGroup == nil {
+		limits.OOMKillGroup = originalLimits.OOMKillGroup
+	}
 	if limits.PidsLimit == config.InvalidLimit {
 		limits.PidsLimit = originalLimits.PidsLimit
 	}
+	if limits.CPUWeight == config.InvalidLimit {
+		limits.CPUWeight = originalLimits.CPUWeight
+	}
+	if limits.CpusetCpus == nil {
+		limits.CpusetCpus = originalLimits.CpusetCpus
+	}
+	if limits.CpusetMems == nil {
+		limits.CpusetMems = originalLimits.CpusetMems
+	}
 
 	containerCgroupPath, mode, err := cgroupPath(info)
 	if err != nil {
@@ -132,8 +185,18 @@ func (m *Manager) AdjustResourceLimits(identifier string, limits types.Container
     if err := m.setResourceLimits(containerCgroupPath, limits); err != nil {
         return fmt.Errorf("調整資源限制失敗: %w", err)
     }
+	if oomKillDisableChanged {
+		if err := setOOMScoreAdj(containerCgroupPath, *limits.OOMKillDisable); err != nil {
+			return fmt.Errorf("調整資源限制失敗: %w", err)
+		}
+	}
 
 	log.Info("成功調整容器的資源限制")
+	// 速率為 0 的裝置已經在 io.max 中解除限制，不需要再保存
+	limits.DeviceReadBps = limitedDevices(limits.DeviceReadBps)
+	limits.DeviceWriteBps = limitedDevices(limits.DeviceWriteBps)
+	limits.DeviceReadIOps = limitedDevices(limits.DeviceReadIOps)
+	limits.DeviceWriteIOps = limitedDevices(limits.DeviceWriteIOps)
 	// 更新 config.json 中的限制資訊
 	info.Limits = limits
 	containerDir := filepath.Join(config.ContainerStoragePath, info.ID)
@@ -146,27 +209,58 @@ func (m *Manager) AdjustResourceLimits(identifier string, limits types.Container
 
 // setResourceLimits 用來寫入 cgroup 限制檔案
 func (m *Manager) setResourceLimits(cgroupPath string, limits types.ContainerLimits) error {
-	// 設定 CPU 限制 (cpu.max)
-	if limits.CPULimit > 0 {
-		// CPULimit: 0.5 -> 50000 100000 (50% quota in a 100ms period)
-		cpuQuota := limits.CPULimit * 100000
-		cpuPeriod := 100000
-		cpuLimitString := fmt.Sprintf("%d %d", cpuQuota, cpuPeriod)
-		cpuMaxPath := filepath.Join(cgroupPath, "cpu.max")
-		if err := os.WriteFile(cpuMaxPath, []byte(cpuLimitString), 0644); err != nil {
-			return fmt.Errorf("寫入 cpu.max 失敗: %w", err)
+	// 設定 CPU 限制 (cpu.max)，0 表示不限制，寫入 max 讓調整時也能解除限制
+	cpuPeriod := 100000
+	cpuLimitString := fmt.Sprintf("max %d", cpuPeriod)
+	if limits.CPUMillis > 0 {
+		// CPUMillis: 500 millicores -> 50000 100000 (50% quota in a 100ms period)
+		if limits.CPUMillis < 10 {
+			return fmt.Errorf("CPU 限制 %d millicore 太小，至少為 10 (0.01 個 CPU)", limits.CPUMillis)
 		}
+		cpuQuota := limits.CPUMillis * int64(cpuPeriod) / 1000
+		cpuLimitString = fmt.Sprintf("%d %d", cpuQuota, cpuPeriod)
+	}
+	cpuMaxPath := filepath.Join(cgroupPath, "cpu.max")
+	if err := os.WriteFile(cpuMaxPath, []byte(cpuLimitString), 0644); err != nil {
+		return fmt.Errorf("寫入 cpu.max 失敗: %w", err)
 	}
 
-	// 設定記憶體限制 (memory.max)
-	if limits.MemoryLimit > 0 {
-		memMaxPath := filepath.Join(cgroupPath, "memory.max")
-		memLimitString := strconv.Itoa(limits.MemoryLimit)
-		if err := os.WriteFile(memMaxPath, []byte(memLimitString), 0644); err != nil {
-			return fmt.Errorf("寫入 memory.max 失敗: %w", err)
+	// 設定 CPU 權重 (cpu.weight)
+	if limits.CPUWeight > 0 {
+		if limits.CPUWeight > 10000 {
+			return fmt.Errorf("CPU 權重 %d 超出範圍 (1-10000)", limits.CPUWeight)
+		}
+		cpuWeightPath := filepath.Join(cgroupPath, "cpu.weight")
+		if err := os.WriteFile(cpuWeightPath, []byte(strconv.Itoa(limits.CPUWeight)), 0644); err != nil {
+			return fmt.Errorf("寫入 cpu.weight 失敗: %w", err)
 		}
 	}
 
+	// 設定可以使用的 CPU 與記憶體節點 (cpuset.cpus、cpuset.mems)
+	// 寫入空值會清除限制，改為沿用父 cgroup 的設定
+	if limits.CpusetCpus != nil {
+		cpusetCpusPath := filepath.Join(cgroupPath, "cpuset.cpus")
+		if err := os.WriteFile(cpusetCpusPath, []byte(*limits.CpusetCpus+"\n"), 0644); err != nil {
+			return fmt.Errorf("寫入 cpuset.cpus 失敗: %w", err)
+		}
+	}
+	if limits.CpusetMems != nil {
+		cpusetMemsPath := filepath.Join(cgroupPath, "cpuset.mems")
+		if err := os.WriteFile(cpusetMemsPath, []byte(*limits.CpusetMems+"\n"), 0644); err != nil {
+			return fmt.Errorf("寫入 cpuset.mems 失敗: %w", err)
+		}
+	}
+
+	// 設定記憶體限制 (memory.max、memory.swap.max、memory.low、memory.high、memory.oom.group)
+	if err := setMemoryLimits(cgroupPath, limits); err != nil {
+		return err
+	}
+
+	// 設定區塊 IO 的權重與速率上限 (io.weight、io.max)
+	if err := setIOLimits(cgroupPath, limits); err != nil {
+		return err
+	}
+
 	// 設定 PID 限制 (pids.max)
 	if limits.PidsLimit > 0 {
 		pidsMaxPath := filepath.Join(cgroupPath, "pids.max")
@@ -178,3 +272,188 @@ func (m *Manager) setResourceLimits(cgroupPath string, limits types.ContainerLim
 
 	return nil
 }
+
+// setMemoryLimits 寫入記憶體相關的 cgroup 檔案，值為 0 的限制會寫入預設值，因此調整時也能解除限制
+func setMemoryLimits(cgroupPath string, limits types.ContainerLimits) error {
+	if limits.MemoryLimit > 0 {
+		if limits.MemoryReservation > limits.MemoryLimit {
+			return fmt.Errorf("記憶體保留量 %d 不能大於記憶體上限 %d", limits.MemoryReservation, limits.MemoryLimit)
+		}
+		if limits.MemoryHigh > limits.MemoryLimit {
+			return fmt.Errorf("memory.high %d 不能大於記憶體上限 %d", limits.MemoryHigh, limits.MemoryLimit)
+		}
+	}
+	if limits.MemoryReservation < 0 || limits.MemoryHigh < 0 {
+		return fmt.Errorf("記憶體保留量與 memory.high 不能是負數")
+	}
+
+	// 與 docker 相同：沒有指定 swap 時 swap 與記憶體上限一樣大，指定的值為記憶體加上 swap 的總量
+	swapMax := "max"
+	switch {
+	case limits.MemorySwap == 0 || limits.MemorySwap == -1:
+		if limits.MemorySwap == 0 && limits.MemoryLimit > 0 {
+			swapMax = strconv.FormatInt(limits.MemoryLimit, 10)
+		}
+	case limits.MemorySwap < -1:
+		return fmt.Errorf("無效的 swap 上限 %d", limits.MemorySwap)
+	case limits.MemoryLimit <= 0:
+		return fmt.Errorf("設定 swap 上限時必須同時設定記憶體上限")
+	case limits.MemorySwap < limits.MemoryLimit:
+		return fmt.Errorf("記憶體加上 swap 的上限 %d 不能小於記憶體上限 %d", limits.MemorySwap, limits.MemoryLimit)
+	default:
+		swapMax = strconv.FormatInt(limits.MemorySwap-limits.MemoryLimit, 10)
+	}
+
+	// oom_score_adj 為 -1000 的行程不會被 OOM killer 選中，沒有記憶體上限時主機記憶體不足就只能殺死主機上的其他行程
+	oomKillDisable := limits.OOMKillDisable != nil && *limits.OOMKillDisable
+	if oomKillDisable && limits.MemoryLimit <= 0 {
+		return fmt.Errorf("--oom-kill-disable 必須與記憶體上限一起使用")
+	}
+	oomGroup := "0"
+	if limits.OOMKillGroup != nil && *limits.OOMKillGroup {
+		if oomKillDisable {
+			return fmt.Errorf("--oom-kill-group 不能與 --oom-kill-disable 一起使用")
+		}
+		oomGroup = "1"
+	}
+
+	files := []struct {
+		name  string
+		value string
+		// optional 為 true 時 (沒有指定該限制)，核心不支援該檔案 (例如沒有啟用 swap accounting) 就略過
+		optional bool
+	}{
+		{"memory.max", memoryValue(limits.MemoryLimit, "max"), limits.MemoryLimit == 0},
+		{"memory.swap.max", swapMax, limits.MemorySwap == 0},
+		{"memory.low", memoryValue(limits.MemoryReservation, "0"), limits.MemoryReservation == 0},
+		{"memory.high", memoryValue(limits.MemoryHigh, "max"), limits.MemoryHigh == 0},
+	}
+	for _, file := range files {
+		err := os.WriteFile(filepath.Join(cgroupPath, file.name), []byte(file.value), 0644)
+		if err != nil && !(file.optional && errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("寫入 %s 失敗: %w", file.name, err)
+		}
+	}
+	// 只有明確指定時才寫入 memory.oom.group，否則維持核心的預設值
+	if limits.OOMKillGroup != nil {
+		if err := os.WriteFile(filepath.Join(cgroupPath, "memory.oom.group"), []byte(oomGroup), 0644); err != nil {
+			return fmt.Errorf("寫入 memory.oom.group 失敗: %w", err)
+		}
+	}
+	return nil
+}
+
+// memoryValue 將記憶體大小轉換為 cgroup 檔案的內容，0 表示沒有設定，寫入 unset
+func memoryValue(size int64, unset string) string {
+	if size <= 0 {
+		return unset
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// setOOMScoreAdj 設定 cgroup 中所有行程的 oom_score_adj
+// cgroup v2 沒有 memory.oom_control，因此以 -1000 讓 OOM killer 略過容器的行程來達成 --oom-kill-disable，
+// 子行程會繼承這個值；disable 為 false 時恢復為 0
+// 注意 -1000 對整台主機的 OOM killer 同樣有效，主機記憶體不足時會改為殺死主機上的其他行程，
+// 因此 setMemoryLimits 要求同時設定記憶體上限，讓容器在自己的 cgroup 中就先遇到上限
+func setOOMScoreAdj(cgroupPath string, disable bool) error {
+	score := "0"
+	if disable {
+		score = "-1000"
+	}
+	data, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("讀取 cgroup.procs 失敗: %w", err)
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		err := os.WriteFile(filepath.Join("/proc", pid, "oom_score_adj"), []byte(score), 0644)
+		// 行程可能在讀取 cgroup.procs 之後就結束了
+		if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("設定行程 %s 的 oom_score_adj 失敗: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// setIOLimits 寫入 io.weight 與 io.max，io.max 中每個裝置一行，速率為 0 的項目寫入 max 以解除限制
+func setIOLimits(cgroupPath string, limits types.ContainerLimits) error {
+	// 權重為 0 時寫入核心的預設值 100，讓調整時也能恢復預設；核心不支援 io.weight 時只有指定權重才會失敗
+	weight := 100
+	if limits.BlkioWeight > 0 {
+		if limits.BlkioWeight < 10 || limits.BlkioWeight > 1000 {
+			return fmt.Errorf("區塊 IO 權重 %d 超出範圍 (10-1000)", limits.BlkioWeight)
+		}
+		// 與 runc 相同，將 blkio 的 10-1000 換算為 io.weight 的 1-10000
+		weight = 1 + (limits.BlkioWeight-10)*9999/990
+	}
+	ioWeightPath := filepath.Join(cgroupPath, "io.weight")
+	if _, err := os.Stat(ioWeightPath); limits.BlkioWeight > 0 || err == nil {
+		if err := os.WriteFile(ioWeightPath, []byte(fmt.Sprintf("default %d", weight)), 0644); err != nil {
+			return fmt.Errorf("寫入 io.weight 失敗: %w", err)
+		}
+	}
+
+	type deviceKey struct{ major, minor int64 }
+	var order []deviceKey
+	settings := map[deviceKey][]string{}
+	for _, group := range []struct {
+		key     string
+		devices []types.ThrottleDevice
+	}{
+		{"rbps", limits.DeviceReadBps},
+		{"wbps", limits.DeviceWriteBps},
+		{"riops", limits.DeviceReadIOps},
+		{"wiops", limits.DeviceWriteIOps},
+	} {
+		for _, dev := range group.devices {
+			key := deviceKey{dev.Major, dev.Minor}
+			if _, ok := settings[key]; !ok {
+				order = append(order, key)
+			}
+			rate := "max"
+			if dev.Rate > 0 {
+				rate = strconv.FormatUint(dev.Rate, 10)
+			}
+			settings[key] = append(settings[key], group.key+"="+rate)
+		}
+	}
+	// io.max 每次寫入只能設定一個裝置
+	ioMaxPath := filepath.Join(cgroupPath, "io.max")
+	for _, key := range order {
+		line := fmt.Sprintf("%d:%d %s", key.major, key.minor, strings.Join(settings[key], " "))
+		if err := os.WriteFile(ioMaxPath, []byte(line), 0644); err != nil {
+			return fmt.Errorf("寫入 io.max (%s) 失敗: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// mergeThrottleDevices 以 updates 中的裝置取代 original 中相同裝置的設定，其餘裝置維持原本的設定
+func mergeThrottleDevices(original, updates []types.ThrottleDevice) []types.ThrottleDevice {
+	merged := append([]types.ThrottleDevice{}, original...)
+	for _, update := range updates {
+		replaced := false
+		for i := range merged {
+			if merged[i].Major == update.Major && merged[i].Minor == update.Minor {
+				merged[i] = update
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, update)
+		}
+	}
+	return merged
+}
+
+// limitedDevices 回傳有設定速率上限的裝置
+func limitedDevices(devices []types.ThrottleDevice) []types.ThrottleDevice {
+	var limited []types.ThrottleDevice
+	for _, dev := range devices {
+		if dev.Rate > 0 {
+			limited = append(limited, dev)
+		}
+	}
+	return limited
+}
@@ -0,0 +1,77 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocker/internal/types"
+)
+
+// readCgroupFile 讀取 setResourceLimits 寫入暫存目錄的 cgroup 檔案
+func readCgroupFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("讀取 %s 失敗: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestSetResourceLimitsCPU(t *testing.T) {
+	m := &Manager{}
+	tests := []struct {
+		millis int64
+		want   string
+	}{
+		{500, "50000 100000"},
+		{1500, "150000 100000"},
+		// adjust --cpus 0 必須解除原本的限制，而不是保留舊的 quota
+		{0, "max 100000"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		if err := m.setResourceLimits(dir, types.ContainerLimits{CPUMillis: tt.millis}); err != nil {
+			t.Fatalf("CPUMillis=%d: %v", tt.millis, err)
+		}
+		if got := readCgroupFile(t, dir, "cpu.max"); got != tt.want {
+			t.Errorf("CPUMillis=%d: cpu.max = %q, want %q", tt.millis, got, tt.want)
+		}
+	}
+	if err := m.setResourceLimits(dir, types.ContainerLimits{CPUMillis: 5}); err == nil {
+		t.Errorf("小於 10 millicore 的限制應該回傳錯誤")
+	}
+}
+
+func TestSetIOLimitsWeight(t *testing.T) {
+	dir := t.TempDir()
+	// 核心不支援 io.weight 時，未指定權重不應該失敗
+	if err := setIOLimits(dir, types.ContainerLimits{}); err != nil {
+		t.Fatalf("沒有 io.weight 時不應該失敗: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "io.weight"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		weight int
+		want   string
+	}{
+		{10, "default 1"},
+		{500, "default 4950"},
+		{1000, "default 10000"},
+		// adjust --blkio-weight 0 必須恢復預設的權重，而不是保留舊的設定
+		{0, "default 100"},
+	}
+	for _, tt := range tests {
+		if err := setIOLimits(dir, types.ContainerLimits{BlkioWeight: tt.weight}); err != nil {
+			t.Fatalf("BlkioWeight=%d: %v", tt.weight, err)
+		}
+		if got := readCgroupFile(t, dir, "io.weight"); got != tt.want {
+			t.Errorf("BlkioWeight=%d: io.weight = %q, want %q", tt.weight, got, tt.want)
+		}
+	}
+	if err := setIOLimits(dir, types.ContainerLimits{BlkioWeight: 5}); err == nil {
+		t.Errorf("超出 10-1000 的權重應該回傳錯誤")
+	}
+}
@@ -0,0 +1,99 @@
+// internal/container/config.go
+package container
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/types"
+)
+
+// ApplyImageConfig 依照 Docker 的規則，將映像 config 與 run 參數合併到 req 中
+//   - 指令為 Entrypoint + Cmd；指定 --entrypoint 時會一併清除映像的 Cmd，使用者給的命令會取代 Cmd
+//   - 環境變數以映像的 Env 為基礎，再以使用者指定的值覆蓋
+//   - WorkingDir 與 User 以使用者指定的值優先
+//   - 指定 --platform 時映像的平台必須相符
+func ApplyImageConfig(req *types.RunRequest) error {
+	cfgFile, err := image.ReadImageConfig(req.ImageID)
+	if err != nil {
+		return fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	if err := image.CheckPlatform(cfgFile, req.Platform); err != nil {
+		return fmt.Errorf("%w (請先執行 'gocker pull --platform %s')", err, req.Platform)
+	}
+	cfg := cfgFile.Config
+
+	// 1. Entrypoint 與 Cmd
+	entrypoint := cfg.Entrypoint
+	cmd := cfg.Cmd
+	if req.Entrypoint != nil {
+		entrypoint = nil
+		if *req.Entrypoint != "" {
+			entrypoint = []string{*req.Entrypoint}
+		}
+		cmd = nil
+	}
+	if req.ContainerCommand != "" {
+		cmd = append([]string{req.ContainerCommand}, req.ContainerArgs...)
+	}
+
+	argv := append(append([]string{}, entrypoint...), cmd...)
+	if len(argv) == 0 {
+		argv = []string{config.DefaultCommand}
+	}
+	req.ContainerCommand = argv[0]
+	req.ContainerArgs = argv[1:]
+
+	// 2. 環境變數
+	req.Env = MergeEnv(cfg.Env, req.Env)
+
+	// 3. 工作目錄與使用者
+	if req.WorkingDir == "" {
+		req.WorkingDir = cfg.WorkingDir
+	}
+	if req.WorkingDir == "" {
+		req.WorkingDir = config.DefaultWorkingDir
+	}
+	if req.User == "" {
+		req.User = cfg.User
+	}
+
+	// 4. 對外公開的 port (目前僅作為紀錄)
+	req.ExposedPorts = req.ExposedPorts[:0]
+	for port := range cfg.ExposedPorts {
+		req.ExposedPorts = append(req.ExposedPorts, port)
+	}
+	sort.Strings(req.ExposedPorts)
+
+	return nil
+}
+
+// MergeEnv 以 overrides 覆蓋 base 中相同名稱的環境變數，並確保 PATH 存在
+func MergeEnv(base, overrides []string) []string {
+	var env []string
+	index := map[string]int{}
+
+	set := func(kv string) {
+		key, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[key]; ok {
+			env[i] = kv
+			return
+		}
+		index[key] = len(env)
+		env = append(env, kv)
+	}
+
+	for _, kv := range base {
+		set(kv)
+	}
+	for _, kv := range overrides {
+		set(kv)
+	}
+	if _, ok := index["PATH"]; !ok {
+		set(config.DefaultPathEnv)
+	}
+	return env
+}
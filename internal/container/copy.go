@@ -0,0 +1,200 @@
+// internal/container/copy.go
+package container
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	"golang.org/x/sys/unix"
+)
+
+// CopyFrom 將容器中 req.Path 的檔案或目錄以 tar 格式寫入 w (gocker cp CONTAINER:PATH HOSTPATH)
+// 運行中的容器在它的 mount namespace 中解析路徑 (/proc/<pid>/root)，因此也能讀到 volume 的內容；
+// 已停止的容器會以它的 storage driver 暫時掛載。路徑中的符號連結都限制在容器的根目錄之內解析，
+// 運行中的容器在複製期間會被暫停，見 frozenRoot
+func (m *Manager) CopyFrom(req *types.CopyFromRequest, w io.Writer) error {
+	info, root, cleanup, err := containerRoot(req.Container, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	src, err := resolveCopySource(root, req.Path)
+	if err != nil {
+		return fmt.Errorf("解析容器中的路徑 %s 失敗: %w", req.Path, err)
+	}
+	fi, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("容器 %s 中沒有 %s", info.Name, req.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && req.FileOnly {
+		return fmt.Errorf("無法將目錄 %s 複製到檔案", req.Path)
+	}
+	if !fi.IsDir() && req.Name == "." {
+		return fmt.Errorf("%s 不是目錄", req.Path)
+	}
+	return image.WriteArchive(w, src, req.Name)
+}
+
+// CopyTo 將 r 中的 tar 串流解開到容器中的 req.Path (gocker cp HOSTPATH CONTAINER:PATH)
+// 會保留擁有者、權限與時間戳記；目的地中的符號連結與 tar 中的項目都不能離開容器的根目錄
+func (m *Manager) CopyTo(req *types.CopyToRequest, r io.Reader) error {
+	info, root, cleanup, err := containerRoot(req.Container, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	target, err := fsutil.SecureJoin(root, req.Path)
+	if err != nil {
+		return fmt.Errorf("解析容器中的路徑 %s 失敗: %w", req.Path, err)
+	}
+	if target == filepath.Clean(root) {
+		// /proc/self/fd/<n> 是符號連結，加上 "/" 才會操作它指向的目錄
+		target += "/"
+	}
+	dir, name, err := copyDestination(target, req)
+	if err != nil {
+		return err
+	}
+	if name != req.Name {
+		rc := renameArchiveRoot(r, req.Name, name)
+		defer rc.Close()
+		r = rc
+	}
+	if err := image.ExtractLayer(r, dir, image.WhiteoutIgnore); err != nil {
+		return fmt.Errorf("複製到容器 %s 失敗: %w", info.Name, err)
+	}
+	return nil
+}
+
+// frozenRoot 暫停運行中的容器並開啟它的根目錄，回傳以 /proc/self/fd/<n> 表示的根目錄與恢復容器的函式
+// 路徑先在 daemon 中解析再開啟，容器中的行程若在這之間把路徑中的目錄換成符號連結，就能讓 daemon 讀寫容器外的檔案，
+// 因此使用期間容器中所有的行程都會被暫停；根目錄以開啟的 fd 固定，容器結束後 PID 被重複使用也不會指向其他行程
+func frozenRoot(info *types.ContainerInfo) (string, func(), error) {
+	resume, err := freezeContainer(info)
+	if err != nil {
+		return "", nil, err
+	}
+	// 必須在暫停之後開啟，確保開啟的是已被暫停的行程的根目錄
+	rootDir, err := os.OpenFile(fmt.Sprintf("/proc/%d/root", info.PID), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		resume()
+		return "", nil, fmt.Errorf("開啟容器 %s 的根目錄失敗: %w", info.Name, err)
+	}
+	cleanup := func() {
+		rootDir.Close()
+		resume()
+	}
+	return fmt.Sprintf("/proc/self/fd/%d", rootDir.Fd()), cleanup, nil
+}
+
+// resolveCopySource 將容器中的路徑 p 轉換為 root 之下的實際路徑
+// 父目錄中的符號連結在 root 之內解析，最後一個元件不會被跟隨，因此複製的是符號連結本身
+func resolveCopySource(root, p string) (string, error) {
+	clean := filepath.Clean("/" + p)
+	if clean == "/" {
+		return root + "/", nil
+	}
+	parent, err := fsutil.SecureJoin(root, filepath.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(clean)), nil
+}
+
+// copyDestination 依照目的地的狀態決定 tar 要解開到哪個目錄，以及來源在其中的名稱
+// 目的地為已存在的目錄時放到其中並沿用來源的名稱；否則以目的地的名稱放到它的父目錄，
+// 只複製目錄內容 (req.Name 為 ".") 時直接解開到目的地
+func copyDestination(target string, req *types.CopyToRequest) (string, string, error) {
+	fi, err := os.Stat(target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", "", err
+	}
+	exists := err == nil
+
+	switch {
+	case req.Name == "":
+		if !exists || !fi.IsDir() {
+			return "", "", fmt.Errorf("目的地 %s 必須是已存在的目錄", req.Path)
+		}
+		return target, "", nil
+	case exists && !fi.IsDir() && req.IsDir:
+		return "", "", fmt.Errorf("無法將目錄複製到檔案 %s", req.Path)
+	case req.Name == ".":
+		if !exists {
+			if err := checkParentDir(target, req.Path); err != nil {
+				return "", "", err
+			}
+		}
+		return target, ".", nil
+	case exists && fi.IsDir():
+		return target, req.Name, nil
+	}
+	if err := checkParentDir(target, req.Path); err != nil {
+		return "", "", err
+	}
+	return filepath.Dir(target), filepath.Base(target), nil
+}
+
+// checkParentDir 確認目的地的父目錄存在
+func checkParentDir(target, display string) error {
+	fi, err := os.Stat(filepath.Dir(target))
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("目的地 %s 的父目錄不存在", display)
+	}
+	return nil
+}
+
+// renameArchiveRoot 將 tar 串流中名為 from 的項目與其下的項目改名到 to 之下
+func renameArchiveRoot(r io.Reader, from, to string) io.ReadCloser {
+	rename := func(name string) string {
+		rest, ok := strings.CutPrefix(name, from)
+		if !ok || (rest != "" && rest[0] != '/') {
+			return name
+		}
+		return to + rest
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tr := tar.NewReader(r)
+		tw := tar.NewWriter(pw)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			header.Name = rename(header.Name)
+			if header.Typeflag == tar.TypeLink {
+				header.Linkname = rename(header.Linkname)
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+	return pr
+}
@@ -0,0 +1,58 @@
+// internal/container/diff.go
+package container
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+)
+
+// diffExcludedPaths 為 gocker 啟動容器時寫入、不屬於容器變更的項目
+var diffExcludedPaths = append([]string{"/etc/resolv.conf"}, exportExcludedPaths...)
+
+// Diff 列出容器的檔案系統相對於映像的變更 (gocker diff)
+// 變更由容器的 storage driver 計算 (例如 overlay 的 upper 目錄)，與映像的 layer 比對後分為新增、修改與刪除
+func (m *Manager) Diff(identifier string) ([]types.ContainerChange, error) {
+	info, err := findContainerInfo(identifier)
+	if err != nil {
+		return nil, err
+	}
+	driver, lowerDirs, err := containerStorage(info)
+	if err != nil {
+		return nil, err
+	}
+	return driver.Changes(filepath.Dir(info.MountPoint), lowerDirs, diffExcludedPaths)
+}
+
+// WriteDiff 將容器對映像所做的變更以 OCI layer 的格式寫入 w (gocker commit)，exclude 中的路徑不會寫入
+func (m *Manager) WriteDiff(info *types.ContainerInfo, w io.Writer, exclude []string) error {
+	driver, lowerDirs, err := containerStorage(info)
+	if err != nil {
+		return err
+	}
+	return driver.Diff(w, filepath.Dir(info.MountPoint), lowerDirs, exclude)
+}
+
+// Size 計算容器可寫入層的大小，以及加上映像所有 layer 後的總大小 (gocker ps -s)
+func (m *Manager) Size(info *types.ContainerInfo) (int64, int64, error) {
+	driver, lowerDirs, err := containerStorage(info)
+	if err != nil {
+		return 0, 0, err
+	}
+	sizeRw, err := driver.Size(filepath.Dir(info.MountPoint))
+	if err != nil {
+		return 0, 0, fmt.Errorf("計算可寫入層的大小失敗: %w", err)
+	}
+	sizeRootFs := sizeRw
+	for _, dir := range lowerDirs {
+		size, err := fsutil.DirSize(dir)
+		if err != nil {
+			return 0, 0, fmt.Errorf("計算映像 layer %s 的大小失敗: %w", dir, err)
+		}
+		sizeRootFs += size
+	}
+	return sizeRw, sizeRootFs, nil
+}
@@ -0,0 +1,221 @@
+// internal/container/export.go
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/storage"
+	"gocker/internal/types"
+	"gocker/internal/volume"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exportExcludedPaths 為 gocker 在容器中放置、不屬於容器檔案系統的項目
+var exportExcludedPaths = []string{"/.old_root", config.BPFServiceExeContainer, config.BPFServiceOutputLog}
+
+// Export 將容器合併後的根檔案系統以 tar 格式寫入 w (gocker export)
+// 運行中的容器在匯出期間會被暫停並直接讀取它的根目錄，略過容器內的其他掛載 (/proc、/sys、volume 等)；
+// 已停止的容器會以它的 storage driver 暫時重新掛載
+func (m *Manager) Export(identifier string, w io.Writer) error {
+	info, root, cleanup, err := containerRoot(identifier, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var mounts []string
+	if info.Status == types.Running {
+		if mounts, err = readMountPoints(fmt.Sprintf("/proc/%d/mountinfo", info.PID)); err != nil {
+			return fmt.Errorf("讀取容器 %s 的掛載資訊失敗: %w", info.Name, err)
+		}
+	}
+	return writeRootfs(w, root, mounts)
+}
+
+// rootfsLocks 記錄每個容器 (以 ID 為 key) 的 *sync.RWMutex
+// 暫時掛載已停止容器的根檔案系統時持有讀取鎖，gocker start 在容器開始運行之前持有寫入鎖，
+// 避免容器在 export/cp 掛載期間啟動，兩個掛載同時使用同一個可寫入層
+var rootfsLocks sync.Map
+
+func rootfsLock(id string) *sync.RWMutex {
+	lock, _ := rootfsLocks.LoadOrStore(id, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// containerRoot 回傳容器最新的資訊、可以存取其根檔案系統的路徑，以及使用完畢後要呼叫的函式
+// 運行中的容器會被暫停 (見 frozenRoot)；已停止的容器以 mountStoppedRootfs 掛載，並持有 rootfsLocks 直到呼叫 cleanup
+func containerRoot(identifier string, withVolumes bool) (*types.ContainerInfo, string, func(), error) {
+	info, err := findContainerInfo(identifier)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	lock := rootfsLock(info.ID)
+	lock.RLock()
+	// 取得鎖之後重新讀取狀態，容器可能在這之前已經啟動
+	if info, err = findContainerInfo(info.ID); err != nil {
+		lock.RUnlock()
+		return nil, "", nil, err
+	}
+
+	if info.Status == types.Running && info.PID > 0 {
+		lock.RUnlock()
+		root, cleanup, err := frozenRoot(info)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return info, root, cleanup, nil
+	}
+	root, cleanup, err := mountStoppedRootfs(info, withVolumes)
+	if err != nil {
+		lock.RUnlock()
+		return nil, "", nil, err
+	}
+	return info, root, func() {
+		cleanup()
+		lock.RUnlock()
+	}, nil
+}
+
+// mountStoppedRootfs 以容器的 storage driver 將已停止容器的根檔案系統暫時掛載到容器目錄下，
+// 回傳掛載點與卸載的函式；withVolumes 為 true 時一併掛上容器的 volume，寫入的內容與在容器內寫入相同
+// 呼叫者必須持有容器的 rootfsLocks，見 containerRoot
+func mountStoppedRootfs(info *types.ContainerInfo, withVolumes bool) (string, func(), error) {
+	driver, lowerDirs, err := containerStorage(info)
+	if err != nil {
+		return "", nil, err
+	}
+	containerDir := filepath.Dir(info.MountPoint)
+	mountPoint, err := os.MkdirTemp(containerDir, "rootfs-")
+	if err != nil {
+		return "", nil, fmt.Errorf("建立暫時掛載點失敗: %w", err)
+	}
+	if err := driver.Mount(containerDir, lowerDirs, mountPoint); err != nil {
+		os.Remove(mountPoint)
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		// MNT_DETACH 會一併卸載掛在其下的 volume
+		if err := driver.Unmount(mountPoint); err != nil {
+			logrus.Warnf("卸載 %s 失敗: %v", mountPoint, err)
+		}
+		if err := os.Remove(mountPoint); err != nil {
+			logrus.Warnf("刪除 %s 失敗: %v", mountPoint, err)
+		}
+	}
+	if withVolumes {
+		if err := volume.SetupMounts(mountPoint, info.Mounts); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("掛載 volume 失敗: %w", err)
+		}
+	}
+	return mountPoint, cleanup, nil
+}
+
+// containerStorage 回傳容器使用的 storage driver 與映像各個 layer 的目錄
+func containerStorage(info *types.ContainerInfo) (storage.Driver, []string, error) {
+	driver, err := storage.Get(info.StorageDriver)
+	if err != nil {
+		return nil, nil, err
+	}
+	lowerDirs, err := containerLowerDirs(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return driver, lowerDirs, nil
+}
+
+// containerLowerDirs 回傳容器的映像各個 layer 的目錄 (最上層在前)
+func containerLowerDirs(info *types.ContainerInfo) ([]string, error) {
+	imageID := info.ImageID
+	if imageID == "" {
+		// 舊版容器沒有記錄映像 ID，改用 name:tag 查詢
+		entry, err := image.LookupImage(info.Image)
+		if err != nil {
+			return nil, fmt.Errorf("找不到容器 %s 的映像: %w", info.Name, err)
+		}
+		imageID = entry.ImageID
+	}
+	lowerDirs, err := findImageLowerDirs(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("找不到容器 %s 的映像: %w", info.Name, err)
+	}
+	return lowerDirs, nil
+}
+
+// writeRootfs 將 root 之下的所有檔案寫成 tar，skip 中的路徑 (容器中的絕對路徑) 只保留目錄本身
+func writeRootfs(w io.Writer, root string, skip []string) error {
+	lw := image.NewLayerWriter(w)
+	// root 可能是 /proc/<pid>/root 這類符號連結，加上 "/" 才會進入它指向的目錄
+	err := filepath.Walk(root+"/", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		if slices.Contains(exportExcludedPaths, name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := lw.AddEntry(path, name, fi, nil); err != nil {
+			return err
+		}
+		if fi.IsDir() && slices.Contains(skip, name) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("讀取容器檔案系統失敗: %w", err)
+	}
+	return lw.Close()
+}
+
+// readMountPoints 從 mountinfo 讀取行程所看到的掛載點 (不包含根目錄)
+func readMountPoints(mountinfo string) ([]string, error) {
+	data, err := os.ReadFile(mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	var mounts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[4] == "/" {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPath(fields[4]))
+	}
+	return mounts, nil
+}
+
+// unescapeMountPath 還原 mountinfo 中以八進位跳脫的字元 (例如空白為 \040)
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
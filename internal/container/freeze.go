@@ -0,0 +1,76 @@
+// internal/container/freeze.go
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// freezeTimeout 為等待 cgroup 完成凍結或解凍的時間上限
+const freezeTimeout = 5 * time.Second
+
+// Freeze 以 cgroup v2 的 freezer 暫停容器中所有的行程，回傳恢復執行的函式
+// 用於 gocker commit，避免在讀取容器變更時檔案系統仍在改變
+func (m *Manager) Freeze(identifier string) (func(), error) {
+	info, err := findContainerInfo(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return freezeContainer(info)
+}
+
+// freezeContainer 暫停容器中所有的行程，回傳恢復執行的函式
+func freezeContainer(info *types.ContainerInfo) (func(), error) {
+	path, _, err := cgroupPath(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := setFrozen(path, true); err != nil {
+		_ = setFrozen(path, false)
+		return nil, fmt.Errorf("暫停容器 %s 失敗: %w", info.Name, err)
+	}
+	logrus.Infof("已暫停容器 %s", info.Name)
+
+	return func() {
+		if err := setFrozen(path, false); err != nil {
+			logrus.Warnf("恢復容器 %s 失敗: %v", info.Name, err)
+			return
+		}
+		logrus.Infof("已恢復容器 %s", info.Name)
+	}, nil
+}
+
+// setFrozen 寫入 cgroup.freeze，並等待 cgroup.events 回報狀態已經改變
+func setFrozen(cgroupPath string, frozen bool) error {
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+	if err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.freeze"), []byte(value), 0644); err != nil {
+		return fmt.Errorf("寫入 cgroup.freeze 失敗: %w", err)
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		data, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.events"))
+		if err != nil {
+			return fmt.Errorf("讀取 cgroup.events 失敗: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line == "frozen "+value {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待 cgroup 狀態改變逾時")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"gocker/internal/types"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 // InitContainer 負責所有子行程在新的 Namespace 中的初始化工作
@@ -37,8 +39,17 @@ func InitContainer() error {
 		return fmt.Errorf("子行程: 設定主機名稱失敗: %w", err)
 	}
 
+	//  舊版容器沒有記錄映像 ID，改用 name:tag 查詢
+	if req.ImageID == "" {
+		imageID, err := resolveImageID(req.ImageName, req.ImageTag)
+		if err != nil {
+			return fmt.Errorf("子行程: 找不到映像: %w", err)
+		}
+		req.ImageID = imageID
+	}
+
 	//  設定根檔案系統 (Rootfs)
-	if err := SetupRootfs(req.MountPoint, req.ImageName, req.ImageTag); err != nil {
+	if err := SetupRootfs(req.MountPoint, req.ImageID, req.StorageDriver, req.StorageSize, req.Mounts, !req.Build); err != nil {
 		return fmt.Errorf("子行程: 設定 rootfs 失敗: %w", err)
 	}
 	log.Info("子行程: Rootfs 掛載成功")
@@ -54,29 +65,81 @@ func InitContainer() error {
 	}
 	log.Info("子行程: 容器內網路設定完成")
 
-	//  Run initialization commands if any
-	log.Infof("Subprocess: %d initialization commands to run", len(req.InitCommands))
-	if len(req.InitCommands) > 0 {
-		log.Infof("Subprocess %d initialization commands", len(req.InitCommands))
-		for idx, commandLine := range req.InitCommands {
-			log.Infof("Subprocess: (%d/%d) Executing: %s", idx+1, len(req.InitCommands), commandLine)
-			initCmd := exec.Command("/bin/sh", "-c", commandLine)
-			initCmd.Stdout = os.Stdout
-			initCmd.Stderr = os.Stderr
-			initCmd.Stdin = os.Stdin
-			if err := initCmd.Run(); err != nil {
-				return fmt.Errorf("subprocess: initialization command '%s' failed: %w", commandLine, err)
+	//  設定容器的環境變數，只使用映像與使用者指定的值，不沿用 daemon 的環境
+	env := MergeEnv([]string{"HOSTNAME=" + req.ContainerName}, req.Env)
+	os.Clearenv()
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		_ = os.Setenv(key, value)
+	}
+
+	//  啟用 eBPF 監控服務 (建置映像的步驟不需要)
+	if !req.Build {
+		if err := startMonitorService(); err != nil {
+			return err
+		}
+	}
+
+	//  切換到工作目錄，不存在時自動建立
+	workDir := req.WorkingDir
+	if workDir == "" {
+		workDir = config.DefaultWorkingDir
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("子行程: 建立工作目錄 %s 失敗: %w", workDir, err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		return fmt.Errorf("子行程: 切換工作目錄 %s 失敗: %w", workDir, err)
+	}
+
+	//  切換到指定的使用者
+	user, err := lookupUser(req.User)
+	if err != nil {
+		return fmt.Errorf("子行程: 解析使用者失敗: %w", err)
+	}
+	if _, ok := os.LookupEnv("HOME"); !ok {
+		_ = os.Setenv("HOME", user.Home)
+	}
+	if req.User != "" {
+		log.Infof("子行程: 切換使用者為 uid=%d gid=%d", user.UID, user.GID)
+		if err := syscall.Setgroups(user.Groups); err != nil {
+			return fmt.Errorf("子行程: 設定補充群組失敗: %w", err)
+		}
+		if err := syscall.Setgid(user.GID); err != nil {
+			return fmt.Errorf("子行程: 設定 gid 失敗: %w", err)
+		}
+		if err := syscall.Setuid(user.UID); err != nil {
+			return fmt.Errorf("子行程: 設定 uid 失敗: %w", err)
+		}
+	}
+
+	//  建置步驟的命令輸出改寫到 fd 4，子行程自己的日誌不會混入建置輸出
+	if req.Build {
+		for _, fd := range []int{1, 2} {
+			if err := unix.Dup2(buildOutputFd, fd); err != nil {
+				return fmt.Errorf("子行程: 設定建置輸出失敗: %w", err)
 			}
 		}
 	}
 
-	//  使用 syscall.Exec 執行使用者指定的命令
+	//  使用 syscall.Exec 執行使用者指定的命令 (以容器的 PATH 尋找)
 	cmdPath, err := exec.LookPath(req.ContainerCommand)
 	if err != nil {
 		return fmt.Errorf("子行程: 找不到命令 '%s': %w", req.ContainerCommand, err)
 	}
 
-	//  啟用 eBPF 監控服務
+	//  執行使用者命令
+	log.Infof("子行程: 執行 exec syscall: %s", cmdPath)
+	args := append([]string{req.ContainerCommand}, req.ContainerArgs...)
+	if err := syscall.Exec(cmdPath, args, os.Environ()); err != nil {
+		return fmt.Errorf("子行程: exec 失敗: %w", err)
+	}
+
+	return nil
+}
+
+// startMonitorService 在容器內啟動 eBPF 監控服務，輸出寫入 config.BPFServiceOutputLog
+func startMonitorService() error {
 	stdoutFile, err := os.OpenFile(config.BPFServiceOutputLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("子行程: 開啟 eBPF 監控服務輸出檔失敗: %w", err)
@@ -90,15 +153,7 @@ func InitContainer() error {
 
 	if err := cmd.Start(); err != nil {
 		// return fmt.Errorf("子行程: 啟動 eBPF 監控服務失敗: %w", err)
-		log.Errorf("子行程: 啟動 eBPF 監控服務失敗: %v", err)
+		logrus.Errorf("子行程: 啟動 eBPF 監控服務失敗: %v", err)
 	}
-
-	//  執行使用者命令
-	log.Infof("子行程: 執行 exec syscall: %s", cmdPath)
-	args := append([]string{req.ContainerCommand}, req.ContainerArgs...)
-	if err := syscall.Exec(cmdPath, args, os.Environ()); err != nil {
-		return fmt.Errorf("子行程: exec 失敗: %w", err)
-	}
-
 	return nil
 }
@@ -18,8 +18,10 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"gocker/internal/config"
+	"gocker/internal/image"
 	"gocker/internal/network"
 	"gocker/internal/types"
+	"gocker/internal/volume"
 	"gocker/pkg"
 )
 
@@ -60,12 +62,24 @@ func (m *Manager) CreateAndRun(req *types.RunRequest) (string, error) {
 
 	log := logrus.WithFields(logrus.Fields{
 		"containerID": containerID,
-		"image":       fmt.Sprintf("%s:%s", req.ImageName, req.ImageTag),
+		"image":       image.JoinReference(req.ImageName, req.ImageTag),
 		"name":        req.ContainerName,
 	})
 
 	log.Info("父行程: 準備啟動容器...")
 
+	// 1.1 解析映像 ID，容器會固定使用此 ID 對應的映像
+	imageID, err := resolveImageID(req.ImageName, req.ImageTag)
+	if err != nil {
+		return "", fmt.Errorf("%w (請先執行 'gocker pull %s')", err, image.JoinReference(req.ImageName, req.ImageTag))
+	}
+	req.ImageID = imageID
+
+	// 1.2 合併映像的 config (Entrypoint、Cmd、Env 等) 與使用者指定的參數
+	if err := ApplyImageConfig(req); err != nil {
+		return "", err
+	}
+
 	// 2. 建立容器的工作目錄
 	containerDir := filepath.Join(config.ContainerStoragePath, containerID)
 	if err := os.MkdirAll(containerDir, 0755); err != nil {
@@ -74,16 +88,37 @@ func (m *Manager) CreateAndRun(req *types.RunRequest) (string, error) {
 	mountPoint := filepath.Join(containerDir, "rootfs")
 	req.MountPoint = mountPoint
 
+	// 2.1 以 storage driver 準備容器的根檔案系統
+	storageDriver, err := PrepareRootfs(containerDir, req.ImageID, req.StorageSize)
+	if err != nil {
+		return "", err
+	}
+	req.StorageDriver = storageDriver
+
+	// 2.2 準備 volume，並記錄容器對 volume 的引用
+	if err := volume.NewManager().Acquire(containerID, req.Mounts); err != nil {
+		return "", fmt.Errorf("準備 volume 失敗: %w", err)
+	}
+
 	// 3. 建立並寫入初始的 config.json
 	info := &types.ContainerInfo{
-		ID:         containerID,
-		Name:       req.ContainerName,
-		Command:    req.ContainerCommand,
-		Status:     types.Created,
-		CreatedAt:  time.Now(),
-		Image:      fmt.Sprintf("%s:%s", req.ImageName, req.ImageTag),
-		MountPoint: mountPoint,
-		Limits:     req.ContainerLimits,
+		ID:            containerID,
+		Name:          req.ContainerName,
+		Command:       req.ContainerCommand,
+		Args:          req.ContainerArgs,
+		Env:           req.Env,
+		WorkingDir:    req.WorkingDir,
+		User:          req.User,
+		ExposedPorts:  req.ExposedPorts,
+		Status:        types.Created,
+		CreatedAt:     time.Now(),
+		Image:         image.JoinReference(req.ImageName, req.ImageTag),
+		ImageID:       req.ImageID,
+		MountPoint:    mountPoint,
+		StorageDriver: req.StorageDriver,
+		StorageSize:   req.StorageSize,
+		Limits:        req.ContainerLimits,
+		Mounts:        req.Mounts,
 	}
 	if err := pkg.WriteContainerInfo(containerDir, info); err != nil {
 		return "", fmt.Errorf("寫入容器設定檔失敗: %w", err)
@@ -328,6 +363,20 @@ func (m *Manager) Start(identifier string, opts *StartOptions) error {
 		return fmt.Errorf("無法啟動狀態為 %s 的容器", info.Status)
 	}
 
+	// export/cp 暫時掛載容器的根檔案系統時不能啟動，否則兩個掛載會同時使用同一個可寫入層
+	lock := rootfsLock(info.ID)
+	if !lock.TryLock() {
+		return fmt.Errorf("容器 %s 的檔案系統正在被 export 或 cp 使用，請稍後再試", identifier)
+	}
+	locked := true
+	unlock := func() {
+		if locked {
+			lock.Unlock()
+			locked = false
+		}
+	}
+	defer unlock()
+
 	// 3. 準備重新啟動子行程
 	log := logrus.WithField("containerID", info.ID)
 
@@ -439,13 +488,22 @@ func (m *Manager) Start(identifier string, opts *StartOptions) error {
 	req := &types.RunRequest{
 		ImageName:        imageName,
 		ImageTag:         imageTag,
+		ImageID:          info.ImageID,
+		ContainerName:    info.Name,
 		ContainerCommand: info.Command,
+		ContainerArgs:    info.Args,
+		Env:              info.Env,
+		WorkingDir:       info.WorkingDir,
+		User:             info.User,
 		MountPoint:       info.MountPoint,
+		StorageDriver:    info.StorageDriver,
+		StorageSize:      info.StorageSize,
 		ContainerLimits:  info.Limits,
 		VethPeerName:     peerName,
 		RequestedIP:      info.RequestedIP,
 		IPAddress:        allocatedIP,
 		ContainerID:      info.ID,
+		Mounts:           info.Mounts,
 	}
 
 	encoder := json.NewEncoder(writePipe)
@@ -467,6 +525,7 @@ func (m *Manager) Start(identifier string, opts *StartOptions) error {
 	if err := pkg.WriteContainerInfo(containerDir, info); err != nil {
 		log.Warnf("更新容器狀態為 Running 失敗: %v", err)
 	}
+	unlock()
 
 	// 8. 設定資源限制
 	cgroupPath, err := m.SetupCgroup(info.Limits, newPid, info.ID)
@@ -2,108 +2,95 @@
 package container
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
 
 	"gocker/internal/config"
+	"gocker/internal/image"
+	"gocker/internal/storage"
 	"gocker/internal/types"
+	"gocker/internal/volume"
 	"gocker/pkg"
 
 	"github.com/sirupsen/logrus"
 )
 
-// SetupRootfs 準備容器的根檔案系統，包括掛載 OverlayFS 和執行 pivot_root
-// 參數 mountPoint 是容器最終的掛載點路徑
-func SetupRootfs(mountPoint string, imageName, imageTag string) error {
+// PrepareRootfs 以預設的 storage driver 為新容器準備根檔案系統，回傳 driver 的名稱 (記錄在容器的設定中)
+// storageSize 大於 0 時 driver 必須支援限制可寫入層的大小，實際的限制在 SetupRootfs 中設定
+func PrepareRootfs(containerDir, imageID string, storageSize int64) (string, error) {
+	lowerDirs, err := findImageLowerDirs(imageID)
+	if err != nil {
+		return "", fmt.Errorf("找不到基礎映像 '%s': %w", imageID, err)
+	}
+	driver := storage.Default()
+	if _, ok := driver.(storage.QuotaDriver); storageSize > 0 && !ok {
+		return "", fmt.Errorf("storage driver %s 不支援 --storage-opt size", driver.Name())
+	}
+	if err := driver.Prepare(containerDir, lowerDirs); err != nil {
+		return "", fmt.Errorf("以 %s 準備容器的根檔案系統失敗: %w", driver.Name(), err)
+	}
+	return driver.Name(), nil
+}
+
+// SetupRootfs 準備容器的根檔案系統，包括以 storage driver 掛載和執行 pivot_root
+// 參數 mountPoint 是容器最終的掛載點路徑，storageSize 大於 0 時限制可寫入層的大小，
+// installMonitor 為 false 時不複製 eBPF 監控服務
+func SetupRootfs(mountPoint string, imageID string, storageDriver string, storageSize int64, mounts []types.Mount, installMonitor bool) error {
 	log := logrus.WithFields(logrus.Fields{
-		"image":      fmt.Sprintf("%s:%s", imageName, imageTag),
+		"imageID":    imageID,
 		"mountPoint": mountPoint,
 	})
 	log.Info("正在設定容器 rootfs...")
 
-	// 1. 尋找基礎映像的 rootfs 路徑 (lowerdir)
-	imageRootfsPath, err := findImageRootfsPath(imageName, imageTag)
+	// 1. 尋找基礎映像各個 layer 的路徑 (lowerdir)
+	lowerDirs, err := findImageLowerDirs(imageID)
 	if err != nil {
-		return fmt.Errorf("找不到基礎映像 '%s:%s': %w", imageName, imageTag, err)
+		return fmt.Errorf("找不到基礎映像 '%s': %w", imageID, err)
 	}
-	log.Infof("找到基礎映像 rootfs (lowerdir): %s", imageRootfsPath)
-
-	/*
-	 * 	2. 建立 OverlayFS 所需的目錄
-	 *  -  upperdir: 存放容器內檔案變更 (寫入層)
-	 *  -  workdir: OverlayFS 的工作目錄
-	 */
-	containerBasePath := filepath.Dir(mountPoint)
-	upperdir := filepath.Join(containerBasePath, "upper")
-	workdir := filepath.Join(containerBasePath, "work")
+	log.Infof("找到基礎映像的 %d 個 layer (lowerdir)", len(lowerDirs))
 
-	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+	// 2. 以容器建立時選擇的 storage driver 掛載根檔案系統
+	driver, err := storage.Get(storageDriver)
+	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(upperdir, 0755); err != nil {
-		return err
+	containerDir := filepath.Dir(mountPoint)
+	if storageSize > 0 {
+		quotaDriver, ok := driver.(storage.QuotaDriver)
+		if !ok {
+			return fmt.Errorf("storage driver %s 不支援限制可寫入層的大小", driver.Name())
+		}
+		log.Infof("正在將可寫入層的大小限制為 %s", pkg.HumanSize(storageSize))
+		if err := quotaDriver.SetQuota(containerDir, storageSize); err != nil {
+			return err
+		}
 	}
-	if err := os.MkdirAll(workdir, 0755); err != nil {
+	log.Infof("正在以 %s 掛載根檔案系統", driver.Name())
+	if err := driver.Mount(containerDir, lowerDirs, mountPoint); err != nil {
 		return err
 	}
 
-	// 3. 組合 OverlayFS 的掛載選項
-	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", imageRootfsPath, upperdir, workdir)
-
-	// 4. 掛載 OverlayFS
-	log.Infof("正在掛載 OverlayFS, opts: %s", opts)
-	if err := syscall.Mount("overlay", mountPoint, "overlay", 0, opts); err != nil {
-
-		// if mount error is "Device or resource busy", check if the mount point is already mounted
-		// and fstype is overlay
-		if errors.Is(err, syscall.EBUSY) && checkFSType(mountPoint, "overlay") {
-			log.Infof("掛載點 %s 已經掛載 OverlayFS，跳過掛載步驟", mountPoint)
-		} else {
-			return fmt.Errorf("掛載 OverlayFS 失敗: %w", err)
+	// 2.1 複製eBPF 監控服務檔案到容器目錄
+	if installMonitor {
+		if err := installMonitorService(mountPoint, log); err != nil {
+			return err
 		}
 	}
 
-	// 4.1 複製eBPF 監控服務檔案到容器目錄
-	srcPath := config.BPFServiceExeHost
-	dstPath := filepath.Join(mountPoint, config.BPFServiceExeContainer)
-
-	exe, err := pkg.GetSelfExecutablePath()
-	if err != nil {
-		log.Warnf("無法獲取執行檔路徑, 使用當前目錄: %v", err)
-		exe = os.Getenv("PWD")
-	}
-	srcPath = filepath.Join(filepath.Dir(exe), config.BPFServiceExeHost)
-	log.Infof("正在複製 eBPF 監控服務檔案到容器: %s -> %s", srcPath, dstPath)
-	os.MkdirAll(filepath.Dir(dstPath), 0755)
-
-	src, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("無法開啟 eBPF 監控服務檔案: %w", err)
-	}
-	defer src.Close()
-
-	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("無法建立容器內的 eBPF 監控服務檔案: %w", err)
-	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, src); err != nil {
-		return fmt.Errorf("無法複製 eBPF 監控服務檔案: %w", err)
+	// 2.2 掛載 volume 與主機目錄
+	if err := volume.SetupMounts(mountPoint, mounts); err != nil {
+		return fmt.Errorf("掛載 volume 失敗: %w", err)
 	}
 
-	// 5. 執行 pivot_root 將根目錄切換到 mountPoint
+	// 3. 執行 pivot_root 將根目錄切換到 mountPoint
 	if err := PivotRoot(mountPoint); err != nil {
 		return fmt.Errorf("pivot_root 執行失敗: %w", err)
 	}
 
-	// 6. 在新的根目錄下掛載虛擬檔案系統
+	// 4. 在新的根目錄下掛載虛擬檔案系統
 	log.Info("正在掛載 /proc, /sys, /dev...")
 	if err := syscall.Mount("proc", "/proc", "proc", 0, ""); err != nil {
 		return fmt.Errorf("掛載 /proc 失敗: %w", err)
@@ -147,6 +134,38 @@ func SetupRootfs(mountPoint string, imageName, imageTag string) error {
 	return nil
 }
 
+// installMonitorService 將 eBPF 監控服務的執行檔複製到容器的 rootfs
+func installMonitorService(mountPoint string, log *logrus.Entry) error {
+	srcPath := config.BPFServiceExeHost
+	dstPath := filepath.Join(mountPoint, config.BPFServiceExeContainer)
+
+	exe, err := pkg.GetSelfExecutablePath()
+	if err != nil {
+		log.Warnf("無法獲取執行檔路徑, 使用當前目錄: %v", err)
+		exe = os.Getenv("PWD")
+	}
+	srcPath = filepath.Join(filepath.Dir(exe), config.BPFServiceExeHost)
+	log.Infof("正在複製 eBPF 監控服務檔案到容器: %s -> %s", srcPath, dstPath)
+	os.MkdirAll(filepath.Dir(dstPath), 0755)
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("無法開啟 eBPF 監控服務檔案: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("無法建立容器內的 eBPF 監控服務檔案: %w", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("無法複製 eBPF 監控服務檔案: %w", err)
+	}
+	return nil
+}
+
 // PivotRoot 切換根目錄
 func PivotRoot(newRoot string) error {
 	// 確保當前的 / 掛載傳播類型為 private，避免影響主機
@@ -185,53 +204,19 @@ func PivotRoot(newRoot string) error {
 	return nil
 }
 
-// findImageRootfsPath 透過 manifest 檔案尋找映像的 rootfs 路徑
-func findImageRootfsPath(imageName, imageTag string) (string, error) {
-	manifestPath := filepath.Join(config.ImagesDir, "manifest.json")
-	data, err := os.ReadFile(manifestPath)
-	if err != nil {
-		return "", fmt.Errorf("讀取映像 manifest %s 失敗: %w", manifestPath, err)
+// findImageLowerDirs 透過映像的 manifest 尋找各個 layer 的路徑，最上層在前
+func findImageLowerDirs(imageID string) ([]string, error) {
+	if imageID == "" {
+		return nil, fmt.Errorf("未指定映像 ID")
 	}
-
-	var manifests []types.ImageManifest
-	if err := json.Unmarshal(data, &manifests); err != nil {
-		return "", fmt.Errorf("解析 manifest.json 失敗: %w", err)
-	}
-
-	searchName := fmt.Sprintf("%s:%s", imageName, imageTag)
-	for _, m := range manifests {
-		if m.RepoTag == searchName {
-			return filepath.Join(config.ImagesDir, m.ImageID, "rootfs"), nil
-		}
-	}
-
-	return "", fmt.Errorf("在 manifest 中找不到映像 '%s'", searchName)
+	return image.LayerDirs(imageID)
 }
 
-/*
-檢查mountPoint是否為指定的fstype
-
-/proc/mounts 格式
-
-* device mountPoint fstype options dump pass
-*/
-func checkFSType(mountPoint, fstype string) bool {
-	data, err := os.ReadFile("/proc/mounts")
+// resolveImageID 透過 manifest 檔案將 name:tag 或 name@digest 轉換為映像 ID
+func resolveImageID(imageName, imageTag string) (string, error) {
+	entry, err := image.LookupImage(image.JoinReference(imageName, imageTag))
 	if err != nil {
-		logrus.Warnf("讀取 /proc/mounts 失敗: %v", err)
-		return false
-	}
-
-	for line := range strings.SplitSeq(string(data), "\n") {
-		fields := strings.Fields(line)
-		if len(fields) >= 3 && fields[1] == mountPoint {
-			if fields[2] != fstype {
-				logrus.Warnf("掛載點 %s 的 fstype 為 %s, 不是預期的 %s", mountPoint, fields[2], fstype)
-				return false
-			}
-			return true
-		}
+		return "", err
 	}
-	logrus.Warnf("找不到掛載點 %s", mountPoint)
-	return false
+	return entry.ImageID, nil
 }
@@ -0,0 +1,164 @@
+// internal/container/step.go
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"gocker/internal/config"
+	"gocker/internal/network"
+	"gocker/internal/storage"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// buildOutputFd 為建置步驟的容器中，命令輸出所使用的檔案描述符 (ExtraFiles 的第二個)
+const buildOutputFd = 4
+
+// BuildStep 為執行完畢的建置步驟容器
+type BuildStep struct {
+	ID        string
+	dir       string
+	driver    storage.Driver
+	lowerDirs []string
+}
+
+// Diff 將建置步驟對映像所做的變更以 OCI layer 的格式寫入 w，exclude 中的路徑不會寫入
+func (s *BuildStep) Diff(w io.Writer, exclude []string) error {
+	return s.driver.Diff(w, s.dir, s.lowerDirs, exclude)
+}
+
+// Remove 刪除建置步驟容器的所有檔案
+func (s *BuildStep) Remove() error {
+	// 掛載可能因為 mount propagation 留在主機上，先卸載再刪除
+	_ = s.driver.Unmount(filepath.Join(s.dir, "rootfs"))
+	return os.RemoveAll(s.dir)
+}
+
+// RunBuildStep 在暫時的容器中執行建置步驟的命令 (Gockerfile 的 RUN)，命令的輸出寫入 output
+// 容器存放在 config.BuildDir 之下，不會出現在 gocker ps，也不套用資源限制；
+// 命令失敗時同樣會回傳 BuildStep，呼叫者讀取完變更後必須呼叫 Remove
+func (m *Manager) RunBuildStep(req *types.RunRequest, output io.Writer) (*BuildStep, error) {
+	rootCgroupProcs := "/sys/fs/cgroup/cgroup.procs"
+	if err := os.WriteFile(rootCgroupProcs, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return nil, fmt.Errorf("無法將父行程移至 cgroup root: %w", err)
+	}
+
+	randBytes := make([]byte, 12)
+	if _, err := rand.Read(randBytes); err != nil {
+		return nil, fmt.Errorf("無法產生容器 ID: %w", err)
+	}
+	lowerDirs, err := findImageLowerDirs(req.ImageID)
+	if err != nil {
+		return nil, fmt.Errorf("找不到基礎映像 '%s': %w", req.ImageID, err)
+	}
+	step := &BuildStep{ID: hex.EncodeToString(randBytes), driver: storage.Default(), lowerDirs: lowerDirs}
+	step.dir = filepath.Join(config.BuildDir, step.ID)
+	if err := os.MkdirAll(step.dir, 0755); err != nil {
+		return nil, fmt.Errorf("建立建置容器目錄失敗: %w", err)
+	}
+	if err := step.driver.Prepare(step.dir, lowerDirs); err != nil {
+		return step, fmt.Errorf("以 %s 準備建置容器的根檔案系統失敗: %w", step.driver.Name(), err)
+	}
+
+	req.ContainerID = step.ID
+	req.ContainerName = step.ID[:12]
+	req.MountPoint = filepath.Join(step.dir, "rootfs")
+	req.StorageDriver = step.driver.Name()
+	req.Build = true
+	log := logrus.WithFields(logrus.Fields{"buildContainer": req.ContainerName, "imageID": req.ImageID})
+
+	// 命令輸出經由管道轉送給 output，子行程自己的日誌仍寫到 daemon 的輸出
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return step, fmt.Errorf("建立管道失敗: %w", err)
+	}
+	defer readPipe.Close()
+	outputRead, outputWrite, err := os.Pipe()
+	if err != nil {
+		writePipe.Close()
+		return step, fmt.Errorf("建立管道失敗: %w", err)
+	}
+	copyDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(output, outputRead)
+		outputRead.Close()
+		close(copyDone)
+	}()
+
+	cmd := exec.Command("/proc/self/exe", "init")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
+	}
+	cmd.Dir = "/"
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{readPipe, outputWrite}
+
+	err = cmd.Start()
+	outputWrite.Close()
+	if err != nil {
+		writePipe.Close()
+		<-copyDone
+		return step, fmt.Errorf("啟動子行程失敗: %w", err)
+	}
+	log.Infof("建置步驟的容器已啟動，PID 為 %d", cmd.Process.Pid)
+
+	runErr := m.startBuildStep(cmd, req, writePipe)
+	if runErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	<-copyDone
+
+	if err := network.ReleaseContainerIP(step.ID); err != nil {
+		log.Warnf("釋放建置容器的 IP 失敗: %v", err)
+	}
+	_ = m.CleanupCgroup(filepath.Join(config.CgroupRoot, config.CgroupName, step.ID))
+
+	if runErr != nil {
+		return step, runErr
+	}
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		return step, fmt.Errorf("命令回傳非零的結束代碼: %d", exitErr.ExitCode())
+	}
+	return step, waitErr
+}
+
+// startBuildStep 為建置步驟的子行程設定 cgroup 與網路，並將設定傳給子行程
+func (m *Manager) startBuildStep(cmd *exec.Cmd, req *types.RunRequest, writePipe *os.File) error {
+	defer writePipe.Close()
+
+	pid := cmd.Process.Pid
+	if _, err := m.SetupCgroup(req.ContainerLimits, pid, req.ContainerID); err != nil {
+		return fmt.Errorf("設定 cgroup 失敗: %w", err)
+	}
+
+	// RUN 的命令常需要下載套件，因此與一般容器一樣連上 gocker0
+	ip, err := network.AllocateContainerIP(req.ContainerID, "")
+	if err != nil {
+		return fmt.Errorf("cannot allocate container IP: %w", err)
+	}
+	req.IPAddress = ip
+	peerName, err := network.SetupVeth(pid)
+	if err != nil {
+		return fmt.Errorf("設定網路失敗: %w", err)
+	}
+	req.VethPeerName = peerName
+
+	if err := json.NewEncoder(writePipe).Encode(req); err != nil {
+		return fmt.Errorf("向管道寫入配置失敗: %w", err)
+	}
+	return nil
+}
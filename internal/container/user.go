@@ -0,0 +1,113 @@
+// internal/container/user.go
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// execUser 為解析後要執行使用者命令的身分
+type execUser struct {
+	UID    int
+	GID    int
+	Groups []int
+	Home   string
+}
+
+// lookupUser 在容器的 /etc/passwd 與 /etc/group 中解析 "user[:group]" 格式的使用者設定
+// user 與 group 可以是名稱或數字 ID；數字 ID 不需要存在於 passwd 中
+func lookupUser(spec string) (*execUser, error) {
+	u := &execUser{Home: "/"}
+	if spec == "" {
+		spec = "0"
+	}
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+
+	passwd, _ := readColonFile("/etc/passwd")
+	groups, _ := readColonFile("/etc/group")
+
+	// 1. 解析使用者
+	found := false
+	for _, fields := range passwd {
+		// name:password:uid:gid:gecos:home:shell
+		if len(fields) < 7 {
+			continue
+		}
+		if fields[0] != userPart && fields[2] != userPart {
+			continue
+		}
+		uid, err1 := strconv.Atoi(fields[2])
+		gid, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		u.UID, u.GID, u.Home = uid, gid, fields[5]
+		found = true
+
+		// 補充群組: 列在 /etc/group 成員清單中的群組
+		for _, g := range groups {
+			if len(g) < 4 {
+				continue
+			}
+			for _, member := range strings.Split(g[3], ",") {
+				if member == fields[0] {
+					if id, err := strconv.Atoi(g[2]); err == nil {
+						u.Groups = append(u.Groups, id)
+					}
+				}
+			}
+		}
+		break
+	}
+	if !found {
+		uid, err := strconv.Atoi(userPart)
+		if err != nil {
+			return nil, fmt.Errorf("在容器的 /etc/passwd 中找不到使用者 %q", userPart)
+		}
+		u.UID, u.GID = uid, uid
+	}
+
+	// 2. 解析群組
+	if hasGroup {
+		gid, err := strconv.Atoi(groupPart)
+		if err != nil {
+			gid = -1
+			for _, g := range groups {
+				if len(g) >= 3 && g[0] == groupPart {
+					gid, _ = strconv.Atoi(g[2])
+					break
+				}
+			}
+			if gid < 0 {
+				return nil, fmt.Errorf("在容器的 /etc/group 中找不到群組 %q", groupPart)
+			}
+		}
+		u.GID = gid
+		u.Groups = nil
+	}
+
+	return u, nil
+}
+
+// readColonFile 讀取以冒號分隔欄位的檔案，例如 /etc/passwd
+func readColonFile(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,51 @@
+// internal/daemon/build.go
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	"gocker/internal/types"
+)
+
+// handleBuild 負責處理 "build" 命令
+// 建置過程的輸出以 Status 為 "progress" 的回應串流，最後才回傳結果
+func (s *Server) handleBuild(payload json.RawMessage, encoder *json.Encoder) types.Response {
+	var buildReq types.BuildRequest
+	if err := json.Unmarshal(payload, &buildReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 build 請求的 payload 失敗: " + err.Error()}
+	}
+
+	imageID, err := s.Builder.Build(&buildReq, newProgressStream(encoder))
+	if err != nil {
+		return types.Response{Status: "error", Message: "建置映像失敗: " + err.Error()}
+	}
+	data, err := json.Marshal(types.BuildResult{ImageID: imageID, Tags: buildReq.Tags})
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化建置結果失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
+
+// handleBuilderPrune 負責處理 "builder_prune" 命令
+func (s *Server) handleBuilderPrune() types.Response {
+	report, err := s.ImageManager.PruneBuildCache(time.Time{})
+	if err != nil {
+		return types.Response{Status: "error", Message: "清除建置快取失敗: " + err.Error()}
+	}
+	return imageReportResponse(report)
+}
+
+// handleCommit 負責處理 "commit" 命令
+func (s *Server) handleCommit(payload json.RawMessage) types.Response {
+	var commitReq types.CommitRequest
+	if err := json.Unmarshal(payload, &commitReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 commit 請求的 payload 失敗: " + err.Error()}
+	}
+
+	imageID, err := s.Builder.CommitContainer(&commitReq)
+	if err != nil {
+		return types.Response{Status: "error", Message: "提交容器失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Message: imageID}
+}
@@ -2,9 +2,11 @@
 package daemon
 
 import (
+	"gocker/internal/build"
 	"gocker/internal/config"
 	"gocker/internal/container"
 	"gocker/internal/image"
+	"gocker/internal/volume"
 	"log"
 	"net"
 	"os"
@@ -13,12 +15,16 @@ import (
 type Server struct {
 	ContainerManager *container.Manager
 	ImageManager     *image.Manager
+	VolumeManager    *volume.Manager
+	Builder          *build.Builder
 }
 
-func NewServer(cm *container.Manager, im *image.Manager) *Server {
+func NewServer(cm *container.Manager, im *image.Manager, vm *volume.Manager) *Server {
 	return &Server{
 		ContainerManager: cm,
 		ImageManager:     im,
+		VolumeManager:    vm,
+		Builder:          build.NewBuilder(im, cm),
 	}
 }
 
@@ -0,0 +1,103 @@
+// internal/daemon/export.go
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"gocker/internal/types"
+)
+
+// exportChunkSize 為 export 與 cp 每次傳送的資料大小
+const exportChunkSize = 256 * 1024
+
+// handleExport 負責處理 "export" 命令
+// tar 資料以 Status 為 "progress" 的回應分段串流，最後才回傳結果
+func (s *Server) handleExport(payload json.RawMessage, encoder *json.Encoder) types.Response {
+	var exportReq types.ExportRequest
+	if err := json.Unmarshal(payload, &exportReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 export 請求的 payload 失敗: " + err.Error()}
+	}
+
+	w := bufio.NewWriterSize(&chunkStream{encoder: encoder}, exportChunkSize)
+	err := s.ContainerManager.Export(exportReq.Container, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return types.Response{Status: "error", Message: "匯出容器失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success"}
+}
+
+// handleImport 負責處理 "import" 命令
+func (s *Server) handleImport(payload json.RawMessage) types.Response {
+	var importReq types.ImportRequest
+	if err := json.Unmarshal(payload, &importReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 import 請求的 payload 失敗: " + err.Error()}
+	}
+
+	imageID, err := s.Builder.Import(&importReq)
+	if err != nil {
+		return types.Response{Status: "error", Message: "匯入映像失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Message: imageID}
+}
+
+// handleCopyFrom 負責處理 "cp_from" 命令，與 export 相同以 Status 為 "progress" 的回應分段串流 tar 資料
+func (s *Server) handleCopyFrom(payload json.RawMessage, encoder *json.Encoder) types.Response {
+	var copyReq types.CopyFromRequest
+	if err := json.Unmarshal(payload, &copyReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 cp 請求的 payload 失敗: " + err.Error()}
+	}
+
+	w := bufio.NewWriterSize(&chunkStream{encoder: encoder}, exportChunkSize)
+	err := s.ContainerManager.CopyFrom(&copyReq, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return types.Response{Status: "error", Message: "從容器複製失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success"}
+}
+
+// handleCopyTo 負責處理 "cp_to" 命令，tar 資料由客戶端在請求之後以 ArchiveChunk 傳送
+func (s *Server) handleCopyTo(payload json.RawMessage, decoder *json.Decoder) types.Response {
+	// 不論成功與否都要讀完客戶端傳來的資料，連線才能繼續處理下一個請求
+	body := &chunkReader{decoder: decoder}
+	var copyReq types.CopyToRequest
+	if err := json.Unmarshal(payload, &copyReq); err != nil {
+		io.Copy(io.Discard, body)
+		return types.Response{Status: "error", Message: "解析 cp 請求的 payload 失敗: " + err.Error()}
+	}
+
+	err := s.ContainerManager.CopyTo(&copyReq, body)
+	if _, drainErr := io.Copy(io.Discard, body); err == nil {
+		err = drainErr
+	}
+	if err != nil {
+		return types.Response{Status: "error", Message: "複製到容器失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success"}
+}
+
+// handleDiff 負責處理 "diff" 命令
+func (s *Server) handleDiff(payload json.RawMessage) types.Response {
+	var diffReq types.DiffRequest
+	if err := json.Unmarshal(payload, &diffReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 diff 請求的 payload 失敗: " + err.Error()}
+	}
+
+	changes, err := s.ContainerManager.Diff(diffReq.Container)
+	if err != nil {
+		return types.Response{Status: "error", Message: "讀取容器的變更失敗: " + err.Error()}
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化容器的變更失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
@@ -46,7 +46,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 		case "run":
 			res = s.handleRun(req.Payload)
 		case "ps":
-			res = s.handlePs()
+			res = s.handlePs(req.Payload)
 		case "start":
 			var handled bool
 			res, handled = s.handleStart(req.Payload, conn)
@@ -56,7 +56,49 @@ func (s *Server) handleConnection(conn net.Conn) {
 		case "images":
 			res = s.handleImages()
 		case "pull":
-			res = s.handlePull(req.Payload)
+			res = s.handlePull(req.Payload, encoder)
+		case "build":
+			res = s.handleBuild(req.Payload, encoder)
+		case "export":
+			res = s.handleExport(req.Payload, encoder)
+		case "diff":
+			res = s.handleDiff(req.Payload)
+		case "cp_from":
+			res = s.handleCopyFrom(req.Payload, encoder)
+		case "cp_to":
+			res = s.handleCopyTo(req.Payload, decoder)
+		case "import":
+			res = s.handleImport(req.Payload)
+		case "commit":
+			res = s.handleCommit(req.Payload)
+		case "builder_prune":
+			res = s.handleBuilderPrune()
+		case "push":
+			res = s.handlePush(req.Payload)
+		case "rmi":
+			res = s.handleRemoveImage(req.Payload)
+		case "tag":
+			res = s.handleTagImage(req.Payload)
+		case "image_prune":
+			res = s.handlePruneImages(req.Payload)
+		case "save":
+			res = s.handleSaveImages(req.Payload)
+		case "load":
+			res = s.handleLoadImages(req.Payload)
+		case "volume_create":
+			res = s.handleVolumeCreate(req.Payload)
+		case "volume_ls":
+			res = s.handleVolumeList()
+		case "volume_inspect":
+			res = s.handleVolumeInspect(req.Payload)
+		case "volume_rm":
+			res = s.handleVolumeRemove(req.Payload)
+		case "volume_prune":
+			res = s.handleVolumePrune()
+		case "system_df":
+			res = s.handleSystemDf()
+		case "system_prune":
+			res = s.handleSystemPrune(req.Payload)
 		default:
 			res = types.Response{Status: "error", Message: "未知的命令: " + req.Command}
 		}
@@ -84,11 +126,21 @@ func (s *Server) handleRun(payload json.RawMessage) types.Response {
 }
 
 // handlePs 負責處理 "ps" 命令
-func (s *Server) handlePs() types.Response {
+func (s *Server) handlePs(payload json.RawMessage) types.Response {
+	var psReq types.PsRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &psReq); err != nil {
+			return types.Response{Status: "error", Message: "解析 ps 請求的 payload 失敗: " + err.Error()}
+		}
+	}
+
 	containers, err := s.ContainerManager.List()
 	if err != nil {
 		return types.Response{Status: "error", Message: "獲取容器列表失敗: " + err.Error()}
 	}
+	if psReq.Size {
+		s.fillContainerSizes(containers)
+	}
 
 	data, err := json.Marshal(containers)
 	if err != nil {
@@ -224,13 +276,18 @@ func (s *Server) handleImages() types.Response {
 }
 
 // handlePull 負責處理 "pull" 命令
-func (s *Server) handlePull(payload json.RawMessage) types.Response {
+// 拉取過程中會持續以 Status 為 "progress" 的回應串流進度事件，最後才回傳結果
+func (s *Server) handlePull(payload json.RawMessage, encoder *json.Encoder) types.Response {
 	var imageName types.PullRequest
 	if err := json.Unmarshal(payload, &imageName); err != nil {
 		return types.Response{Status: "error", Message: "解析 pull 請求的 payload 失敗: " + err.Error()}
 	}
 
-	if err := s.ImageManager.PullImage(imageName.Image); err != nil {
+	// 客戶端中途離線時停止送出進度，pull 本身仍會完成，讓其他等待中的請求可以共用
+	stream := newProgressStream(encoder)
+	progress := func(ev types.ProgressEvent) { stream.send(ev) }
+
+	if err := s.ImageManager.PullImage(&imageName, progress); err != nil {
 		return types.Response{Status: "error", Message: "拉取映像失敗: " + err.Error()}
 	}
 	return types.Response{Status: "success", Message: "成功拉取映像: " + imageName.Image}
@@ -0,0 +1,105 @@
+// internal/daemon/image.go
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	"gocker/internal/types"
+)
+
+// handlePush 負責處理 "push" 命令
+func (s *Server) handlePush(payload json.RawMessage) types.Response {
+	var pushReq types.PushRequest
+	if err := json.Unmarshal(payload, &pushReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 push 請求的 payload 失敗: " + err.Error()}
+	}
+
+	digest, err := s.ImageManager.PushImage(&pushReq)
+	if err != nil {
+		return types.Response{Status: "error", Message: "推送映像失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Message: digest}
+}
+
+// handleRemoveImage 負責處理 "rmi" 命令
+func (s *Server) handleRemoveImage(payload json.RawMessage) types.Response {
+	var imgReq types.ImageRequest
+	if err := json.Unmarshal(payload, &imgReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 rmi 請求的 payload 失敗: " + err.Error()}
+	}
+
+	report, err := s.ImageManager.RemoveImage(imgReq.Image, imgReq.Force)
+	if err != nil {
+		return types.Response{Status: "error", Message: "刪除映像失敗: " + err.Error()}
+	}
+	return imageReportResponse(report)
+}
+
+// handleTagImage 負責處理 "tag" 命令
+func (s *Server) handleTagImage(payload json.RawMessage) types.Response {
+	var imgReq types.ImageRequest
+	if err := json.Unmarshal(payload, &imgReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 tag 請求的 payload 失敗: " + err.Error()}
+	}
+
+	if err := s.ImageManager.TagImage(imgReq.Image, imgReq.Target); err != nil {
+		return types.Response{Status: "error", Message: "建立 tag 失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Message: imgReq.Target}
+}
+
+// handlePruneImages 負責處理 "image_prune" 命令
+func (s *Server) handlePruneImages(payload json.RawMessage) types.Response {
+	var imgReq types.ImageRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &imgReq); err != nil {
+			return types.Response{Status: "error", Message: "解析 image prune 請求的 payload 失敗: " + err.Error()}
+		}
+	}
+
+	report, err := s.ImageManager.PruneImages(imgReq.All, time.Time{})
+	if err != nil {
+		return types.Response{Status: "error", Message: "清理映像失敗: " + err.Error()}
+	}
+	return imageReportResponse(report)
+}
+
+func imageReportResponse(report *types.ImageDeleteReport) types.Response {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化結果失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
+
+// handleSaveImages 負責處理 "save" 命令
+func (s *Server) handleSaveImages(payload json.RawMessage) types.Response {
+	var saveReq types.ImageSaveRequest
+	if err := json.Unmarshal(payload, &saveReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 save 請求的 payload 失敗: " + err.Error()}
+	}
+
+	if err := s.ImageManager.SaveImages(saveReq.Images, saveReq.Output, saveReq.Format); err != nil {
+		return types.Response{Status: "error", Message: "匯出映像失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Message: saveReq.Output}
+}
+
+// handleLoadImages 負責處理 "load" 命令
+func (s *Server) handleLoadImages(payload json.RawMessage) types.Response {
+	var loadReq types.ImageLoadRequest
+	if err := json.Unmarshal(payload, &loadReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 load 請求的 payload 失敗: " + err.Error()}
+	}
+
+	loaded, err := s.ImageManager.LoadImages(loadReq.Input)
+	if err != nil {
+		return types.Response{Status: "error", Message: "匯入映像失敗: " + err.Error()}
+	}
+	data, err := json.Marshal(loaded)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化結果失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
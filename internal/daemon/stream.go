@@ -0,0 +1,89 @@
+// internal/daemon/stream.go
+package daemon
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+
+	"gocker/internal/types"
+)
+
+// progressStream 將處理過程中的事件以 Status 為 "progress" 的回應傳給客戶端
+// 客戶端中途離線時停止傳送，處理本身仍會繼續完成
+type progressStream struct {
+	mu           sync.Mutex
+	encoder      *json.Encoder
+	disconnected bool
+}
+
+func newProgressStream(encoder *json.Encoder) *progressStream {
+	return &progressStream{encoder: encoder}
+}
+
+// send 傳送一個事件
+func (p *progressStream) send(event any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.disconnected {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := p.encoder.Encode(types.Response{Status: "progress", Data: data}); err != nil {
+		log.Printf("傳送進度失敗: %v", err)
+		p.disconnected = true
+	}
+}
+
+// Write 實作 io.Writer，將輸出包裝成 BuildEvent 傳送
+func (p *progressStream) Write(b []byte) (int, error) {
+	p.send(types.BuildEvent{Stream: string(b)})
+	return len(b), nil
+}
+
+// chunkStream 實作 io.Writer，將資料包裝成 ArchiveChunk 以 Status 為 "progress" 的回應傳送
+// 與 progressStream 不同，客戶端離線時 Write 會回傳錯誤，讓處理提早結束
+type chunkStream struct {
+	encoder *json.Encoder
+}
+
+func (c *chunkStream) Write(b []byte) (int, error) {
+	data, err := json.Marshal(types.ArchiveChunk{Data: b})
+	if err != nil {
+		return 0, err
+	}
+	if err := c.encoder.Encode(types.Response{Status: "progress", Data: data}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// chunkReader 實作 io.Reader，依序讀取客戶端在請求之後傳來的 ArchiveChunk，直到 EOF 為 true 的項目
+type chunkReader struct {
+	decoder *json.Decoder
+	buf     []byte
+	eof     bool
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		var chunk types.ArchiveChunk
+		if err := c.decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		c.buf, c.eof = chunk.Data, chunk.EOF
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,145 @@
+// internal/daemon/system.go
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gocker/internal"
+	"gocker/internal/config"
+	"gocker/internal/network"
+	"gocker/internal/types"
+	"gocker/pkg"
+)
+
+// handleSystemDf 負責處理 "system_df" 命令，計算映像、容器、volume 與建置快取占用的空間
+func (s *Server) handleSystemDf() types.Response {
+	usage, err := s.ImageManager.DiskUsage()
+	if err != nil {
+		return types.Response{Status: "error", Message: "計算映像占用的空間失敗: " + err.Error()}
+	}
+
+	containers, err := s.ContainerManager.List()
+	if err != nil {
+		return types.Response{Status: "error", Message: "獲取容器列表失敗: " + err.Error()}
+	}
+	s.fillContainerSizes(containers)
+	usage.Containers = append([]*types.ContainerInfo{}, containers...)
+
+	usage.Volumes, err = s.VolumeManager.DiskUsage()
+	if err != nil {
+		return types.Response{Status: "error", Message: "計算 volume 占用的空間失敗: " + err.Error()}
+	}
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化空間使用量失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
+
+// fillContainerSizes 計算容器可寫入層與根檔案系統的大小，填入 SizeRw 與 SizeRootFs
+func (s *Server) fillContainerSizes(containers []*types.ContainerInfo) {
+	for _, info := range containers {
+		sizeRw, sizeRootFs, err := s.ContainerManager.Size(info)
+		if err != nil {
+			log.Printf("計算容器 %s 的大小失敗: %v", info.Name, err)
+			continue
+		}
+		info.SizeRw, info.SizeRootFs = sizeRw, sizeRootFs
+	}
+}
+
+// handleSystemPrune 負責處理 "system_prune" 命令
+// 依照相依關係在同一輪中清理：先刪除已停止的容器，使它們引用的映像與 volume 變成未使用，
+// 再釋放殘留的 IP 配置，最後清理 volume、映像與建置快取；任何一步失敗時停止並回報已完成的部分
+func (s *Server) handleSystemPrune(payload json.RawMessage) types.Response {
+	var pruneReq types.SystemPruneRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &pruneReq); err != nil {
+			return types.Response{Status: "error", Message: "解析 system prune 請求的 payload 失敗: " + err.Error()}
+		}
+	}
+	if pruneReq.Volumes && !pruneReq.Until.IsZero() {
+		return types.Response{Status: "error", Message: "清理 volume 時不支援 until 過濾條件"}
+	}
+
+	report := &types.SystemPruneReport{}
+	fail := func(step string, err error) types.Response {
+		return types.Response{Status: "error", Message: fmt.Sprintf("%s失敗: %v (已刪除 %d 個容器，回收 %s)",
+			step, err, len(report.Containers), pkg.HumanSize(report.SpaceReclaimed))}
+	}
+
+	// 1. 已停止的容器
+	containers, err := s.ContainerManager.List()
+	if err != nil {
+		return fail("獲取容器列表", err)
+	}
+	remover := internal.NewRemover()
+	for _, info := range containers {
+		if info.Status == types.Running {
+			continue
+		}
+		if !pruneReq.Until.IsZero() && !info.CreatedAt.Before(pruneReq.Until) {
+			continue
+		}
+		sizeRw, _, err := s.ContainerManager.Size(info)
+		if err != nil {
+			log.Printf("計算容器 %s 釋放的空間失敗: %v", info.Name, err)
+		}
+		if err := remover.RemoveContainer(info.ID); err != nil {
+			log.Printf("刪除容器 %s 失敗: %v", info.Name, err)
+			continue
+		}
+		report.Containers = append(report.Containers, info.ID)
+		report.SpaceReclaimed += sizeRw
+	}
+
+	// 2. 已經不存在的容器留下的 IP 配置 (gocker 只有預設的 bridge 網路)
+	report.ReleasedIPs, err = network.PruneIPAllocations(func(containerID string) bool {
+		for _, dir := range []string{config.ContainerStoragePath, config.BuildDir} {
+			if _, err := os.Stat(filepath.Join(dir, containerID)); err == nil {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fail("釋放殘留的 IP 配置", err)
+	}
+
+	// 3. 沒有被使用的 volume
+	if pruneReq.Volumes {
+		volumeReport, err := s.VolumeManager.Prune()
+		if err != nil {
+			return fail("清理 volume", err)
+		}
+		report.Volumes = volumeReport.Deleted
+		report.SpaceReclaimed += volumeReport.SpaceReclaimed
+	}
+
+	// 4. 沒有 tag (或 --all 時沒有被使用) 的映像
+	imageReport, err := s.ImageManager.PruneImages(pruneReq.All, pruneReq.Until)
+	if err != nil {
+		return fail("清理映像", err)
+	}
+	report.Images = imageReport
+	report.SpaceReclaimed += imageReport.SpaceReclaimed
+
+	// 5. 建置快取
+	cacheReport, err := s.ImageManager.PruneBuildCache(pruneReq.Until)
+	if err != nil {
+		return fail("清除建置快取", err)
+	}
+	report.BuildCache = cacheReport.Deleted
+	report.SpaceReclaimed += cacheReport.SpaceReclaimed
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化清理結果失敗: " + err.Error()}
+	}
+	return types.Response{Status: "success", Data: data}
+}
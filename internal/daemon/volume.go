@@ -0,0 +1,87 @@
+// internal/daemon/volume.go
+package daemon
+
+import (
+	"encoding/json"
+
+	"gocker/internal/types"
+)
+
+// handleVolumeCreate 負責處理 "volume_create" 命令
+func (s *Server) handleVolumeCreate(payload json.RawMessage) types.Response {
+	var volReq types.VolumeRequest
+	if err := json.Unmarshal(payload, &volReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 volume create 請求的 payload 失敗: " + err.Error()}
+	}
+
+	info, err := s.VolumeManager.Create(volReq.Name, volReq.Labels)
+	if err != nil {
+		return types.Response{Status: "error", Message: "建立 volume 失敗: " + err.Error()}
+	}
+
+	return types.Response{Status: "success", Message: info.Name}
+}
+
+// handleVolumeList 負責處理 "volume_ls" 命令
+func (s *Server) handleVolumeList() types.Response {
+	volumes, err := s.VolumeManager.List()
+	if err != nil {
+		return types.Response{Status: "error", Message: "獲取 volume 列表失敗: " + err.Error()}
+	}
+
+	data, err := json.Marshal(volumes)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化 volume 列表失敗: " + err.Error()}
+	}
+
+	return types.Response{Status: "success", Data: data}
+}
+
+// handleVolumeInspect 負責處理 "volume_inspect" 命令
+func (s *Server) handleVolumeInspect(payload json.RawMessage) types.Response {
+	var volReq types.VolumeRequest
+	if err := json.Unmarshal(payload, &volReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 volume inspect 請求的 payload 失敗: " + err.Error()}
+	}
+
+	info, err := s.VolumeManager.Inspect(volReq.Name)
+	if err != nil {
+		return types.Response{Status: "error", Message: err.Error()}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化 volume 資訊失敗: " + err.Error()}
+	}
+
+	return types.Response{Status: "success", Data: data}
+}
+
+// handleVolumeRemove 負責處理 "volume_rm" 命令
+func (s *Server) handleVolumeRemove(payload json.RawMessage) types.Response {
+	var volReq types.VolumeRequest
+	if err := json.Unmarshal(payload, &volReq); err != nil {
+		return types.Response{Status: "error", Message: "解析 volume rm 請求的 payload 失敗: " + err.Error()}
+	}
+
+	if err := s.VolumeManager.Remove(volReq.Name); err != nil {
+		return types.Response{Status: "error", Message: "刪除 volume 失敗: " + err.Error()}
+	}
+
+	return types.Response{Status: "success", Message: volReq.Name}
+}
+
+// handleVolumePrune 負責處理 "volume_prune" 命令
+func (s *Server) handleVolumePrune() types.Response {
+	report, err := s.VolumeManager.Prune()
+	if err != nil {
+		return types.Response{Status: "error", Message: "清理 volume 失敗: " + err.Error()}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return types.Response{Status: "error", Message: "序列化清理結果失敗: " + err.Error()}
+	}
+
+	return types.Response{Status: "success", Data: data}
+}
@@ -0,0 +1,142 @@
+// internal/fsutil/copy.go
+package fsutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyTree 將 src 目錄下的所有內容複製到 dst，保留權限、擁有者、符號連結與修改時間
+func CopyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if err := CopyEntry(path, target, fi); err != nil {
+			return fmt.Errorf("複製 %s 失敗: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// CopyEntry 複製單一檔案系統項目 (目錄、一般檔案、符號連結或裝置檔)，不會遞迴處理目錄內容
+func CopyEntry(src, dst string, fi os.FileInfo) error {
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	case mode&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(dst)
+		if err := os.Symlink(link, dst); err != nil {
+			return err
+		}
+	case mode.IsRegular():
+		if err := copyFile(src, dst, mode); err != nil {
+			return err
+		}
+	default:
+		// 裝置檔、FIFO 與 socket 直接以相同的 mode/rdev 重建
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("不支援的檔案類型: %s", mode)
+		}
+		_ = os.Remove(dst)
+		if err := syscall.Mknod(dst, st.Mode, int(st.Rdev)); err != nil {
+			return err
+		}
+	}
+
+	return CopyMetadata(dst, fi)
+}
+
+// CopyMetadata 依照 fi 設定 dst 的擁有者與修改時間
+func CopyMetadata(dst string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// 符號連結的時間戳記對內容沒有影響，略過
+		return nil
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// OpenFile 受 umask 影響，且不會保留 setuid/setgid 位元
+	return os.Chmod(dst, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+}
+
+// DirSize 計算目錄下所有一般檔案的大小總和
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// IsEmptyDir 檢查目錄是否為空 (不存在的目錄視為空)
+func IsEmptyDir(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,104 @@
+// internal/fsutil/securejoin.go
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinkDepth 與 Linux 的 MAXSYMLINKS 相同
+const maxSymlinkDepth = 40
+
+// SecureJoin 將 unsafePath 接在 root 之下，並保證結果不會逃出 root
+// 路徑中的符號連結會被當作 root 就是 "/" 來解析 (類似 openat2 的 RESOLVE_IN_ROOT)，
+// ".." 最多只能回到 root，不存在的路徑元件則直接接上
+func SecureJoin(root, unsafePath string) (string, error) {
+	root = filepath.Clean(root)
+
+	var (
+		resolved  string // 已解析的路徑 (相對於 root，不含符號連結)
+		remaining = unsafePath
+		linksSeen int
+	)
+	for remaining != "" {
+		// 取出下一個路徑元件
+		var part string
+		remaining = strings.TrimLeft(remaining, "/")
+		if i := strings.IndexByte(remaining, '/'); i >= 0 {
+			part, remaining = remaining[:i], remaining[i:]
+		} else {
+			part, remaining = remaining, ""
+		}
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			// 最多回到 root
+			resolved = strings.TrimPrefix(filepath.Dir("/"+resolved), "/")
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if os.IsNotExist(err) || isNotDir(err) {
+				resolved = next
+				continue
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		linksSeen++
+		if linksSeen > maxSymlinkDepth {
+			return "", &os.PathError{Op: "securejoin", Path: filepath.Join(root, unsafePath), Err: syscall.ELOOP}
+		}
+		dest, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		// 絕對路徑的符號連結以 root 為起點，相對路徑則以目前目錄為起點
+		if filepath.IsAbs(dest) {
+			resolved = ""
+		}
+		remaining = dest + "/" + remaining
+	}
+
+	return filepath.Join(root, resolved), nil
+}
+
+// ValidateRelativePath 檢查來自不受信任來源 (例如 tar 項目) 的路徑
+// 不允許絕對路徑，也不允許透過 ".." 離開根目錄
+func ValidateRelativePath(name string) error {
+	if filepath.IsAbs(name) {
+		return fmt.Errorf("不允許絕對路徑: %q", name)
+	}
+	clean := filepath.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("路徑 %q 試圖離開根目錄", name)
+	}
+	return nil
+}
+
+// IsBelow 判斷 p 是否位於 root 之下 (不包含 root 本身)
+func IsBelow(root, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func isNotDir(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err == syscall.ENOTDIR
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	outside := t.TempDir()
+	root := filepath.Join(outside, "root")
+	if err := os.MkdirAll(filepath.Join(root, "dir/sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"abs":       "/etc",
+		"rel":       "../../..",
+		"outside":   outside,
+		"dir/up":    "..",
+		"chain1":    "chain2",
+		"chain2":    "/dir/sub",
+		"loop":      "loop",
+		"dir/self":  ".",
+		"dangling":  "/missing/file",
+		"dir/abs2":  "/dir",
+		"escape":    "dir/../../..",
+		"dir/upabs": "../../../../etc",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"dir/sub", "dir/sub"},
+		{"/dir/sub/file", "dir/sub/file"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"dir/../../..", ""},
+		{"abs/passwd", "etc/passwd"},
+		{"rel/etc/passwd", "etc/passwd"},
+		{"outside/victim", filepath.Join(outside, "victim")[1:]},
+		{"dir/up/dir/sub", "dir/sub"},
+		{"chain1/file", "dir/sub/file"},
+		{"dir/self/self/sub", "dir/sub"},
+		{"dangling", "missing/file"},
+		{"dir/abs2/sub", "dir/sub"},
+		{"escape/file", "file"},
+		{"dir/upabs/passwd", "etc/passwd"},
+		// 最後一個元件是符號連結時也會被解析
+		{"abs", "etc"},
+	}
+	for _, tt := range tests {
+		got, err := SecureJoin(root, tt.path)
+		if err != nil {
+			t.Errorf("SecureJoin(%q) 回傳錯誤: %v", tt.path, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("SecureJoin(%q) = %q, want %q", tt.path, got, want)
+		}
+		if !IsBelow(root, got) && got != root {
+			t.Errorf("SecureJoin(%q) = %q 逃出了 root", tt.path, got)
+		}
+	}
+
+	if _, err := SecureJoin(root, "loop/file"); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("符號連結迴圈應該回傳 ELOOP，得到 %v", err)
+	}
+}
+
+func TestValidateRelativePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"file", false},
+		{"./dir/file", false},
+		{"dir/../file", false},
+		{"dir/..", false},
+		{"..file", false},
+		{"/etc/passwd", true},
+		{"..", true},
+		{"../file", true},
+		{"dir/../../file", true},
+		{"./../file", true},
+	}
+	for _, tt := range tests {
+		err := ValidateRelativePath(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRelativePath(%q) = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsBelow(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{"/root", "/root/file", true},
+		{"/root", "/root/dir/file", true},
+		{"/root/", "/root/file", true},
+		{"/root", "/root", false},
+		{"/root", "/root/", false},
+		{"/root", "/root/..", false},
+		{"/root", "/", false},
+		{"/root", "/rootfile", false},
+		{"/root", "/root/../other", false},
+		{"/root", "/root/..file", true},
+	}
+	for _, tt := range tests {
+		if got := IsBelow(tt.root, tt.path); got != tt.want {
+			t.Errorf("IsBelow(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
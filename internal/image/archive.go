@@ -0,0 +1,382 @@
+// internal/image/archive.go
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocker/internal/fsutil"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// WhiteoutPrefix 為 OCI layer 中表示「刪除檔案」的前綴
+	WhiteoutPrefix = ".wh."
+	// WhiteoutOpaqueDir 表示此目錄在下層的內容全部被隱藏
+	WhiteoutOpaqueDir = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+
+	// OverlayOpaqueXattr 為 overlayfs 標記 opaque 目錄的 xattr
+	OverlayOpaqueXattr = "trusted.overlay.opaque"
+
+	paxXattrPrefix = "SCHILY.xattr."
+)
+
+// WhiteoutMode 決定解壓縮時如何處理 whiteout 檔案
+type WhiteoutMode int
+
+const (
+	// WhiteoutApply 直接刪除目標目錄中被 whiteout 的檔案，用於扁平化解壓縮
+	WhiteoutApply WhiteoutMode = iota
+	// WhiteoutOverlay 將 whiteout 轉換為 overlayfs 的格式 (0/0 字元裝置與 opaque xattr)，用於 layer store
+	WhiteoutOverlay
+	// WhiteoutIgnore 將 whiteout 視為一般檔案，用於 gocker cp 這類不是 layer 的 tar
+	WhiteoutIgnore
+)
+
+// Untar 解壓縮一個 tar 檔案到指定目錄，whiteout 會直接套用到目錄中
+func Untar(tarPath, destPath string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ExtractLayer(file, destPath, WhiteoutApply)
+}
+
+// ExtractLayer 依照 OCI image layer 規範將 tar 串流解壓縮到指定目錄
+// 會保留擁有者、權限、修改時間、xattr、硬連結與裝置檔，並依照 mode 處理 whiteout
+func ExtractLayer(r io.Reader, destPath string, mode WhiteoutMode) error {
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return err
+	}
+
+	x := &extractor{
+		root:    destPath,
+		mode:    mode,
+		created: map[string]bool{},
+	}
+
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.extract(header, tarReader); err != nil {
+			return fmt.Errorf("解壓縮 %s 失敗: %w", header.Name, err)
+		}
+	}
+	// tar 的結尾之後可能還有填充資料與壓縮格式的檢查碼，讀完才能發現被截斷的串流
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("讀取 layer 的結尾失敗: %w", err)
+	}
+
+	// 建立子項目會改變目錄的修改時間，因此目錄的時間戳記最後才設定
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		if err := setTimes(x.dirs[i].path, x.dirs[i].header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type extractedDir struct {
+	path   string
+	header *tar.Header
+}
+
+type extractor struct {
+	root string
+	mode WhiteoutMode
+
+	// created 記錄此 layer 建立的路徑，套用 opaque whiteout 時不能刪除它們
+	created map[string]bool
+	dirs    []extractedDir
+}
+
+func (x *extractor) extract(header *tar.Header, r io.Reader) error {
+	target, err := x.resolve(header.Name)
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(target)
+
+	// 1. whiteout
+	if x.mode != WhiteoutIgnore {
+		if base == WhiteoutOpaqueDir {
+			return x.opaque(filepath.Clean(dir))
+		}
+		if strings.HasPrefix(base, WhiteoutPrefix) {
+			whiteoutTarget, err := x.resolveWhiteout(header.Name)
+			if err != nil {
+				return err
+			}
+			return x.whiteout(whiteoutTarget)
+		}
+	}
+
+	// 2. 確保父目錄存在 (有些 tar 不包含父目錄的項目)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// 3. 移除下層留下的同名項目，目錄遇到目錄時保留 (內容會合併)
+	if fi, err := os.Lstat(target); err == nil {
+		if !(fi.IsDir() && header.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 4. 依照類型建立項目
+	mode := os.FileMode(header.Mode).Perm()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, extractedDir{path: target, header: header})
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|unix.O_NOFOLLOW, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		// 硬連結只能指向同一個 layer 中較早出現的檔案
+		linkTarget, err := x.resolve(header.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(linkTarget, target); err != nil {
+			return err
+		}
+		x.created[target] = true
+		// 硬連結與目標共用 inode，metadata 已由目標設定
+		return nil
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if err := mknod(target, header); err != nil {
+			if errors.Is(err, unix.EPERM) {
+				// 在無權限建立裝置檔的環境 (例如 user namespace) 中略過
+				logrus.Warnf("無權限建立裝置檔 %s，略過", header.Name)
+				return nil
+			}
+			return err
+		}
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		logrus.Warnf("不支援的 tar 項目類型 %q (%s)，略過", header.Typeflag, header.Name)
+		return nil
+	}
+	x.created[target] = true
+
+	// 5. 設定擁有者、xattr、權限與時間戳記
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+		return err
+	}
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		if err := unix.Lsetxattr(target, name, []byte(value), 0); err != nil {
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+				logrus.Debugf("無法設定 %s 的 xattr %s: %v", header.Name, name, err)
+				continue
+			}
+			return err
+		}
+	}
+	if header.Typeflag != tar.TypeSymlink {
+		// chown 會清除 setuid/setgid，因此權限要在 chown 之後設定
+		if err := os.Chmod(target, tarFileMode(header)); err != nil {
+			return err
+		}
+	}
+	if header.Typeflag != tar.TypeDir {
+		return setTimes(target, header)
+	}
+	return nil
+}
+
+// resolve 將 tar 項目名稱轉換為 root 之下的實際路徑
+// 拒絕絕對路徑與 ".." 逃逸；父目錄中的符號連結會被限制在 root 之內解析，
+// 最後一個元件本身不會被跟隨，因此惡意的符號連結無法把檔案寫到 root 之外
+func (x *extractor) resolve(name string) (string, error) {
+	if err := fsutil.ValidateRelativePath(name); err != nil {
+		return "", err
+	}
+
+	clean := filepath.Clean("/" + name)
+	if clean == "/" {
+		return x.root, nil
+	}
+	parent, err := fsutil.SecureJoin(x.root, filepath.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(clean)), nil
+}
+
+// resolveWhiteout 將 ".wh.<name>" 項目轉換為被刪除的檔案在 root 之下的實際路徑
+// <name> 必須是單一的路徑元件，且結果必須位於 root 之下 (不能是 root 本身)，避免刪除 root 之外的檔案
+func (x *extractor) resolveWhiteout(name string) (string, error) {
+	dir, base := path.Split(strings.TrimSuffix(name, "/"))
+	target := strings.TrimPrefix(base, WhiteoutPrefix)
+	if !validWhiteoutName(target) {
+		return "", fmt.Errorf("無效的 whiteout 項目 %q", name)
+	}
+	resolved, err := x.resolve(path.Join(dir, target))
+	if err != nil {
+		return "", err
+	}
+	if !fsutil.IsBelow(x.root, resolved) {
+		return "", fmt.Errorf("whiteout 項目 %q 指向根目錄之外", name)
+	}
+	return resolved, nil
+}
+
+// validWhiteoutName 判斷 whiteout 移除前綴後的名稱是否為單一的一般路徑元件
+func validWhiteoutName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// IsWhiteout 判斷 tar 項目是否為 whiteout 或 opaque whiteout
+func IsWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), WhiteoutPrefix)
+}
+
+// whiteout 處理 ".wh.<name>" 項目，target 必須已經由 resolveWhiteout 確認位於 root 之下
+func (x *extractor) whiteout(target string) error {
+	if x.mode == WhiteoutApply {
+		return os.RemoveAll(target)
+	}
+
+	// overlayfs 以 0/0 的字元裝置表示被刪除的檔案
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := unix.Mknod(target, unix.S_IFCHR, 0); err != nil {
+		return fmt.Errorf("建立 overlay whiteout 失敗: %w", err)
+	}
+	x.created[target] = true
+	return nil
+}
+
+// opaque 處理 ".wh..wh..opq" 項目
+func (x *extractor) opaque(dir string) error {
+	if x.mode == WhiteoutApply {
+		return x.removeNotCreated(dir)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := unix.Lsetxattr(dir, OverlayOpaqueXattr, []byte("y"), 0); err != nil {
+		return fmt.Errorf("設定 opaque xattr 失敗: %w", err)
+	}
+	return nil
+}
+
+// removeNotCreated 刪除目錄中所有不是由目前 layer 建立的項目
+func (x *extractor) removeNotCreated(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !x.created[path] {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.IsDir() {
+			if err := x.removeNotCreated(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func mknod(target string, header *tar.Header) error {
+	mode := uint32(header.Mode & 07777)
+	switch header.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))
+	return unix.Mknod(target, mode, int(dev))
+}
+
+// tarFileMode 將 tar header 的 mode 轉換為 os.FileMode (包含 setuid/setgid/sticky)
+func tarFileMode(header *tar.Header) os.FileMode {
+	mode := os.FileMode(header.Mode).Perm()
+	if header.Mode&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if header.Mode&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if header.Mode&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+func setTimes(path string, header *tar.Header) error {
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	ts := []unix.Timespec{toTimespec(atime), toTimespec(header.ModTime)}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("設定 %s 的時間戳記失敗: %w", path, err)
+	}
+	return nil
+}
+
+func toTimespec(t time.Time) unix.Timespec {
+	if t.IsZero() {
+		return unix.Timespec{Nsec: unix.UTIME_OMIT}
+	}
+	return unix.NsecToTimespec(t.UnixNano())
+}
@@ -0,0 +1,573 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tarEntry 描述測試用 tar 中的一個項目，未指定的 uid/gid 為目前的使用者
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+	mode     int64
+	uid, gid int
+	devmajor int64
+	devminor int64
+	pax      map[string]string
+}
+
+// buildTar 在記憶體中建立包含 entries 的 tar
+func buildTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:       e.name,
+			Typeflag:   e.typeflag,
+			Linkname:   e.linkname,
+			Mode:       e.mode,
+			Uid:        e.uid,
+			Gid:        e.gid,
+			Devmajor:   e.devmajor,
+			Devminor:   e.devminor,
+			PAXRecords: e.pax,
+			Format:     tar.FormatPAX,
+		}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		if header.Mode == 0 {
+			header.Mode = 0644
+			if header.Typeflag == tar.TypeDir {
+				header.Mode = 0755
+			}
+		}
+		if header.Uid == 0 && header.Gid == 0 {
+			header.Uid, header.Gid = os.Getuid(), os.Getgid()
+		}
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("寫入 tar header %s 失敗: %v", e.name, err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("寫入 tar 內容 %s 失敗: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// listDir 回傳目錄中的項目名稱
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestExtractLayerHostileArchives(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    WhiteoutMode
+		entries func(outside string) []tarEntry
+		wantErr bool
+	}{
+		{
+			name: "absolute path",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{{name: filepath.Join(outside, "evil"), body: "x"}}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "dot dot",
+			entries: func(string) []tarEntry { return []tarEntry{{name: "../evil", body: "x"}} },
+			wantErr: true,
+		},
+		{
+			name:    "dot dot in the middle",
+			entries: func(string) []tarEntry { return []tarEntry{{name: "a/../../evil", body: "x"}} },
+			wantErr: true,
+		},
+		{
+			name: "absolute symlink then write",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+					{name: "link/evil", body: "x"},
+				}
+			},
+		},
+		{
+			name: "relative symlink then write",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: "../../.."},
+					{name: "link/evil", body: "x"},
+				}
+			},
+		},
+		{
+			name: "symlink then overwrite the symlink",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "victim", typeflag: tar.TypeSymlink, linkname: "../victim"},
+					{name: "victim", body: "overwritten"},
+				}
+			},
+		},
+		{
+			name: "symlink to a directory then mkdir",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+					{name: "link/dir/", typeflag: tar.TypeDir},
+				}
+			},
+		},
+		{
+			name: "hardlink with dot dot",
+			entries: func(string) []tarEntry {
+				return []tarEntry{{name: "hl", typeflag: tar.TypeLink, linkname: "../victim"}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "hardlink with absolute path",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{{name: "hl", typeflag: tar.TypeLink, linkname: filepath.Join(outside, "victim")}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "hardlink through a symlink",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+					{name: "hl", typeflag: tar.TypeLink, linkname: "link/victim"},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "whiteout of the parent",
+			entries: func(string) []tarEntry { return []tarEntry{{name: ".wh...", body: ""}} },
+			wantErr: true,
+		},
+		{
+			name:    "whiteout of the parent in a subdirectory",
+			entries: func(string) []tarEntry { return []tarEntry{{name: "a/.wh...", body: ""}} },
+			wantErr: true,
+		},
+		{
+			name:    "whiteout of the parent in overlay mode",
+			mode:    WhiteoutOverlay,
+			entries: func(string) []tarEntry { return []tarEntry{{name: ".wh...", body: ""}} },
+			wantErr: true,
+		},
+		{
+			name:    "whiteout of the root",
+			entries: func(string) []tarEntry { return []tarEntry{{name: ".wh..", body: ""}} },
+			wantErr: true,
+		},
+		{
+			name:    "empty whiteout",
+			entries: func(string) []tarEntry { return []tarEntry{{name: ".wh.", body: ""}} },
+			wantErr: true,
+		},
+		{
+			name: "whiteout through a symlink",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: "../"},
+					{name: "link/.wh.victim", body: ""},
+				}
+			},
+		},
+		{
+			name: "opaque whiteout through a symlink",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{
+					{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+					{name: "link/.wh..wh..opq", body: ""},
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			root := filepath.Join(outside, "root")
+			victim := filepath.Join(outside, "victim")
+			if err := os.WriteFile(victim, []byte("secret"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := ExtractLayer(buildTar(t, tt.entries(outside)), root, tt.mode)
+			if tt.wantErr && err == nil {
+				t.Errorf("ExtractLayer 應該回傳錯誤")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ExtractLayer 回傳錯誤: %v", err)
+			}
+
+			if got := listDir(t, outside); !slices.Equal(got, []string{"root", "victim"}) {
+				t.Errorf("root 之外的項目被修改: %v", got)
+			}
+			data, err := os.ReadFile(victim)
+			if err != nil || string(data) != "secret" {
+				t.Errorf("root 之外的檔案被修改: %q, %v", data, err)
+			}
+			var st syscall.Stat_t
+			if err := syscall.Stat(victim, &st); err == nil && st.Nlink != 1 {
+				t.Errorf("root 之外的檔案被建立了硬連結 (nlink=%d)", st.Nlink)
+			}
+		})
+	}
+}
+
+func TestIsWhiteout(t *testing.T) {
+	tests := map[string]bool{
+		".wh.file":          true,
+		"a/.wh.file":        true,
+		"a/.wh..wh..opq":    true,
+		"a/.wh.dir/":        true,
+		"file":              false,
+		"a/file.wh.":        false,
+		"a/.whiteout":       false,
+		".wh/file":          false,
+		"a/.wh.dir/regular": false,
+	}
+	for name, want := range tests {
+		if got := IsWhiteout(name); got != want {
+			t.Errorf("IsWhiteout(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLayerWriterRejectsWhiteoutNames(t *testing.T) {
+	lw := NewLayerWriter(&bytes.Buffer{})
+	header := &tar.Header{Name: "a/.wh.file", Typeflag: tar.TypeReg, Mode: 0644}
+	if err := lw.AddHeader(header, bytes.NewReader(nil)); err == nil {
+		t.Errorf("AddHeader 應該拒絕 whiteout 項目")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".wh.file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lw.AddEntry(path, ".wh.file", fi, nil); err == nil {
+		t.Errorf("AddEntry 應該拒絕 whiteout 項目")
+	}
+}
+
+// writeLowerLayer 在 dir 中建立模擬下層 layer 的檔案
+func writeLowerLayer(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("lower"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// requireRoot 在非 root 執行時略過需要 CAP_MKNOD、CAP_CHOWN 或 trusted xattr 的測試
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("需要 root 權限")
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestExtractLayerWhiteoutApply(t *testing.T) {
+	dest := t.TempDir()
+	writeLowerLayer(t, dest, "a/removed", "a/kept", "b/hidden", "c/dir/file")
+
+	layer := buildTar(t, []tarEntry{
+		{name: "a/.wh.removed"},
+		{name: "b/", typeflag: tar.TypeDir},
+		{name: "b/new", body: "upper"},
+		{name: "b/.wh..wh..opq"},
+		{name: ".wh.c"},
+		{name: ".wh.missing"},
+	})
+	if err := ExtractLayer(layer, dest, WhiteoutApply); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+
+	for path, want := range map[string]bool{
+		"a/removed":      false,
+		"a/kept":         true,
+		"b/hidden":       false,
+		"b/new":          true,
+		"c":              false,
+		"a/.wh.removed":  false,
+		"b/.wh..wh..opq": false,
+		"missing":        false,
+		".wh.missing":    false,
+	} {
+		if got := exists(filepath.Join(dest, path)); got != want {
+			t.Errorf("%s 存在 = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestExtractLayerWhiteoutOverlay(t *testing.T) {
+	requireRoot(t)
+	dest := t.TempDir()
+
+	layer := buildTar(t, []tarEntry{
+		{name: "a/.wh.removed"},
+		{name: "b/", typeflag: tar.TypeDir},
+		{name: "b/.wh..wh..opq"},
+		{name: "b/new", body: "upper"},
+	})
+	if err := ExtractLayer(layer, dest, WhiteoutOverlay); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Lstat(filepath.Join(dest, "a/removed"), &st); err != nil {
+		t.Fatalf("沒有建立 overlay whiteout: %v", err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR || st.Rdev != 0 {
+		t.Errorf("overlay whiteout 應該是 0/0 的字元裝置，得到 mode=%o rdev=%d", st.Mode, st.Rdev)
+	}
+	value := make([]byte, 8)
+	n, err := unix.Lgetxattr(filepath.Join(dest, "b"), OverlayOpaqueXattr, value)
+	if err != nil || string(value[:n]) != "y" {
+		t.Errorf("opaque 目錄應該有 %s=y，得到 %q, %v", OverlayOpaqueXattr, value[:n], err)
+	}
+	if !exists(filepath.Join(dest, "b/new")) {
+		t.Errorf("opaque 目錄中同一個 layer 的檔案被刪除了")
+	}
+	for _, path := range []string{"a/.wh.removed", "b/.wh..wh..opq"} {
+		if exists(filepath.Join(dest, path)) {
+			t.Errorf("whiteout 項目 %s 不應該被寫入", path)
+		}
+	}
+}
+
+func TestExtractLayerWhiteoutIgnore(t *testing.T) {
+	dest := t.TempDir()
+	writeLowerLayer(t, dest, "a/removed")
+
+	layer := buildTar(t, []tarEntry{
+		{name: "a/.wh.removed", body: "regular"},
+		{name: "a/.wh..wh..opq", body: "regular"},
+	})
+	if err := ExtractLayer(layer, dest, WhiteoutIgnore); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+	for _, path := range []string{"a/removed", "a/.wh.removed", "a/.wh..wh..opq"} {
+		if !exists(filepath.Join(dest, path)) {
+			t.Errorf("%s 應該存在", path)
+		}
+	}
+}
+
+func TestExtractLayerHardlinks(t *testing.T) {
+	dest := t.TempDir()
+	layer := buildTar(t, []tarEntry{
+		{name: "dir/file", body: "content"},
+		{name: "link", typeflag: tar.TypeLink, linkname: "dir/file"},
+		{name: "./dir/link2", typeflag: tar.TypeLink, linkname: "./dir/file"},
+	})
+	if err := ExtractLayer(layer, dest, WhiteoutApply); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+
+	var file, link, link2 syscall.Stat_t
+	for path, st := range map[string]*syscall.Stat_t{"dir/file": &file, "link": &link, "dir/link2": &link2} {
+		if err := syscall.Stat(filepath.Join(dest, path), st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if file.Ino != link.Ino || file.Ino != link2.Ino || file.Nlink != 3 {
+		t.Errorf("硬連結應該共用 inode: %d %d %d (nlink=%d)", file.Ino, link.Ino, link2.Ino, file.Nlink)
+	}
+
+	// 指向不存在的檔案的硬連結是錯誤
+	if err := ExtractLayer(buildTar(t, []tarEntry{{name: "bad", typeflag: tar.TypeLink, linkname: "missing"}}), t.TempDir(), WhiteoutApply); err == nil {
+		t.Errorf("指向不存在檔案的硬連結應該回傳錯誤")
+	}
+}
+
+func TestExtractLayerSpecialFiles(t *testing.T) {
+	dest := t.TempDir()
+	entries := []tarEntry{
+		{name: "fifo", typeflag: tar.TypeFifo, mode: 0600},
+		{name: "symlink", typeflag: tar.TypeSymlink, linkname: "/etc/target"},
+	}
+	if os.Geteuid() == 0 {
+		entries = append(entries,
+			tarEntry{name: "null", typeflag: tar.TypeChar, mode: 0666, devmajor: 1, devminor: 3},
+			tarEntry{name: "loop", typeflag: tar.TypeBlock, mode: 0660, devmajor: 7, devminor: 200},
+		)
+	}
+	if err := ExtractLayer(buildTar(t, entries), dest, WhiteoutApply); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Lstat(filepath.Join(dest, "fifo"), &st); err != nil || st.Mode&syscall.S_IFMT != syscall.S_IFIFO {
+		t.Errorf("fifo 沒有正確建立: mode=%o, %v", st.Mode, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "symlink")); err != nil || target != "/etc/target" {
+		t.Errorf("符號連結應該原樣保留，得到 %q, %v", target, err)
+	}
+	if os.Geteuid() != 0 {
+		return
+	}
+	for name, want := range map[string]struct {
+		kind         uint32
+		major, minor uint32
+	}{
+		"null": {syscall.S_IFCHR, 1, 3},
+		"loop": {syscall.S_IFBLK, 7, 200},
+	} {
+		if err := syscall.Lstat(filepath.Join(dest, name), &st); err != nil {
+			t.Errorf("裝置檔 %s 沒有建立: %v", name, err)
+			continue
+		}
+		if st.Mode&syscall.S_IFMT != want.kind || unix.Major(st.Rdev) != want.major || unix.Minor(st.Rdev) != want.minor {
+			t.Errorf("裝置檔 %s: mode=%o rdev=%d:%d", name, st.Mode, unix.Major(st.Rdev), unix.Minor(st.Rdev))
+		}
+	}
+}
+
+func TestExtractLayerOwnershipAndMetadata(t *testing.T) {
+	requireRoot(t)
+	dest := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0750, Uid: 1000, Gid: 1001, ModTime: mtime, Format: tar.FormatPAX},
+		{Name: "dir/setuid", Typeflag: tar.TypeReg, Mode: 04755, Uid: 1234, Gid: 5678, ModTime: mtime, Format: tar.FormatPAX,
+			PAXRecords: map[string]string{paxXattrPrefix + "user.comment": "hello"}},
+		{Name: "dir/symlink", Typeflag: tar.TypeSymlink, Linkname: "setuid", Uid: 42, Gid: 43, ModTime: mtime, Format: tar.FormatPAX},
+	}
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractLayer(&buf, dest, WhiteoutApply); err != nil {
+		t.Fatalf("ExtractLayer 失敗: %v", err)
+	}
+
+	for _, want := range []struct {
+		path     string
+		uid, gid uint32
+		mode     os.FileMode
+	}{
+		{"dir", 1000, 1001, os.ModeDir | 0750},
+		{"dir/setuid", 1234, 5678, os.ModeSetuid | 0755},
+		{"dir/symlink", 42, 43, os.ModeSymlink},
+	} {
+		path := filepath.Join(dest, want.path)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if st.Uid != want.uid || st.Gid != want.gid {
+			t.Errorf("%s 的擁有者為 %d:%d，want %d:%d", want.path, st.Uid, st.Gid, want.uid, want.gid)
+		}
+		if want.mode&os.ModeSymlink == 0 && fi.Mode() != want.mode {
+			t.Errorf("%s 的權限為 %v，want %v", want.path, fi.Mode(), want.mode)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s 的修改時間為 %v，want %v", want.path, fi.ModTime(), mtime)
+		}
+	}
+
+	value := make([]byte, 16)
+	n, err := unix.Lgetxattr(filepath.Join(dest, "dir/setuid"), "user.comment", value)
+	if err != nil && !errors.Is(err, unix.ENOTSUP) {
+		t.Errorf("讀取 xattr 失敗: %v", err)
+	} else if err == nil && string(value[:n]) != "hello" {
+		t.Errorf("xattr user.comment = %q, want %q", value[:n], "hello")
+	}
+}
+
+func TestExtractLayerTruncated(t *testing.T) {
+	full := buildTar(t, []tarEntry{
+		{name: "file", body: strings.Repeat("x", 4096)},
+		{name: "second", body: "y"},
+	}).Bytes()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(full); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"tar truncated in a header": full[:100],
+		"tar truncated in a body":   full[:512+1000],
+		"gzip truncated":            gz.Bytes()[:gz.Len()/2],
+		"gzip without the trailer":  gz.Bytes()[:gz.Len()-4],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			rc, err := Decompress(bytes.NewReader(data))
+			if err == nil {
+				defer rc.Close()
+				err = ExtractLayer(rc, t.TempDir(), WhiteoutApply)
+			}
+			if err == nil {
+				t.Errorf("截斷的串流應該回傳錯誤")
+			}
+		})
+	}
+}
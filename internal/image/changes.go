@@ -0,0 +1,159 @@
+// internal/image/changes.go
+package image
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"gocker/internal/types"
+)
+
+// FlattenLayers 將 layers (最上層在前，overlay 的格式) 依序套用到 dst，產生合併後的完整檔案系統
+// 每個 layer 先轉換為 OCI layer 的 tar 串流再解壓縮，因此 whiteout、opaque 目錄、硬連結與 xattr 都會正確處理
+func FlattenLayers(layers []string, dst string) error {
+	for i := len(layers) - 1; i >= 0; i-- {
+		pr, pw := io.Pipe()
+		go func(layer string) {
+			pw.CloseWithError(WriteOverlayDiff(pw, layer, nil))
+		}(layers[i])
+		err := ExtractLayer(pr, dst, WhiteoutApply)
+		pr.Close()
+		if err != nil {
+			return fmt.Errorf("套用 layer %s 失敗: %w", layers[i], err)
+		}
+	}
+	return nil
+}
+
+// NaiveChanges 比對完整的根檔案系統 root 與 layers (最上層在前) 合併後的內容，依路徑排序回傳變更
+// 用於無法以 overlay 記錄變更的情況 (vfs)：類型、權限、擁有者、大小、修改時間或連結目標不同的項目視為修改，
+// 只存在於 root 的項目視為新增，只存在於 layers 的項目視為刪除 (被刪除的目錄不會列出其內容)
+func NaiveChanges(root string, layers []string, exclude []string) ([]types.ContainerChange, error) {
+	var changes []types.ContainerChange
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		if slices.Contains(exclude, name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		lowerPath, lowerFi, ok := lookupInLayers(layers, name)
+		switch {
+		case !ok:
+			changes = append(changes, types.ContainerChange{Kind: types.ChangeAdded, Path: name})
+		case entryChanged(path, fi, lowerPath, lowerFi):
+			changes = append(changes, types.ContainerChange{Kind: types.ChangeModified, Path: name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("讀取 %s 的變更失敗: %w", root, err)
+	}
+
+	deleted, err := deletedFromLayers(root, layers, "/", exclude)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 %s 的變更失敗: %w", root, err)
+	}
+	changes = append(changes, deleted...)
+	slices.SortFunc(changes, func(a, b types.ContainerChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes, nil
+}
+
+// deletedFromLayers 列出 layers 合併後的目錄 dir 之下，root 中已經不存在的項目
+func deletedFromLayers(root string, layers []string, dir string, exclude []string) ([]types.ContainerChange, error) {
+	seen := map[string]bool{}
+	var changes []types.ContainerChange
+	for _, layer := range layers {
+		entries, err := os.ReadDir(filepath.Join(layer, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := filepath.Join(dir, entry.Name())
+			if seen[name] || slices.Contains(exclude, name) {
+				continue
+			}
+			seen[name] = true
+			_, lowerFi, ok := lookupInLayers(layers, name)
+			if !ok {
+				continue
+			}
+			fi, err := os.Lstat(filepath.Join(root, name))
+			if os.IsNotExist(err) {
+				changes = append(changes, types.ContainerChange{Kind: types.ChangeDeleted, Path: name})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if fi.IsDir() && lowerFi.IsDir() {
+				children, err := deletedFromLayers(root, layers, name, exclude)
+				if err != nil {
+					return nil, err
+				}
+				changes = append(changes, children...)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// entryChanged 判斷 path 與 layer 中對應的項目 lowerPath 是否不同
+func entryChanged(path string, fi os.FileInfo, lowerPath string, lowerFi os.FileInfo) bool {
+	if fi.Mode() != lowerFi.Mode() {
+		return true
+	}
+	st, ok1 := fi.Sys().(*syscall.Stat_t)
+	lst, ok2 := lowerFi.Sys().(*syscall.Stat_t)
+	if ok1 && ok2 && (st.Uid != lst.Uid || st.Gid != lst.Gid || st.Rdev != lst.Rdev) {
+		return true
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		link, err1 := os.Readlink(path)
+		lowerLink, err2 := os.Readlink(lowerPath)
+		return err1 != nil || err2 != nil || link != lowerLink
+	}
+	if fi.Mode().IsRegular() && fi.Size() != lowerFi.Size() {
+		return true
+	}
+	return !fi.ModTime().Equal(lowerFi.ModTime())
+}
+
+// WriteChanges 將 changes 寫成 OCI layer 的 tar 串流，新增與修改的項目從 root 讀取，刪除的項目寫成 whiteout
+// changes 必須依路徑排序，父目錄才會在其內容之前寫入
+func WriteChanges(w io.Writer, root string, changes []types.ContainerChange) error {
+	lw := NewLayerWriter(w)
+	for _, change := range changes {
+		if change.Kind == types.ChangeDeleted {
+			if err := lw.AddWhiteout(change.Path); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(root, change.Path)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("讀取 %s 失敗: %w", change.Path, err)
+		}
+		if err := lw.AddEntry(path, change.Path, fi, nil); err != nil {
+			return err
+		}
+	}
+	return lw.Close()
+}
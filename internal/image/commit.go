@@ -0,0 +1,224 @@
+// internal/image/commit.go
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocker/internal/types"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// imageParentFile 記錄映像是以哪個映像為基礎建立的 (建置時的中間映像)
+	imageParentFile = "parent"
+	// imageCacheKeyFile 記錄建置步驟的快取 key，下次建置相同步驟時直接沿用此映像
+	imageCacheKeyFile = "cache-key"
+)
+
+// CommitOptions 描述以既有映像為基礎建立新映像的內容
+type CommitOptions struct {
+	Parent   string     // 基礎映像 ID，空字串表示從空白映像 (scratch) 開始
+	Layer    string     // 新 layer 的未壓縮 tar 檔路徑，空字串表示只修改 config
+	Config   v1.Config  // 新映像的執行設定 (Env、Cmd、WorkingDir 等)
+	History  v1.History // 本次變更的紀錄
+	Author   string     // 映像的作者 (gocker commit --author)
+	CacheKey string     // 建置快取的 key，空字串表示不做為快取
+}
+
+// CommitImage 以 opts 建立新映像並寫入映像儲存區，新映像不會有 tag
+// 回傳的記錄已填好 ImageID、大小與平台
+func (m *Manager) CommitImage(opts CommitOptions) (types.ImageManifest, error) {
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	var (
+		img v1.Image = empty.Image
+		err error
+	)
+	if opts.Parent != "" {
+		if img, err = StoredImage(opts.Parent); err != nil {
+			return types.ImageManifest{}, err
+		}
+	}
+
+	created := time.Now().UTC()
+	opts.History.Created = v1.Time{Time: created}
+	if opts.Layer != "" {
+		layer, err := tarball.LayerFromFile(opts.Layer, tarball.WithCompressedCaching)
+		if err != nil {
+			return types.ImageManifest{}, fmt.Errorf("讀取 layer %s 失敗: %w", opts.Layer, err)
+		}
+		if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, History: opts.History}); err != nil {
+			return types.ImageManifest{}, fmt.Errorf("加入 layer 失敗: %w", err)
+		}
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return types.ImageManifest{}, fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	cfg = cfg.DeepCopy()
+	if opts.Layer == "" {
+		opts.History.EmptyLayer = true
+		cfg.History = append(cfg.History, opts.History)
+	}
+	if cfg.OS == "" {
+		host := HostPlatform()
+		cfg.OS, cfg.Architecture, cfg.Variant = host.OS, host.Architecture, host.Variant
+	}
+	cfg.Config = opts.Config
+	if opts.Author != "" {
+		cfg.Author = opts.Author
+	}
+	cfg.Created = v1.Time{Time: created}
+	if img, err = mutate.ConfigFile(img, cfg); err != nil {
+		return types.ImageManifest{}, fmt.Errorf("更新映像 config 失敗: %w", err)
+	}
+
+	entry, err := m.storeImage(img, nil, logrus.WithField("parent", opts.Parent))
+	if err != nil {
+		return types.ImageManifest{}, err
+	}
+	if opts.Parent != "" {
+		path := filepath.Join(ImageDir(entry.ImageID), imageParentFile)
+		if err := os.WriteFile(path, []byte(opts.Parent), 0644); err != nil {
+			return types.ImageManifest{}, fmt.Errorf("寫入映像 %s 的 parent 失敗: %w", entry.ImageID, err)
+		}
+	}
+	if opts.CacheKey != "" {
+		path := filepath.Join(ImageDir(entry.ImageID), imageCacheKeyFile)
+		if err := os.WriteFile(path, []byte(opts.CacheKey), 0644); err != nil {
+			return types.ImageManifest{}, fmt.Errorf("寫入映像 %s 的快取 key 失敗: %w", entry.ImageID, err)
+		}
+	}
+	return entry, nil
+}
+
+// LookupBuildCache 尋找以 parent 為基礎、快取 key 為 key 的映像
+// 找到時回傳映像 ID 與解除 PinImage 標記的函式，標記在持有 gcMu 時完成，避免映像在使用前被刪除
+func (m *Manager) LookupBuildCache(parent, key string) (string, func(), bool) {
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return "", nil, false
+	}
+	for _, imageID := range imageIDs {
+		if ImageParent(imageID) != parent || imageCacheKey(imageID) != key {
+			continue
+		}
+		// 映像的 manifest 不完整時不使用
+		if _, err := StoredImage(imageID); err != nil {
+			continue
+		}
+		return imageID, m.PinImage(imageID), true
+	}
+	return "", nil, false
+}
+
+// imageCacheKey 回傳映像的建置快取 key，不是建置快取的映像回傳空字串
+func imageCacheKey(imageID string) string {
+	data, err := os.ReadFile(filepath.Join(ImageDir(imageID), imageCacheKeyFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ImageParent 回傳映像的基礎映像 ID，不是由 gocker 建立的映像回傳空字串
+func ImageParent(imageID string) string {
+	data, err := os.ReadFile(filepath.Join(ImageDir(imageID), imageParentFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// imageChildren 回傳每個映像被哪些映像當作基礎映像
+func (m *Manager) imageChildren() (map[string][]string, error) {
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return nil, err
+	}
+	children := map[string][]string{}
+	for _, imageID := range imageIDs {
+		if parent := ImageParent(imageID); parent != "" {
+			children[parent] = append(children[parent], imageID)
+		}
+	}
+	return children, nil
+}
+
+// LockStore 取得映像儲存的跨行程共用鎖，回傳解除的函式
+// 在 daemon 之外使用映像的行程 (gocker run 的 --init-file) 持有期間，daemon 的 rmi 與 prune 會等待，
+// PinImage 與 gcMu 只在同一個行程中有效，因此以此避免建置中的映像、layer 與尚未建立容器的映像被刪除
+func LockStore() (func(), error) {
+	return lockStore(unix.LOCK_SH)
+}
+
+// lockGC 同時取得行程內的 gcMu 與跨行程的獨佔鎖，刪除映像或 layer 之前呼叫
+func (m *Manager) lockGC() (func(), error) {
+	m.gcMu.Lock()
+	unlockStore, err := lockStore(unix.LOCK_EX)
+	if err != nil {
+		m.gcMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockStore()
+		m.gcMu.Unlock()
+	}, nil
+}
+
+// lockStore 以 flock 鎖定映像儲存目錄中的 storeLockFile
+func lockStore(how int) (func(), error) {
+	if err := os.MkdirAll(storeImagesDir, 0755); err != nil {
+		return nil, fmt.Errorf("建立映像儲存目錄失敗: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(storeImagesDir, storeLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("開啟映像儲存的 lock 檔案失敗: %w", err)
+	}
+	if err := unix.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("鎖定映像儲存目錄失敗: %w", err)
+	}
+	return func() {
+		_ = unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// PinImage 標記映像正在被建置使用，避免在建置完成前被 rmi 或 image prune 刪除
+// 回傳的函式用來解除標記
+func (m *Manager) PinImage(imageID string) func() {
+	m.pinsMu.Lock()
+	m.pins[imageID]++
+	m.pinsMu.Unlock()
+
+	return func() {
+		m.pinsMu.Lock()
+		defer m.pinsMu.Unlock()
+		if m.pins[imageID]--; m.pins[imageID] <= 0 {
+			delete(m.pins, imageID)
+		}
+	}
+}
+
+// pinned 回傳映像是否正在被建置使用
+func (m *Manager) pinned(imageID string) bool {
+	m.pinsMu.Lock()
+	defer m.pinsMu.Unlock()
+	return m.pins[imageID] > 0
+}
@@ -0,0 +1,64 @@
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockStoreBlocksPrune(t *testing.T) {
+	m := useTempStore(t)
+
+	// 其他行程 (gocker run 的 --init-file) 持有共用鎖時，prune 必須等待
+	unlock, err := LockStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.PruneImages(true, time.Time{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("持有共用鎖時 PruneImages 不應該完成 (err = %v)", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("PruneImages 失敗: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("釋放共用鎖之後 PruneImages 仍然沒有完成")
+	}
+}
+
+func TestLockStoreShared(t *testing.T) {
+	useTempStore(t)
+
+	// 多個使用映像的行程可以同時持有共用鎖
+	unlock1, err := LockStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock1()
+	acquired := make(chan func(), 1)
+	go func() {
+		unlock2, err := LockStore()
+		if err != nil {
+			t.Error(err)
+			unlock2 = func() {}
+		}
+		acquired <- unlock2
+	}()
+	select {
+	case unlock2 := <-acquired:
+		unlock2()
+	case <-time.After(5 * time.Second):
+		t.Fatal("第二個共用鎖被擋住")
+	}
+}
@@ -0,0 +1,377 @@
+// internal/image/diff.go
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"gocker/internal/types"
+
+	"golang.org/x/sys/unix"
+)
+
+// inode 以裝置與 inode 編號識別硬連結
+type inode struct {
+	dev, ino uint64
+}
+
+// LayerWriter 將檔案系統中的項目寫成 OCI layer 格式的 tar 串流
+type LayerWriter struct {
+	tw    *tar.Writer
+	links map[inode]string
+}
+
+// NewLayerWriter 建立寫入 w 的 LayerWriter，寫完後必須呼叫 Close
+func NewLayerWriter(w io.Writer) *LayerWriter {
+	return &LayerWriter{tw: tar.NewWriter(w), links: map[inode]string{}}
+}
+
+// AddEntry 寫入 path 這個項目 (不遞迴)，name 為 layer 中的路徑
+// 會保留擁有者、權限、修改時間與 xattr，同一個 inode 第二次出現時寫成硬連結；
+// modify 不為 nil 時可在寫入前修改 header (例如 COPY --chown)
+// 名稱為 whiteout 的項目會被拒絕，刪除檔案只能透過 AddWhiteout 與 AddOpaque 表示
+func (lw *LayerWriter) AddEntry(path, name string, fi os.FileInfo, modify func(*tar.Header)) error {
+	if IsWhiteout(name) {
+		return errWhiteoutEntry(name)
+	}
+	// tar 無法表示 socket，與 docker 相同直接略過
+	if fi.Mode()&os.ModeSocket != 0 {
+		return nil
+	}
+	link := ""
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	header.Name = strings.TrimPrefix(filepath.ToSlash(name), "/")
+	if fi.IsDir() && !strings.HasSuffix(header.Name, "/") {
+		header.Name += "/"
+	}
+	header.Uname, header.Gname = "", ""
+	header.Format = tar.FormatPAX
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		header.Uid, header.Gid = int(st.Uid), int(st.Gid)
+		if fi.Mode().IsRegular() && st.Nlink > 1 {
+			key := inode{dev: uint64(st.Dev), ino: st.Ino}
+			if first, ok := lw.links[key]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				lw.links[key] = header.Name
+			}
+		}
+	}
+	if err := readXattrs(path, header); err != nil {
+		return err
+	}
+	if modify != nil {
+		modify(header)
+	}
+
+	if err := lw.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg || header.Size == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(lw.tw, f)
+	return err
+}
+
+// AddHeader 寫入已經準備好的 header，一般檔案的內容從 r 讀取
+// 與 AddEntry 相同，來自外部 tar (gocker import、ADD) 的 whiteout 項目會被拒絕
+func (lw *LayerWriter) AddHeader(header *tar.Header, r io.Reader) error {
+	if IsWhiteout(header.Name) {
+		return errWhiteoutEntry(header.Name)
+	}
+	header.Format = tar.FormatPAX
+	if header.Typeflag == tar.TypeRegA {
+		header.Typeflag = tar.TypeReg
+	}
+	if err := lw.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg || header.Size == 0 {
+		return nil
+	}
+	_, err := io.CopyN(lw.tw, r, header.Size)
+	return err
+}
+
+// AddWhiteout 寫入表示 name 已被刪除的 ".wh.<name>" 項目
+func (lw *LayerWriter) AddWhiteout(name string) error {
+	dir, base := filepath.Split(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+	return lw.tw.WriteHeader(&tar.Header{
+		Name:     dir + WhiteoutPrefix + base,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Format:   tar.FormatPAX,
+	})
+}
+
+// AddOpaque 寫入表示 dir 在下層的內容全部被隱藏的 ".wh..wh..opq" 項目
+func (lw *LayerWriter) AddOpaque(dir string) error {
+	dir = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(dir), "/"), "/")
+	return lw.tw.WriteHeader(&tar.Header{
+		Name:     dir + "/" + WhiteoutOpaqueDir,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Format:   tar.FormatPAX,
+	})
+}
+
+// errWhiteoutEntry 回傳 layer 中不能出現名稱為 whiteout 的一般項目的錯誤
+func errWhiteoutEntry(name string) error {
+	return fmt.Errorf("不支援名稱為 whiteout 的項目 %q", name)
+}
+
+// Close 寫入 tar 的結尾
+func (lw *LayerWriter) Close() error {
+	return lw.tw.Close()
+}
+
+// WriteOverlayDiff 將 overlay 的 upper 目錄轉換為 OCI layer 的 tar 串流
+// overlay 的 whiteout (0/0 字元裝置) 與 opaque 目錄會轉換為 OCI 的 whiteout 項目；
+// exclude 中的路徑 (以 "/" 開頭，相對於容器的根目錄) 與其內容不會寫入
+func WriteOverlayDiff(w io.Writer, upperDir string, exclude []string) error {
+	lw := NewLayerWriter(w)
+	err := filepath.Walk(upperDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upperDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		for _, ex := range exclude {
+			if name == ex {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if isOverlayWhiteout(fi) {
+			return lw.AddWhiteout(name)
+		}
+		if err := lw.AddEntry(path, name, fi, nil); err != nil {
+			return err
+		}
+		if fi.IsDir() && isOverlayOpaque(path) {
+			return lw.AddOpaque(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("讀取 %s 的變更失敗: %w", upperDir, err)
+	}
+	return lw.Close()
+}
+
+// WriteArchive 將 src (檔案或目錄) 遞迴寫成 tar 串流，src 本身在 tar 中的名稱為 name
+// 用於 gocker cp；src 為符號連結時寫入連結本身，目錄之下的掛載點會一併讀取
+func WriteArchive(w io.Writer, src, name string) error {
+	lw := NewLayerWriter(w)
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		entry := name
+		if rel != "." {
+			entry = name + "/" + filepath.ToSlash(rel)
+		}
+		return lw.AddEntry(path, entry, fi, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("讀取 %s 失敗: %w", src, err)
+	}
+	return lw.Close()
+}
+
+// OverlayChanges 比對 overlay 的 upper 目錄與下層的 layer (lowerDirs，最上層在前)，依路徑排序回傳變更
+// upper 中的項目若存在於下層視為修改，否則視為新增；whiteout 視為刪除，
+// opaque 目錄中下層存在但 upper 沒有的項目也視為刪除；exclude 中的路徑與其內容不列出
+func OverlayChanges(upperDir string, lowerDirs []string, exclude []string) ([]types.ContainerChange, error) {
+	var changes []types.ContainerChange
+	err := filepath.Walk(upperDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upperDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		if slices.Contains(exclude, name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isOverlayWhiteout(fi) {
+			changes = append(changes, types.ContainerChange{Kind: types.ChangeDeleted, Path: name})
+			return nil
+		}
+		inLower := existsInLayers(lowerDirs, name)
+		kind := types.ChangeAdded
+		if inLower {
+			kind = types.ChangeModified
+		}
+		changes = append(changes, types.ContainerChange{Kind: kind, Path: name})
+
+		if fi.IsDir() && inLower && isOverlayOpaque(path) {
+			changes = append(changes, hiddenByOpaque(path, lowerDirs, name)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("讀取 %s 的變更失敗: %w", upperDir, err)
+	}
+	slices.SortFunc(changes, func(a, b types.ContainerChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes, nil
+}
+
+// hiddenByOpaque 列出被 upper 中的 opaque 目錄 (name) 遮住的下層項目
+func hiddenByOpaque(upperPath string, lowerDirs []string, name string) []types.ContainerChange {
+	seen := map[string]bool{}
+	var changes []types.ContainerChange
+	for _, layer := range lowerDirs {
+		entries, err := os.ReadDir(filepath.Join(layer, name))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			child := name + "/" + entry.Name()
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			if _, err := os.Lstat(filepath.Join(upperPath, entry.Name())); err == nil {
+				// upper 中有同名項目，已在走訪 upper 時列出
+				continue
+			}
+			if existsInLayers(lowerDirs, child) {
+				changes = append(changes, types.ContainerChange{Kind: types.ChangeDeleted, Path: child})
+			}
+		}
+	}
+	return changes
+}
+
+// existsInLayers 判斷 name 是否存在於 layers (最上層在前) 合併後的檔案系統中
+func existsInLayers(layers []string, name string) bool {
+	_, _, ok := lookupInLayers(layers, name)
+	return ok
+}
+
+// lookupInLayers 在 layers (最上層在前) 合併後的檔案系統中尋找 name，回傳它在最上層的實際路徑
+func lookupInLayers(layers []string, name string) (string, os.FileInfo, bool) {
+	for _, layer := range layers {
+		path := filepath.Join(layer, name)
+		if fi, err := os.Lstat(path); err == nil {
+			return path, fi, !isOverlayWhiteout(fi)
+		}
+		if hidesLower(layer, name) {
+			return "", nil, false
+		}
+	}
+	return "", nil, false
+}
+
+// hidesLower 判斷 layer 中 name 的上層目錄是否遮住了更下層的 layer
+// (該路徑在此 layer 中不是目錄，例如 whiteout，或是 opaque 目錄)
+func hidesLower(layer, name string) bool {
+	for dir := filepath.Dir(name); dir != "/"; dir = filepath.Dir(dir) {
+		fi, err := os.Lstat(filepath.Join(layer, dir))
+		if err != nil {
+			continue
+		}
+		if !fi.IsDir() || isOverlayOpaque(filepath.Join(layer, dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOverlayWhiteout 判斷項目是否為 overlay 表示刪除的 0/0 字元裝置
+func isOverlayWhiteout(fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
+
+// isOverlayOpaque 判斷目錄是否帶有 overlay 的 opaque 標記
+func isOverlayOpaque(path string) bool {
+	buf := make([]byte, 1)
+	n, err := unix.Lgetxattr(path, OverlayOpaqueXattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// readXattrs 將項目的 xattr 記錄到 header，overlay 內部使用的 xattr 不會寫入
+func readXattrs(path string, header *tar.Header) error {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if attr == "" || strings.HasPrefix(attr, "trusted.overlay.") || strings.HasPrefix(attr, "user.overlay.") {
+			continue
+		}
+		vsize, err := unix.Lgetxattr(path, attr, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, vsize)
+		if vsize, err = unix.Lgetxattr(path, attr, value); err != nil {
+			continue
+		}
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords[paxXattrPrefix+attr] = string(value[:vsize])
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// internal/image/load.go
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/sirupsen/logrus"
+)
+
+// loadedImage 為從 tar 檔讀出的映像，repoTags 為空時映像會以沒有 tag 的狀態匯入
+type loadedImage struct {
+	img      v1.Image
+	repoTags []string
+}
+
+// LoadImages 從 docker save 或 OCI image layout 格式的 tar 檔匯入映像 (gocker load)
+// 匯入的映像與 PullImage 的結果相同，會寫入 layer store 並登記到 manifest.json，
+// 回傳匯入的映像名稱，沒有 tag 的映像則回傳其 ID
+func (m *Manager) LoadImages(input string) ([]string, error) {
+	format, err := detectArchiveFormat(input)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"input": input, "format": format}).Info("正在匯入映像...")
+
+	var images []loadedImage
+	switch format {
+	case types.ImageArchiveDocker:
+		images, err = readDockerArchive(input)
+	case types.ImageArchiveOCI:
+		var tmpDir string
+		tmpDir, err = os.MkdirTemp("", "gocker-load-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		if err := Untar(input, tmpDir); err != nil {
+			return nil, fmt.Errorf("解開 OCI layout 失敗: %w", err)
+		}
+		images, err = readOCILayout(tmpDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%s 中沒有任何映像", input)
+	}
+
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	var loaded []string
+	for _, li := range images {
+		entry, err := m.storeImage(li.img, nil, logrus.WithField("input", input))
+		if err != nil {
+			return loaded, err
+		}
+		if len(li.repoTags) == 0 {
+			loaded = append(loaded, "sha256:"+entry.ImageID)
+			continue
+		}
+		for _, repoTag := range li.repoTags {
+			entry.RepoTag = repoTag
+			if err := m.updateManifest(entry); err != nil {
+				return loaded, fmt.Errorf("更新 manifest.json 失敗: %w", err)
+			}
+			loaded = append(loaded, repoTag)
+		}
+	}
+	return loaded, nil
+}
+
+// detectArchiveFormat 依照 tar 檔中的檔案判斷格式
+// 新版 docker save 同時包含 manifest.json 與 oci-layout，此時以 manifest.json 為準
+func detectArchiveFormat(input string) (string, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasOCILayout := false
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("讀取 tar 檔 %s 失敗: %w", input, err)
+		}
+		switch header.Name {
+		case "manifest.json", "./manifest.json":
+			return types.ImageArchiveDocker, nil
+		case "oci-layout", "./oci-layout":
+			hasOCILayout = true
+		}
+	}
+	if hasOCILayout {
+		return types.ImageArchiveOCI, nil
+	}
+	return "", fmt.Errorf("%s 不是 docker save 或 OCI image layout 格式的 tar 檔", input)
+}
+
+// readDockerArchive 讀取 docker save 格式的 tar 檔中所有的映像
+func readDockerArchive(input string) ([]loadedImage, error) {
+	opener := func() (io.ReadCloser, error) {
+		return os.Open(input)
+	}
+	manifest, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 manifest.json 失敗: %w", err)
+	}
+
+	var images []loadedImage
+	for _, desc := range manifest {
+		var tag *name.Tag
+		var repoTags []string
+		for _, repoTag := range desc.RepoTags {
+			t, err := name.NewTag(repoTag)
+			if err != nil {
+				logrus.Warnf("略過無效的 tag %q: %v", repoTag, err)
+				continue
+			}
+			if tag == nil {
+				tag = &t
+			}
+			repoTags = append(repoTags, FamiliarString(t))
+		}
+		if tag == nil && len(manifest) > 1 {
+			logrus.Warnf("略過沒有 tag 的映像 (config %s)", desc.Config)
+			continue
+		}
+
+		img, err := tarball.Image(opener, tag)
+		if err != nil {
+			return nil, fmt.Errorf("讀取映像失敗: %w", err)
+		}
+		images = append(images, loadedImage{img: img, repoTags: repoTags})
+	}
+	return images, nil
+}
+
+// readOCILayout 讀取 OCI image layout 中的映像
+// 名稱來自 io.containerd.image.name 或 org.opencontainers.image.ref.name annotation，
+// 多平台的映像只會匯入符合目前平台的版本
+func readOCILayout(dir string) ([]loadedImage, error) {
+	index, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 OCI layout 失敗: %w", err)
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []loadedImage
+	byDigest := map[v1.Hash]int{}
+	for _, desc := range indexManifest.Manifests {
+		img, err := imageFromDescriptor(index, desc)
+		if err != nil {
+			return nil, err
+		}
+		if img == nil {
+			logrus.Warnf("略過不支援的項目 %s (%s)", desc.Digest, desc.MediaType)
+			continue
+		}
+
+		i, ok := byDigest[desc.Digest]
+		if !ok {
+			i = len(images)
+			byDigest[desc.Digest] = i
+			images = append(images, loadedImage{img: img})
+		}
+		if repoTag := ociRefName(desc.Annotations); repoTag != "" {
+			images[i].repoTags = append(images[i].repoTags, repoTag)
+		}
+	}
+	return images, nil
+}
+
+// imageFromDescriptor 取得 index 中的映像，遇到 manifest list 時選擇符合目前平台的映像
+func imageFromDescriptor(index v1.ImageIndex, desc v1.Descriptor) (v1.Image, error) {
+	switch {
+	case desc.MediaType.IsImage():
+		return index.Image(desc.Digest)
+	case desc.MediaType.IsIndex():
+		child, err := index.ImageIndex(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		childManifest, err := child.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		host := HostPlatform()
+		for _, d := range childManifest.Manifests {
+			if d.MediaType.IsImage() && (d.Platform == nil || PlatformMatches(host, *d.Platform)) {
+				return child.Image(d.Digest)
+			}
+		}
+		return nil, fmt.Errorf("manifest list %s 中沒有 %s 平台的映像", desc.Digest, host.String())
+	default:
+		return nil, nil
+	}
+}
+
+// ociRefName 從 annotation 取得映像名稱，只有 tag 而沒有 repository 的名稱無法使用
+func ociRefName(annotations map[string]string) string {
+	for _, key := range []string{containerdImageNameAnnotation, ociRefNameAnnotation} {
+		value := annotations[key]
+		if value == "" {
+			continue
+		}
+		ref, err := name.ParseReference(value, name.StrictValidation)
+		if err != nil {
+			// org.opencontainers.image.ref.name 可能只是 tag (例如 "latest")
+			continue
+		}
+		return FamiliarString(ref)
+	}
+	return ""
+}
@@ -2,30 +2,54 @@
 package image
 
 import (
-	"archive/tar"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"gocker/internal/config"
 	"gocker/internal/types"
 
-	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/sirupsen/logrus"
 )
 
 // Manager 映像管理器
 type Manager struct {
 	storageDir string
+	layersDir  string
+
+	// layerLocks 以 layer digest 為 key，避免同一個 layer 被同時下載
+	layerLocks sync.Map
+	// manifestMu 保護 manifest.json 的讀取-修改-寫入
+	manifestMu sync.Mutex
+	// gcMu 避免刪除映像或 layer 時，與正在進行的 pull 互相干擾
+	gcMu sync.RWMutex
+
+	// registry 為 daemon 設定檔中的鏡像與倉庫設定，nil 表示使用預設值
+	registry *registryConfig
+
+	// pulls 記錄進行中的 pull，相同映像的請求會共用同一次下載
+	pullsMu sync.Mutex
+	pulls   map[string]*pullJob
+
+	// pins 記錄建置中使用的映像，這些映像不會被刪除
+	pinsMu sync.Mutex
+	pins   map[string]int
 }
 
 // NewManager 建立新的映像管理器
 func NewManager() *Manager {
 	manager := &Manager{
-		storageDir: config.ImagesDir,
+		storageDir: storeImagesDir,
+		layersDir:  storeLayersDir,
+		pulls:      map[string]*pullJob{},
+		pins:       map[string]int{},
 	}
 
 	// 確保儲存目錄存在
@@ -35,166 +59,412 @@ func NewManager() *Manager {
 }
 
 // Pull 拉取映像
-func (m *Manager) PullImage(imageName string) error {
-	log := logrus.WithField("image", imageName)
+// req.Image 可以是 name[:tag] 或 name@sha256:...，以 digest 指定時會驗證下載的 manifest 與 digest 相符
+// 進度事件會傳給 progress；同時有相同映像的 pull 進行中時，會等待並共用該次下載的進度與結果
+func (m *Manager) PullImage(req *types.PullRequest, progress ProgressFunc) error {
+	ref, err := ParseReference(req.Image)
+	if err != nil {
+		return err
+	}
+	repoTag := FamiliarString(ref)
+	log := logrus.WithField("image", repoTag)
+
+	key := pullKey(repoTag, req)
+	m.pullsMu.Lock()
+	if job, ok := m.pulls[key]; ok {
+		sub := job.subscribe(progress)
+		m.pullsMu.Unlock()
+		log.Info("相同的映像正在拉取中，等待其完成")
+		<-job.done
+		sub.close()
+		return job.err
+	}
+	job := newPullJob()
+	sub := job.subscribe(progress)
+	m.pulls[key] = job
+	m.pullsMu.Unlock()
+
+	job.err = m.pull(req, ref, log, job.publish)
+
+	m.pullsMu.Lock()
+	delete(m.pulls, key)
+	m.pullsMu.Unlock()
+	close(job.done)
+	sub.close()
+	return job.err
+}
+
+// pull 實際從遠端倉庫拉取映像並登記到 manifest.json
+func (m *Manager) pull(req *types.PullRequest, ref name.Reference, log *logrus.Entry, progress ProgressFunc) error {
+	repoTag := FamiliarString(ref)
 	log.Info("開始從遠端倉庫拉取映像...")
 
-	// 1. 使用 crane 拉取映像
-	img, err := crane.Pull(imageName)
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	platform, err := ParsePlatform(req.Platform)
 	if err != nil {
-		return fmt.Errorf("crane pull 失敗: %w", err)
+		return err
 	}
+	log = log.WithField("platform", platform.String())
 
-	// 2. 獲取映像的唯一 Digest (摘要)，並以此作為 ImageID
-	digest, err := img.Digest()
+	endpoints, err := m.pullEndpoints(ref)
 	if err != nil {
-		return fmt.Errorf("獲取映像 digest 失敗: %w", err)
+		return err
 	}
-	imageID := strings.TrimPrefix(digest.String(), "sha256:")[:12]
-	log = log.WithField("imageID", imageID)
 
-	// 3. 建立該映像的專屬儲存目錄
-	imageStorePath := filepath.Join(m.storageDir, imageID)
-	if err := os.MkdirAll(imageStorePath, 0755); err != nil {
-		return fmt.Errorf("建立映像儲存目錄 %s 失敗: %w", imageStorePath, err)
+	// 1. 依序嘗試鏡像與原始倉庫，任何一個來源失敗時換下一個
+	var (
+		desc  *remote.Descriptor
+		entry types.ImageManifest
+	)
+	for _, ep := range endpoints {
+		epLog := log.WithField("endpoint", ep.ref.Context().RegistryStr())
+		desc, entry, err = m.pullFrom(ep, req.Platform, platform, req.Auth, progress, epLog)
+		if err == nil {
+			epLog.Info("已從此來源取得映像")
+			break
+		}
+		if ep.mirror {
+			epLog.Warnf("從鏡像拉取失敗，改用下一個來源: %v", err)
+		}
 	}
-
-	// 4. 將映像匯出為 tarball
-	imageTarPath := filepath.Join(imageStorePath, "image.tar")
-	log.Infof("正在將映像匯出至 %s", imageTarPath)
-	f, err := os.Create(imageTarPath)
 	if err != nil {
-		return fmt.Errorf("建立映像 tarball 失敗: %w", err)
-	}
-	if err := crane.Export(img, f); err != nil {
-		f.Close()
-		return fmt.Errorf("匯出映像失敗: %w", err)
-	}
-	f.Close()
-
-	// 5. 建立 rootfs 目錄並解壓縮 tarball
-	rootfsPath := filepath.Join(imageStorePath, "rootfs")
-	log.Infof("正在將映像解壓縮至 %s", rootfsPath)
-	if err := Untar(imageTarPath, rootfsPath); err != nil {
-		return fmt.Errorf("解壓縮映像失敗: %w", err)
+		return err
 	}
 
-	// 6. ★★★ 寫入 manifest.json ★★★
+	// 2. ★★★ 寫入 manifest.json ★★★
+	// desc.Digest 為 tag 在倉庫中指向的 digest，遇到 manifest list 時會與 ImageID 不同
 	log.Info("正在更新 manifest.json...")
-	if err := m.updateManifest(imageName, imageID); err != nil {
+	entry.RepoTag = repoTag
+	entry.Digest = desc.Digest.String()
+	if err := m.updateManifest(entry); err != nil {
 		return fmt.Errorf("更新 manifest.json 失敗: %w", err)
 	}
 
-	log.Info("映像處理完成")
+	log.WithField("digest", desc.Digest.String()).Info("映像處理完成")
+	progress.emit(types.ProgressEvent{Status: types.ProgressDone, Message: desc.Digest.String()})
 	return nil
 }
 
-// updateManifest 讀取、更新並寫回 manifest.json
-func (m *Manager) updateManifest(repoTag, imageID string) error {
-	manifestPath := filepath.Join(m.storageDir, "manifest.json")
+// pullFrom 從指定的來源取得映像並寫入映像儲存區
+// 以 digest 指定時，remote 會確認下載的 manifest 與 digest 相符
+// 遇到 manifest list 時選擇符合 platform 的映像
+func (m *Manager) pullFrom(ep endpoint, requested string, platform v1.Platform, auth *types.RegistryAuth, progress ProgressFunc, log *logrus.Entry) (*remote.Descriptor, types.ImageManifest, error) {
+	// 憑證只屬於原始倉庫，鏡像以匿名身分存取
+	if ep.mirror {
+		auth = nil
+	}
+	opts, err := m.remoteOptions(ep.ref.Context().Registry, auth)
+	if err != nil {
+		return nil, types.ImageManifest{}, err
+	}
+	opts = append(opts, remote.WithPlatform(platform))
 
-	// 讀取現有 manifest，如果不存在則建立一個空的
-	var manifests []types.ImageManifest
-	data, err := os.ReadFile(manifestPath)
+	// 此時只會下載 manifest，layer 會在需要時才下載
+	progress.emit(types.ProgressEvent{Status: types.ProgressResolving, Message: ep.ref.String()})
+	desc, err := remote.Get(ep.ref, opts...)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("讀取 manifest.json 失敗: %w", err)
-		}
-		// 檔案不存在是正常情況，我們將建立一個新的
-	} else {
-		if err := json.Unmarshal(data, &manifests); err != nil {
-			return fmt.Errorf("解析 manifest.json 失敗: %w", err)
+		return nil, types.ImageManifest{}, fmt.Errorf("取得遠端映像 %s 失敗: %w", ep.ref, registryError(err, ep.ref, auth))
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return nil, types.ImageManifest{}, fmt.Errorf("解析遠端映像 %s 失敗: %w", ep.ref, err)
+	}
+
+	// 單一平台的映像不會經過 manifest list 的篩選，需要另外確認
+	// 明確指定 --platform 時不符合即失敗，使用主機預設平台時只提出警告
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, types.ImageManifest{}, fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	if err := CheckPlatform(cfg, requested); err != nil {
+		return nil, types.ImageManifest{}, fmt.Errorf("映像 %s: %w", ep.ref, err)
+	}
+
+	entry, err := m.storeImage(img, progress, log)
+	if err != nil {
+		return nil, types.ImageManifest{}, registryError(err, ep.ref, auth)
+	}
+	return desc, entry, nil
+}
+
+// storeImage 將映像的所有 layer 與 metadata 寫入映像儲存區，回傳填好 ImageID、大小與平台的記錄
+// ImageID 為映像 manifest 的完整 digest；呼叫前必須持有 gcMu 的讀取鎖
+func (m *Manager) storeImage(img v1.Image, progress ProgressFunc, log *logrus.Entry) (types.ImageManifest, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return types.ImageManifest{}, fmt.Errorf("獲取映像 digest 失敗: %w", err)
+	}
+	imageID := digest.Hex
+	log = log.WithField("imageID", imageID[:12])
+
+	// 逐一下載並解壓縮 layer，已存在的 layer 直接共用
+	layers, err := img.Layers()
+	if err != nil {
+		return types.ImageManifest{}, fmt.Errorf("獲取映像 layer 列表失敗: %w", err)
+	}
+	for i, layer := range layers {
+		log.Infof("正在處理 layer %d/%d", i+1, len(layers))
+		if err := m.storeLayer(layer, progress); err != nil {
+			return types.ImageManifest{}, err
 		}
 	}
 
-	// 檢查 tag 是否已存在，如果存在則更新，否則新增
-	found := false
-	for i := range manifests {
-		if manifests[i].RepoTag == repoTag {
-			manifests[i].ImageID = imageID
-			found = true
-			break
+	if err := m.writeImageMetadata(img, imageID); err != nil {
+		return types.ImageManifest{}, err
+	}
+	size, err := imageSize(imageID)
+	if err != nil {
+		return types.ImageManifest{}, fmt.Errorf("計算映像大小失敗: %w", err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return types.ImageManifest{}, fmt.Errorf("讀取映像 config 失敗: %w", err)
+	}
+	return types.ImageManifest{ImageID: imageID, Size: size, Platform: ConfigPlatform(cfg)}, nil
+}
+
+// storeLayer 下載 layer 的壓縮檔並解壓縮到 layer store，相同 digest 的 layer 只會處理一次
+func (m *Manager) storeLayer(layer v1.Layer, progress ProgressFunc) error {
+	digest, err := layer.Digest()
+	if err != nil {
+		return fmt.Errorf("獲取 layer digest 失敗: %w", err)
+	}
+	log := logrus.WithField("layer", digest.String())
+	id := digest.Hex[:12]
+
+	// 同一個 layer 可能被多個同時進行的 pull 共用，避免重複下載與解壓縮
+	lock, _ := m.layerLocks.LoadOrStore(digest.Hex, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		progress.emit(types.ProgressEvent{Status: types.ProgressWaiting, ID: id})
+		lock.(*sync.Mutex).Lock()
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	layerDir := LayerDir(digest)
+	if _, err := os.Stat(LayerDiffPath(digest)); err == nil {
+		log.Info("layer 已存在，略過下載")
+		progress.emit(types.ProgressEvent{Status: types.ProgressLayerExists, ID: id})
+		return nil
+	}
+	// 清除先前中斷留下的不完整目錄
+	_ = os.RemoveAll(layerDir)
+
+	if err := os.MkdirAll(m.layersDir, 0755); err != nil {
+		return fmt.Errorf("建立 layer 儲存目錄失敗: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(m.layersDir, digest.Hex+"-tmp-")
+	if err != nil {
+		return fmt.Errorf("建立 layer 暫存目錄失敗: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	// 1. 下載壓縮的 layer (remote layer 在讀取完畢時會驗證 digest)
+	log.Info("正在下載 layer...")
+	total, err := layer.Size()
+	if err != nil {
+		return fmt.Errorf("獲取 layer %s 大小失敗: %w", digest, err)
+	}
+	report := func(status string) func(int64) {
+		return func(current int64) {
+			progress.emit(types.ProgressEvent{Status: status, ID: id, Current: current, Total: total})
 		}
 	}
-	if !found {
-		manifests = append(manifests, types.ImageManifest{
-			RepoTag: repoTag,
-			ImageID: imageID,
-		})
+	report(types.ProgressDownloading)(0)
+	blobPath := filepath.Join(tmpDir, layerBlobFile)
+	if err := writeBlob(layer, blobPath, report(types.ProgressDownloading)); err != nil {
+		return fmt.Errorf("下載 layer %s 失敗: %w", digest, err)
 	}
+	report(types.ProgressDownloading)(total)
 
-	// 將更新後的內容寫回檔案
-	newData, err := json.MarshalIndent(manifests, "", "    ")
+	// 2. 解壓縮到 diff 目錄
+	log.Info("正在解壓縮 layer...")
+	blob, err := os.Open(blobPath)
 	if err != nil {
-		return fmt.Errorf("序列化 manifest 失敗: %w", err)
+		return err
 	}
+	defer blob.Close()
 
-	return os.WriteFile(manifestPath, newData, 0644)
+	report(types.ProgressExtracting)(0)
+	rc, err := Decompress(newProgressReader(blob, report(types.ProgressExtracting)))
+	if err != nil {
+		return fmt.Errorf("解壓縮 layer %s 失敗: %w", digest, err)
+	}
+	defer rc.Close()
+
+	if err := ExtractLayer(rc, filepath.Join(tmpDir, layerDiffDir), WhiteoutOverlay); err != nil {
+		return fmt.Errorf("解壓縮 layer %s 失敗: %w", digest, err)
+	}
+
+	// 3. 完成後才將暫存目錄移到最終位置，確保 layer store 中只有完整的 layer
+	if err := os.Rename(tmpDir, layerDir); err != nil {
+		return fmt.Errorf("移動 layer 目錄失敗: %w", err)
+	}
+	progress.emit(types.ProgressEvent{Status: types.ProgressLayerComplete, ID: id, Total: total})
+	return nil
 }
 
-// Untar 解壓縮一個 tar 檔案到指定目錄
-func Untar(tarPath, destPath string) error {
-	_ = os.MkdirAll(destPath, 0755)
+// writeBlob 將 layer 的壓縮內容寫入檔案，並以 report 回報已下載的位元組數
+func writeBlob(layer v1.Layer, path string, report func(int64)) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
 
-	file, err := os.Open(tarPath)
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if _, err := io.Copy(f, newProgressReader(rc, report)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	tarReader := tar.NewReader(file)
+// writeImageMetadata 將映像原始的 manifest 與 config 寫入映像目錄
+func (m *Manager) writeImageMetadata(img v1.Image, imageID string) error {
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return fmt.Errorf("獲取映像 manifest 失敗: %w", err)
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return fmt.Errorf("獲取映像 config 失敗: %w", err)
+	}
 
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	imageStorePath := filepath.Join(m.storageDir, imageID)
+	if err := os.MkdirAll(imageStorePath, 0755); err != nil {
+		return fmt.Errorf("建立映像儲存目錄 %s 失敗: %w", imageStorePath, err)
+	}
+	if err := os.WriteFile(filepath.Join(imageStorePath, imageManifestFile), rawManifest, 0644); err != nil {
+		return fmt.Errorf("寫入映像 manifest 失敗: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(imageStorePath, imageConfigFile), rawConfig, 0644); err != nil {
+		return fmt.Errorf("寫入映像 config 失敗: %w", err)
+	}
 
-		target := filepath.Join(destPath, header.Name)
+	// 移除舊版扁平化儲存留下的檔案
+	_ = os.Remove(filepath.Join(imageStorePath, "image.tar"))
+	_ = os.RemoveAll(filepath.Join(imageStorePath, legacyRootfsDir))
+	return nil
+}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			_ = os.MkdirAll(target, os.FileMode(header.Mode))
-		case tar.TypeReg:
-			outFile, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return err
+// updateManifest 讀取、更新並寫回 manifest.json
+func (m *Manager) updateManifest(entry types.ImageManifest) error {
+	return m.modifyManifest(func(manifests []types.ImageManifest) ([]types.ImageManifest, error) {
+		// 檢查 tag 是否已存在，如果存在則更新，否則新增
+		for i := range manifests {
+			if manifests[i].RepoTag == entry.RepoTag {
+				manifests[i] = entry
+				return manifests, nil
 			}
-			_, _ = io.Copy(outFile, tarReader)
-			outFile.Close()
-		case tar.TypeSymlink:
-			_ = os.Symlink(header.Linkname, target)
 		}
-	}
-	return nil
+		return append(manifests, entry), nil
+	})
 }
 
-// List 列出本地映像
-func (m *Manager) ListImages() ([]string, error) {
-	// 讀取 manifest 檔案的內容
-	content, err := os.ReadFile(config.ManifestPath)
+// modifyManifest 在鎖定的狀態下讀取 manifest.json，交由 fn 修改後以原子方式寫回
+// fn 回傳錯誤時不會寫入任何變更
+func (m *Manager) modifyManifest(fn func([]types.ImageManifest) ([]types.ImageManifest, error)) error {
+	m.manifestMu.Lock()
+	defer m.manifestMu.Unlock()
+
+	manifestPath := filepath.Join(m.storageDir, "manifest.json")
+
+	// 讀取現有 manifest，如果不存在則建立一個空的
+	manifests, err := readManifestIndex(manifestPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
-		return nil, err
+		return err
+	}
+
+	manifests, err = fn(manifests)
+	if err != nil {
+		return err
+	}
+
+	// 將更新後的內容寫入暫存檔，再以 rename 取代原檔，避免讀取端看到寫到一半的內容
+	newData, err := json.MarshalIndent(manifests, "", "    ")
+	if err != nil {
+		return fmt.Errorf("序列化 manifest 失敗: %w", err)
+	}
+	tmp, err := os.CreateTemp(m.storageDir, "manifest-*.json.tmp")
+	if err != nil {
+		return fmt.Errorf("建立 manifest 暫存檔失敗: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(newData); err != nil {
+		tmp.Close()
+		return fmt.Errorf("寫入 manifest 暫存檔失敗: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), manifestPath)
+}
 
-	// 解析 JSON 內容
-	var entries []types.ImageManifest
-	if err := json.Unmarshal(content, &entries); err != nil {
+// ListImages 列出本地映像，沒有 tag 的映像 (dangling) 也會列出，其 RepoTag 為空
+func (m *Manager) ListImages() ([]types.ImageManifest, error) {
+	entries, err := readManifestIndex(storeManifestPath)
+	if err != nil {
 		return nil, err
 	}
 
-	// 提取並回傳映像名稱列表
-	var images []string
+	images := make([]types.ImageManifest, 0, len(entries))
+	tagged := map[string]bool{}
 	for _, entry := range entries {
-		images = append(images, entry.RepoTag)
+		tagged[entry.ImageID] = true
+		images = append(images, entry)
 	}
 
+	// 沒有 tag 的映像也要列出，但被其他映像當作基礎的建置中間映像除外
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return nil, err
+	}
+	children, err := m.imageChildren()
+	if err != nil {
+		return nil, err
+	}
+	for _, imageID := range imageIDs {
+		if !tagged[imageID] && len(children[imageID]) == 0 {
+			images = append(images, types.ImageManifest{ImageID: imageID})
+		}
+	}
+
+	// 補上建立時間，舊版的記錄也補上大小
+	sizes := map[string]int64{}
+	for i := range images {
+		image := &images[i]
+		if cfg, err := ReadImageConfig(image.ImageID); err == nil {
+			image.Created = cfg.Created.Time
+			if image.Platform == "" {
+				image.Platform = ConfigPlatform(cfg)
+			}
+		}
+		if image.Size != 0 {
+			continue
+		}
+		size, ok := sizes[image.ImageID]
+		if !ok {
+			size, _ = imageSize(image.ImageID)
+			sizes[image.ImageID] = size
+		}
+		image.Size = size
+	}
 	return images, nil
 }
 
@@ -0,0 +1,93 @@
+// internal/image/platform.go
+package image
+
+import (
+	"fmt"
+	"runtime"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// HostPlatform 回傳目前主機的平台，例如 linux/amd64 或 linux/arm64/v8
+func HostPlatform() v1.Platform {
+	platform := v1.Platform{OS: "linux", Architecture: runtime.GOARCH}
+	if runtime.GOARCH == "arm64" {
+		platform.Variant = "v8"
+	}
+	return platform
+}
+
+// ParsePlatform 解析 os/arch[/variant] 格式的平台，空字串代表目前主機的平台
+func ParsePlatform(s string) (v1.Platform, error) {
+	if s == "" {
+		return HostPlatform(), nil
+	}
+	platform, err := v1.ParsePlatform(s)
+	if err != nil {
+		return v1.Platform{}, fmt.Errorf("無效的平台 %q: %w", s, err)
+	}
+	if platform.OS == "" || platform.Architecture == "" {
+		return v1.Platform{}, fmt.Errorf("無效的平台 %q: 格式為 os/arch[/variant]", s)
+	}
+	return *platform, nil
+}
+
+// ConfigPlatform 回傳映像 config 中記錄的平台，沒有記錄時回傳空字串
+func ConfigPlatform(cfg *v1.ConfigFile) string {
+	if cfg == nil || cfg.Architecture == "" {
+		return ""
+	}
+	platform := v1.Platform{OS: cfg.OS, Architecture: cfg.Architecture, Variant: cfg.Variant}
+	if platform.OS == "" {
+		platform.OS = "linux"
+	}
+	return platform.String()
+}
+
+// PlatformMatches 比對兩個平台，variant 只在雙方都有指定時才比較
+// arm64 沒有 variant 時視為 v8
+func PlatformMatches(want, have v1.Platform) bool {
+	if want.OS != have.OS || want.Architecture != have.Architecture {
+		return false
+	}
+	wantVariant, haveVariant := normalizeVariant(want), normalizeVariant(have)
+	return wantVariant == "" || haveVariant == "" || wantVariant == haveVariant
+}
+
+func normalizeVariant(p v1.Platform) string {
+	if p.Architecture == "arm64" && p.Variant == "" {
+		return "v8"
+	}
+	return p.Variant
+}
+
+// CheckPlatform 檢查映像的平台
+// 指定 requested 時不符合會回傳錯誤；未指定時只在映像與主機平台不同時提出警告
+func CheckPlatform(cfg *v1.ConfigFile, requested string) error {
+	have := ConfigPlatform(cfg)
+	if have == "" {
+		// 舊版或沒有平台資訊的映像無法檢查
+		return nil
+	}
+	havePlatform, err := ParsePlatform(have)
+	if err != nil {
+		return err
+	}
+
+	if requested != "" {
+		want, err := ParsePlatform(requested)
+		if err != nil {
+			return err
+		}
+		if !PlatformMatches(want, havePlatform) {
+			return fmt.Errorf("映像的平台為 %s，與要求的 %s 不符", have, want.String())
+		}
+		return nil
+	}
+
+	if host := HostPlatform(); !PlatformMatches(host, havePlatform) {
+		logrus.Warnf("映像的平台 (%s) 與主機的平台 (%s) 不同，容器可能無法執行", have, host.String())
+	}
+	return nil
+}
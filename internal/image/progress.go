@@ -0,0 +1,185 @@
+// internal/image/progress.go
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"gocker/internal/types"
+)
+
+// progressInterval 為同一個 layer 回報下載或解壓縮進度的最短間隔
+const progressInterval = 100 * time.Millisecond
+
+// ProgressFunc 接收 pull 的進度事件，nil 表示不需要進度
+type ProgressFunc func(types.ProgressEvent)
+
+func (p ProgressFunc) emit(ev types.ProgressEvent) {
+	if p != nil {
+		p(ev)
+	}
+}
+
+// progressReader 在讀取時依照 progressInterval 回報已讀取的位元組數
+type progressReader struct {
+	r       io.Reader
+	current int64
+	last    time.Time
+	report  func(current int64)
+}
+
+func newProgressReader(r io.Reader, report func(current int64)) *progressReader {
+	return &progressReader{r: r, last: time.Now(), report: report}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.current += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.report(p.current)
+	}
+	return n, err
+}
+
+// pullJob 為一個進行中的 pull，相同映像的請求會共用同一個 pullJob
+type pullJob struct {
+	mu          sync.Mutex
+	subscribers []*subscriber
+	// history 記錄整個映像的事件與每個 layer 最新的事件，讓中途加入的請求先看到目前的狀態
+	history []types.ProgressEvent
+	layers  map[string]int
+
+	done chan struct{}
+	err  error
+}
+
+func newPullJob() *pullJob {
+	return &pullJob{layers: map[string]int{}, done: make(chan struct{})}
+}
+
+// subscribe 加入一個接收進度的請求，並先重播目前為止的狀態
+// 回傳的 subscriber 在 pull 結束後必須呼叫 close，progress 為 nil 時回傳 nil
+func (j *pullJob) subscribe(progress ProgressFunc) *subscriber {
+	if progress == nil {
+		return nil
+	}
+	sub := newSubscriber(progress)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, ev := range j.history {
+		sub.push(ev)
+	}
+	j.subscribers = append(j.subscribers, sub)
+	return sub
+}
+
+// publish 將事件交給所有等待此 pull 的請求，在鎖內加入以保持事件的順序
+// 事件由每個請求各自的 goroutine 送出，客戶端讀取緩慢時不會拖慢下載或其他請求
+func (j *pullJob) publish(ev types.ProgressEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if i, ok := j.layers[ev.ID]; ok && ev.ID != "" {
+		j.history[i] = ev
+	} else {
+		if ev.ID != "" {
+			j.layers[ev.ID] = len(j.history)
+		}
+		j.history = append(j.history, ev)
+	}
+	for _, sub := range j.subscribers {
+		sub.push(ev)
+	}
+}
+
+// subscriber 以獨立的 goroutine 將進度事件傳給一個請求
+// 尚未送出的事件中，同一個 layer 只保留最新的一個，因此不論客戶端多慢，佔用的記憶體都不會超過 layer 的數量
+type subscriber struct {
+	progress ProgressFunc
+
+	mu      sync.Mutex
+	pending []types.ProgressEvent
+	layers  map[string]int
+	closed  bool
+
+	notify chan struct{}
+	done   chan struct{}
+}
+
+func newSubscriber(progress ProgressFunc) *subscriber {
+	s := &subscriber{
+		progress: progress,
+		layers:   map[string]int{},
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// push 加入一個待送出的事件，不會等待事件送出
+func (s *subscriber) push(ev types.ProgressEvent) {
+	s.mu.Lock()
+	if i, ok := s.layers[ev.ID]; ok && ev.ID != "" {
+		s.pending[i] = ev
+	} else {
+		if ev.ID != "" {
+			s.layers[ev.ID] = len(s.pending)
+		}
+		s.pending = append(s.pending, ev)
+	}
+	s.mu.Unlock()
+	s.wake()
+}
+
+// close 等待所有待送出的事件送出後結束 goroutine
+func (s *subscriber) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.wake()
+	<-s.done
+}
+
+func (s *subscriber) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+	for range s.notify {
+		s.mu.Lock()
+		events, closed := s.pending, s.closed
+		s.pending, s.layers = nil, map[string]int{}
+		s.mu.Unlock()
+
+		for _, ev := range events {
+			s.progress(ev)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// pullKey 回傳判斷兩個 pull 請求能否共用的 key
+// 不同的憑證不能共用，避免沒有權限的使用者借用其他人的 pull 取得映像
+func pullKey(repoTag string, req *types.PullRequest) string {
+	key := repoTag + "|" + req.Platform
+	if req.Auth != nil {
+		data, _ := json.Marshal(req.Auth)
+		sum := sha256.Sum256(data)
+		key += "|" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
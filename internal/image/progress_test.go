@@ -0,0 +1,75 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"gocker/internal/types"
+)
+
+func TestPullJobSlowSubscriber(t *testing.T) {
+	job := newPullJob()
+
+	// 1. 一個不讀取的客戶端不會擋住 publish 與其他請求
+	release := make(chan struct{})
+	var slow []types.ProgressEvent
+	slowSub := job.subscribe(func(ev types.ProgressEvent) {
+		<-release
+		slow = append(slow, ev)
+	})
+	var fast []types.ProgressEvent
+	fastSub := job.subscribe(func(ev types.ProgressEvent) {
+		fast = append(fast, ev)
+	})
+
+	published := make(chan struct{})
+	go func() {
+		job.publish(types.ProgressEvent{Status: "Pulling from library/app"})
+		for i := int64(1); i <= 1000; i++ {
+			job.publish(types.ProgressEvent{Status: "Downloading", ID: "layer1", Current: i, Total: 1000})
+		}
+		job.publish(types.ProgressEvent{Status: "Pull complete", ID: "layer1"})
+		job.publish(types.ProgressEvent{Status: "Downloaded newer image"})
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish 被緩慢的客戶端擋住")
+	}
+
+	fastSub.close()
+	if len(fast) == 0 || fast[len(fast)-1].Status != "Downloaded newer image" {
+		t.Errorf("其他請求應該收到最後的事件，得到 %v", fast)
+	}
+
+	// 2. 緩慢的客戶端最後仍會依序收到每個 layer 最新的狀態
+	close(release)
+	slowSub.close()
+	if len(slow) > 4 {
+		t.Errorf("尚未送出的進度應該被合併，收到 %d 個事件", len(slow))
+	}
+	var statuses []string
+	for _, ev := range slow[1:] {
+		statuses = append(statuses, ev.Status)
+	}
+	if got := statuses[len(statuses)-2:]; got[0] != "Pull complete" || got[1] != "Downloaded newer image" {
+		t.Errorf("事件的順序錯誤: %v", statuses)
+	}
+}
+
+func TestPullJobReplayHistory(t *testing.T) {
+	job := newPullJob()
+	job.publish(types.ProgressEvent{Status: "Pulling from library/app"})
+	job.publish(types.ProgressEvent{Status: "Downloading", ID: "layer1", Current: 10})
+	job.publish(types.ProgressEvent{Status: "Downloading", ID: "layer1", Current: 20})
+
+	var got []types.ProgressEvent
+	sub := job.subscribe(func(ev types.ProgressEvent) { got = append(got, ev) })
+	job.publish(types.ProgressEvent{Status: "Downloaded newer image"})
+	sub.close()
+
+	if len(got) != 3 || got[1].Current != 20 || got[2].Status != "Downloaded newer image" {
+		t.Errorf("中途加入的請求應該先收到目前的狀態，得到 %v", got)
+	}
+}
@@ -0,0 +1,80 @@
+// internal/image/push.go
+package image
+
+import (
+	"fmt"
+
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// PushImage 以本地儲存的 manifest、config 與 layer 重建映像並推送到遠端倉庫 (gocker push)
+// req.Insecure 為 true 時允許使用未加密的 HTTP 連線，回傳推送後的 manifest digest
+func (m *Manager) PushImage(req *types.PushRequest) (string, error) {
+	var opts []name.Option
+	if req.Insecure || m.isInsecure(registryOf(req.Image)) {
+		opts = append(opts, name.Insecure)
+	}
+	ref, err := name.NewTag(req.Image, opts...)
+	if err != nil {
+		return "", fmt.Errorf("無效的映像名稱 %q (推送時必須指定 tag): %w", req.Image, err)
+	}
+	repoTag := FamiliarString(ref)
+
+	entry, err := LookupImage(repoTag)
+	if err != nil {
+		return "", fmt.Errorf("%w (請先使用 'gocker tag' 建立要推送的名稱)", err)
+	}
+	log := logrus.WithFields(logrus.Fields{"image": repoTag, "imageID": entry.ImageID[:12]})
+
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	img, err := StoredImage(entry.ImageID)
+	if err != nil {
+		return "", err
+	}
+
+	// remote.Write 會先檢查倉庫中已存在的 blob，只上傳缺少的 layer
+	log.Info("正在推送映像...")
+	remoteOpts, err := m.remoteOptions(ref.Context().Registry, req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if err := remote.Write(ref, img, remoteOpts...); err != nil {
+		return "", fmt.Errorf("推送映像 %s 失敗: %w", repoTag, registryError(err, ref, req.Auth))
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	// 記錄映像在倉庫中的 digest，images --digests 會顯示
+	err = m.modifyManifest(func(manifests []types.ImageManifest) ([]types.ImageManifest, error) {
+		for i := range manifests {
+			if manifests[i].RepoTag == repoTag {
+				manifests[i].Digest = digest.String()
+			}
+		}
+		return manifests, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("更新 manifest.json 失敗: %w", err)
+	}
+
+	log.WithField("digest", digest.String()).Info("映像推送完成")
+	return digest.String(), nil
+}
+
+// registryOf 回傳映像名稱中的倉庫位址，無法解析時回傳空字串
+func registryOf(imageName string) string {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return ""
+	}
+	return ref.Context().RegistryStr()
+}
@@ -0,0 +1,142 @@
+package image
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// useTempStore 將映像儲存位置改為暫存目錄，並回傳使用該目錄的 Manager
+func useTempStore(t *testing.T) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	origImages, origLayers, origManifest := storeImagesDir, storeLayersDir, storeManifestPath
+	storeImagesDir = filepath.Join(dir, "images")
+	storeLayersDir = filepath.Join(storeImagesDir, "layers")
+	storeManifestPath = filepath.Join(storeImagesDir, "manifest.json")
+	t.Cleanup(func() {
+		storeImagesDir, storeLayersDir, storeManifestPath = origImages, origLayers, origManifest
+	})
+	return NewManager()
+}
+
+func TestPushPullRoundTrip(t *testing.T) {
+	// 解壓縮 layer 時會設定檔案的擁有者
+	requireRoot(t)
+	m := useTempStore(t)
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// 1. 準備來源映像並直接寫入倉庫
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS, cfg.Architecture = runtime.GOOS, runtime.GOARCH
+	cfg.Config.Cmd = []string{"/bin/true"}
+	if img, err = mutate.ConfigFile(img, cfg); err != nil {
+		t.Fatal(err)
+	}
+	source := host + "/source/app:v1"
+	sourceRef, err := name.NewTag(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(sourceRef, img); err != nil {
+		t.Fatalf("寫入來源映像失敗: %v", err)
+	}
+	wantDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2. 拉取、重新命名後推送到另一個 repository
+	if err := m.PullImage(&types.PullRequest{Image: source}, nil); err != nil {
+		t.Fatalf("PullImage 失敗: %v", err)
+	}
+	target := host + "/pushed/app:v2"
+	if err := m.TagImage(source, target); err != nil {
+		t.Fatalf("TagImage 失敗: %v", err)
+	}
+	digest, err := m.PushImage(&types.PushRequest{Image: target})
+	if err != nil {
+		t.Fatalf("PushImage 失敗: %v", err)
+	}
+	if digest != wantDigest.String() {
+		t.Errorf("推送後的 digest = %s, want %s (重建的映像應該與原本的完全相同)", digest, wantDigest)
+	}
+	entry, err := LookupImage(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Digest != digest {
+		t.Errorf("manifest.json 中記錄的 digest = %s, want %s", entry.Digest, digest)
+	}
+
+	// 3. 倉庫中的映像與原本的映像相同
+	targetRef, err := name.NewTag(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := remote.Image(targetRef)
+	if err != nil {
+		t.Fatalf("從倉庫讀取推送的映像失敗: %v", err)
+	}
+	if got, err := pushed.Digest(); err != nil || got != wantDigest {
+		t.Errorf("倉庫中的 digest = %v, %v, want %s", got, err, wantDigest)
+	}
+	layers, err := pushed.Layers()
+	if err != nil || len(layers) != 3 {
+		t.Fatalf("倉庫中的映像應該有 3 個 layer，得到 %d, %v", len(layers), err)
+	}
+
+	// 4. 從新的 repository 拉回時得到相同的映像
+	m2 := useTempStore(t)
+	if err := m2.PullImage(&types.PullRequest{Image: target}, nil); err != nil {
+		t.Fatalf("拉取推送的映像失敗: %v", err)
+	}
+	pulled, err := LookupImage(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pulled.ImageID != entry.ImageID {
+		t.Errorf("拉回的 ImageID = %s, want %s", pulled.ImageID, entry.ImageID)
+	}
+	pulledCfg, err := ReadImageConfig(pulled.ImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pulledCfg.Config.Cmd) != 1 || pulledCfg.Config.Cmd[0] != "/bin/true" {
+		t.Errorf("拉回的映像 Cmd = %v", pulledCfg.Config.Cmd)
+	}
+}
+
+func TestPushRequiresLocalImage(t *testing.T) {
+	m := useTempStore(t)
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	target := strings.TrimPrefix(server.URL, "http://") + "/missing/app:v1"
+	if _, err := m.PushImage(&types.PushRequest{Image: target}); err == nil {
+		t.Errorf("推送不存在的映像應該回傳錯誤")
+	}
+}
@@ -0,0 +1,67 @@
+// internal/image/reference.go
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ParseReference 以 go-containerregistry 的 name 套件解析映像參照
+// 支援 registry:5000/app:v1 與 repo@sha256:... 等格式，沒有指定 tag 時預設為 latest
+func ParseReference(ref string) (name.Reference, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("無效的映像參照 %q: %w", ref, err)
+	}
+	return r, nil
+}
+
+// FamiliarName 回傳 repository 的簡短名稱，Docker Hub 的映像會省略 registry 與 "library/" 前綴
+func FamiliarName(repo name.Repository) string {
+	if repo.RegistryStr() == name.DefaultRegistry {
+		return strings.TrimPrefix(repo.RepositoryStr(), "library/")
+	}
+	return repo.Name()
+}
+
+// FamiliarString 回傳參照儲存在 manifest.json 中的形式，例如 alpine:latest 或 alpine@sha256:...
+func FamiliarString(ref name.Reference) string {
+	repo := FamiliarName(ref.Context())
+	switch r := ref.(type) {
+	case name.Digest:
+		return repo + "@" + r.DigestStr()
+	case name.Tag:
+		return repo + ":" + r.TagStr()
+	default:
+		return ref.String()
+	}
+}
+
+// NormalizeReference 解析參照並回傳其簡短形式，讓 alpine、alpine:latest 與
+// docker.io/library/alpine:latest 對應到同一個映像
+func NormalizeReference(ref string) (string, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	return FamiliarString(r), nil
+}
+
+// SplitReference 將參照拆成名稱與 tag，digest 參照的 tag 為 "sha256:..."
+func SplitReference(ref string) (string, string, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return "", "", err
+	}
+	return FamiliarName(r.Context()), r.Identifier(), nil
+}
+
+// JoinReference 為 SplitReference 的反向操作
+func JoinReference(repo, tag string) string {
+	if strings.Contains(tag, ":") {
+		return repo + "@" + tag
+	}
+	return repo + ":" + tag
+}
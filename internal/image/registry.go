@@ -0,0 +1,250 @@
+// internal/image/registry.go
+package image
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// registryConfig 為解析後的倉庫設定
+type registryConfig struct {
+	mirrors       []mirror
+	insecureHosts map[string]bool
+	insecureNets  []*net.IPNet
+	certsDir      string
+}
+
+// mirror 為 Docker Hub 的鏡像倉庫
+type mirror struct {
+	host     string
+	insecure bool // 以 http:// 指定的鏡像
+}
+
+// endpoint 為拉取映像時嘗試的來源
+type endpoint struct {
+	ref    name.Reference
+	mirror bool
+}
+
+// ConfigureRegistries 套用 daemon 設定檔中的鏡像、不安全倉庫與 CA 目錄設定
+func (m *Manager) ConfigureRegistries(cfg *config.DaemonConfig) error {
+	rc := &registryConfig{
+		insecureHosts: map[string]bool{},
+		certsDir:      cfg.CertsDir,
+	}
+
+	for _, entry := range cfg.InsecureRegistries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			rc.insecureNets = append(rc.insecureNets, ipNet)
+			continue
+		}
+		host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(entry, "http://"), "https://"), "/")
+		if host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("無效的 insecure-registries 設定: %q", entry)
+		}
+		rc.insecureHosts[host] = true
+	}
+
+	for _, raw := range cfg.RegistryMirrors {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("無效的 registry-mirrors 設定 %q: 必須是 http:// 或 https:// 開頭的網址", raw)
+		}
+		if u.Path != "" && u.Path != "/" {
+			return fmt.Errorf("無效的 registry-mirrors 設定 %q: 不支援路徑", raw)
+		}
+		rc.mirrors = append(rc.mirrors, mirror{host: u.Host, insecure: u.Scheme == "http"})
+	}
+
+	m.registry = rc
+	return nil
+}
+
+// RegistryTransport 依照 daemon 設定檔建立存取倉庫 host 的 HTTP transport，並回傳該倉庫是否列在 insecure-registries 中
+// 供不經過 daemon 的命令 (gocker login) 使用，與 pull/push 套用相同的 TLS 設定
+func RegistryTransport(cfg *config.DaemonConfig, host string) (http.RoundTripper, bool, error) {
+	m := &Manager{}
+	if err := m.ConfigureRegistries(cfg); err != nil {
+		return nil, false, err
+	}
+	tr, err := m.registryTransport(host)
+	if err != nil {
+		return nil, false, err
+	}
+	return tr, m.isInsecure(host), nil
+}
+
+// pullEndpoints 回傳拉取映像時依序嘗試的來源，Docker Hub 的映像會先嘗試鏡像，最後才是原始倉庫
+func (m *Manager) pullEndpoints(ref name.Reference) ([]endpoint, error) {
+	origin, err := m.withRegistryOptions(ref)
+	if err != nil {
+		return nil, err
+	}
+	if m.registry == nil || ref.Context().RegistryStr() != name.DefaultRegistry {
+		return []endpoint{{ref: origin}}, nil
+	}
+
+	var endpoints []endpoint
+	for _, mir := range m.registry.mirrors {
+		var opts []name.Option
+		if mir.insecure || m.isInsecure(mir.host) {
+			opts = append(opts, name.Insecure)
+		}
+		repo, err := name.NewRepository(mir.host+"/"+ref.Context().RepositoryStr(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("建立鏡像 %s 的參照失敗: %w", mir.host, err)
+		}
+
+		var mirrorRef name.Reference
+		if digest, ok := ref.(name.Digest); ok {
+			mirrorRef = repo.Digest(digest.DigestStr())
+		} else {
+			mirrorRef = repo.Tag(ref.Identifier())
+		}
+		endpoints = append(endpoints, endpoint{ref: mirrorRef, mirror: true})
+	}
+	return append(endpoints, endpoint{ref: origin}), nil
+}
+
+// withRegistryOptions 為設定成 insecure 的倉庫加上 name.Insecure，允許退回 HTTP
+func (m *Manager) withRegistryOptions(ref name.Reference) (name.Reference, error) {
+	if !m.isInsecure(ref.Context().RegistryStr()) {
+		return ref, nil
+	}
+	return name.ParseReference(ref.String(), name.Insecure)
+}
+
+// isInsecure 檢查倉庫是否列在 insecure-registries 中
+func (m *Manager) isInsecure(host string) bool {
+	if m.registry == nil {
+		return false
+	}
+	if m.registry.insecureHosts[host] {
+		return true
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		for _, ipNet := range m.registry.insecureNets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remoteOptions 建立存取倉庫的選項
+// 憑證只會送往請求中指定的倉庫，鏡像一律以匿名身分存取，避免把憑證洩漏給其他倉庫
+func (m *Manager) remoteOptions(reg name.Registry, auth *types.RegistryAuth) ([]remote.Option, error) {
+	authenticator := authn.Anonymous
+	if auth != nil {
+		authenticator = authn.FromConfig(authn.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+			RegistryToken: auth.RegistryToken,
+		})
+	}
+
+	tr, err := m.registryTransport(reg.RegistryStr())
+	if err != nil {
+		return nil, err
+	}
+	return []remote.Option{remote.WithAuth(authenticator), remote.WithTransport(tr)}, nil
+}
+
+// registryTransport 依照倉庫的設定建立 HTTP transport
+// insecure 的倉庫不驗證 TLS 憑證；<certs-dir>/<host>/ 中的 *.crt 會加入信任的 CA，
+// *.cert 與同名的 *.key 則作為用戶端憑證
+func (m *Manager) registryTransport(host string) (http.RoundTripper, error) {
+	base, ok := remote.DefaultTransport.(*http.Transport)
+	if !ok {
+		return remote.DefaultTransport, nil
+	}
+	tr := base.Clone()
+	if m.registry == nil {
+		return tr, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if m.isInsecure(host) {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	certDir := filepath.Join(m.registry.certsDir, host)
+	entries, err := os.ReadDir(certDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("讀取憑證目錄 %s 失敗: %w", certDir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(certDir, entry.Name())
+		switch filepath.Ext(entry.Name()) {
+		case ".crt":
+			if tlsConfig.RootCAs == nil {
+				if tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil {
+					tlsConfig.RootCAs = x509.NewCertPool()
+				}
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("無法解析 CA 憑證 %s", path)
+			}
+		case ".cert":
+			keyPath := strings.TrimSuffix(path, ".cert") + ".key"
+			cert, err := tls.LoadX509KeyPair(path, keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("讀取用戶端憑證 %s 失敗: %w", path, err)
+			}
+			tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+		}
+	}
+
+	tr.TLSClientConfig = tlsConfig
+	return tr, nil
+}
+
+// registryError 將倉庫回傳的認證錯誤轉換為清楚的說明
+func registryError(err error, ref name.Reference, auth *types.RegistryAuth) error {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return err
+	}
+
+	denied := terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden
+	for _, diag := range terr.Errors {
+		if diag.Code == transport.UnauthorizedErrorCode || diag.Code == transport.DeniedErrorCode {
+			denied = true
+		}
+	}
+	if !denied {
+		return err
+	}
+
+	registry := ref.Context().RegistryStr()
+	if auth == nil {
+		return fmt.Errorf("存取 %s 被拒絕: 映像不存在或需要登入，請確認名稱或執行 'gocker login %s': %w", ref, registry, err)
+	}
+	return fmt.Errorf("存取 %s 被拒絕: 使用者 %q 的憑證無效或沒有權限，請重新執行 'gocker login %s': %w", ref, auth.Username, registry, err)
+}
@@ -0,0 +1,481 @@
+// internal/image/remove.go
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sirupsen/logrus"
+)
+
+// RemoveImage 刪除映像 (gocker rmi)
+// 以 name:tag 指定時只移除該 tag，最後一個 tag 被移除時才會刪除映像資料；
+// 以 ID 指定時會移除所有 tag。正在被容器使用的映像需要 force 才能移除 tag，
+// 且映像資料會保留到沒有容器使用為止；運行中容器使用的映像無法移除
+func (m *Manager) RemoveImage(ref string, force bool) (*types.ImageDeleteReport, error) {
+	unlock, err := m.lockGC()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	report := &types.ImageDeleteReport{}
+	var deleteID string
+
+	err = m.modifyManifest(func(manifests []types.ImageManifest) ([]types.ImageManifest, error) {
+		imageID, byTag, err := resolveImageRef(manifests, ref)
+		if err != nil {
+			return nil, err
+		}
+		tags := tagsOf(manifests, imageID)
+
+		var untag []string
+		if byTag {
+			untag = []string{normalizeRepoTag(ref)}
+		} else {
+			if len(tags) > 1 && !force {
+				return nil, fmt.Errorf("映像 %s 被多個 tag 引用 (%s)，請使用 -f 強制刪除", imageID, strings.Join(tags, ", "))
+			}
+			untag = tags
+		}
+
+		// 只有移除最後一個 tag 時才需要檢查容器的引用
+		lastRef := len(tags) <= len(untag)
+		if lastRef {
+			if m.pinned(imageID) {
+				return nil, fmt.Errorf("映像 %s 正在被建置使用，無法刪除", imageID)
+			}
+			running, stopped, err := containersUsing(imageID, tags)
+			if err != nil {
+				return nil, err
+			}
+			if len(running) > 0 {
+				return nil, fmt.Errorf("映像 %s 正在被運行中的容器使用 (%s)，無法刪除", imageID, strings.Join(running, ", "))
+			}
+			if len(stopped) > 0 {
+				if !force {
+					return nil, fmt.Errorf("映像 %s 正在被已停止的容器使用 (%s)，請先刪除容器或使用 -f", imageID, strings.Join(stopped, ", "))
+				}
+				logrus.Warnf("映像 %s 仍被容器 %s 使用，只移除 tag 並保留映像資料", imageID, strings.Join(stopped, ", "))
+			} else if children, err := m.imageChildren(); err != nil {
+				return nil, err
+			} else if len(children[imageID]) > 0 {
+				// 其他映像以此映像為基礎建置時，只移除 tag，映像資料成為中間映像
+				logrus.Infof("映像 %s 是其他映像的基礎映像，只移除 tag", imageID)
+			} else {
+				deleteID = imageID
+			}
+		}
+
+		manifests = slices.DeleteFunc(manifests, func(entry types.ImageManifest) bool {
+			return entry.ImageID == imageID && slices.Contains(untag, entry.RepoTag)
+		})
+		report.Untagged = untag
+		return manifests, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteID != "" {
+		parent := ImageParent(deleteID)
+		if err := m.deleteImageData(deleteID); err != nil {
+			return report, err
+		}
+		report.Deleted = append(report.Deleted, deleteID)
+
+		// 一併刪除建置時留下、已經沒有用途的中間映像
+		deleted, err := m.deleteUnusedParents(parent)
+		report.Deleted = append(report.Deleted, deleted...)
+		if err != nil {
+			return report, err
+		}
+
+		reclaimed, err := m.gcLayers()
+		report.SpaceReclaimed = reclaimed
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// TagImage 為既有的映像建立新的 tag (gocker tag)
+func (m *Manager) TagImage(source, target string) error {
+	ref, err := ParseReference(target)
+	if err != nil {
+		return err
+	}
+	if _, ok := ref.(name.Tag); !ok {
+		return fmt.Errorf("無法以 digest 作為 tag: %s", target)
+	}
+	target = FamiliarString(ref)
+
+	return m.modifyManifest(func(manifests []types.ImageManifest) ([]types.ImageManifest, error) {
+		imageID, _, err := resolveImageRef(manifests, source)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := types.ImageManifest{RepoTag: target, ImageID: imageID}
+		for _, existing := range manifests {
+			if existing.ImageID == imageID {
+				entry.Size = existing.Size
+				entry.Platform = existing.Platform
+				break
+			}
+		}
+
+		for i := range manifests {
+			if manifests[i].RepoTag == target {
+				manifests[i] = entry
+				return manifests, nil
+			}
+		}
+		return append(manifests, entry), nil
+	})
+}
+
+// PruneImages 刪除沒有 tag 的映像 (dangling)，all 為 true 時也會刪除所有沒有被容器使用的映像
+// until 不是零值時只刪除在此之前建立的映像
+func (m *Manager) PruneImages(all bool, until time.Time) (*types.ImageDeleteReport, error) {
+	unlock, err := m.lockGC()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return m.pruneImages(func(imageID string, tags []string) bool {
+		return (len(tags) == 0 || all) && createdBefore(imageID, until)
+	})
+}
+
+// PruneBuildCache 清除建置快取 (gocker builder prune)
+// 沒有 tag 也沒有被使用的快取映像會被刪除；其餘映像 (例如已加上 tag 的建置結果與它的基礎映像)
+// 會保留，但移除快取 key，之後的建置不會再沿用它們；正在建置中的映像不受影響
+// until 不是零值時只處理在此之前建立的映像
+func (m *Manager) PruneBuildCache(until time.Time) (*types.ImageDeleteReport, error) {
+	unlock, err := m.lockGC()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	report, err := m.pruneImages(func(imageID string, tags []string) bool {
+		return len(tags) == 0 && imageCacheKey(imageID) != "" && createdBefore(imageID, until)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return report, err
+	}
+	// 正在建置中的映像與它的基礎映像保留快取 key，建置結束後仍可以被清除
+	building := map[string]bool{}
+	for _, imageID := range imageIDs {
+		if m.pinned(imageID) {
+			for id := imageID; id != "" && !building[id]; id = ImageParent(id) {
+				building[id] = true
+			}
+		}
+	}
+	for _, imageID := range imageIDs {
+		if building[imageID] || !createdBefore(imageID, until) {
+			continue
+		}
+		path := filepath.Join(m.storageDir, imageID, imageCacheKeyFile)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("移除映像 %s 的快取 key 失敗: %v", imageID, err)
+		}
+	}
+	return report, nil
+}
+
+// pruneImages 刪除 candidate 回傳 true、沒有子映像也沒有被容器使用的映像，並回收 layer
+// 呼叫前必須持有 gcMu 的寫入鎖
+func (m *Manager) pruneImages(candidate func(imageID string, tags []string) bool) (*types.ImageDeleteReport, error) {
+	report := &types.ImageDeleteReport{}
+	var deleteIDs []string
+
+	err := m.modifyManifest(func(manifests []types.ImageManifest) ([]types.ImageManifest, error) {
+		imageIDs, err := m.listImageIDs()
+		if err != nil {
+			return nil, err
+		}
+		children, err := m.imageChildren()
+		if err != nil {
+			return nil, err
+		}
+
+		// 映像被刪除後，它的基礎映像可能也變成可以刪除，因此重複檢查到沒有變化為止
+		deleted := map[string]bool{}
+		for changed := true; changed; {
+			changed = false
+			for _, imageID := range imageIDs {
+				if deleted[imageID] || m.pinned(imageID) {
+					continue
+				}
+				if slices.ContainsFunc(children[imageID], func(child string) bool { return !deleted[child] }) {
+					continue
+				}
+				tags := tagsOf(manifests, imageID)
+				if !candidate(imageID, tags) {
+					continue
+				}
+				running, stopped, err := containersUsing(imageID, tags)
+				if err != nil {
+					return nil, err
+				}
+				if len(running) > 0 || len(stopped) > 0 {
+					continue
+				}
+
+				manifests = slices.DeleteFunc(manifests, func(entry types.ImageManifest) bool {
+					return entry.ImageID == imageID
+				})
+				report.Untagged = append(report.Untagged, tags...)
+				deleteIDs = append(deleteIDs, imageID)
+				deleted[imageID] = true
+				changed = true
+			}
+		}
+		return manifests, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, imageID := range deleteIDs {
+		if err := m.deleteImageData(imageID); err != nil {
+			logrus.Warnf("刪除映像 %s 失敗: %v", imageID, err)
+			continue
+		}
+		report.Deleted = append(report.Deleted, imageID)
+	}
+
+	reclaimed, err := m.gcLayers()
+	report.SpaceReclaimed = reclaimed
+	return report, err
+}
+
+// deleteUnusedParents 從 parent 開始往上刪除沒有 tag、沒有其他子映像也沒有被使用的中間映像
+// 呼叫前必須持有 gcMu 的寫入鎖
+func (m *Manager) deleteUnusedParents(parent string) ([]string, error) {
+	manifests, err := readManifestIndex(filepath.Join(m.storageDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for parent != "" {
+		if len(tagsOf(manifests, parent)) > 0 || m.pinned(parent) {
+			break
+		}
+		children, err := m.imageChildren()
+		if err != nil {
+			return deleted, err
+		}
+		if len(children[parent]) > 0 {
+			break
+		}
+		running, stopped, err := containersUsing(parent, nil)
+		if err != nil {
+			return deleted, err
+		}
+		if len(running) > 0 || len(stopped) > 0 {
+			break
+		}
+
+		next := ImageParent(parent)
+		if err := m.deleteImageData(parent); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, parent)
+		parent = next
+	}
+	return deleted, nil
+}
+
+// deleteImageData 刪除映像的 metadata 目錄，layer 由 gcLayers 另外回收
+func (m *Manager) deleteImageData(imageID string) error {
+	path := filepath.Join(m.storageDir, imageID)
+	logrus.Infof("正在刪除映像 %s", imageID)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("刪除映像目錄 %s 失敗: %w", path, err)
+	}
+	return nil
+}
+
+// gcLayers 刪除沒有被任何映像引用的 layer，回傳回收的空間
+// 呼叫前必須持有 gcMu 的寫入鎖，避免刪除正在 pull 的 layer
+func (m *Manager) gcLayers() (int64, error) {
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	referenced := map[string]bool{}
+	for _, imageID := range imageIDs {
+		manifest, err := ReadImageManifest(imageID)
+		if err != nil {
+			// 舊版扁平化的映像沒有 manifest，也不會引用 layer
+			continue
+		}
+		for _, layer := range manifest.Layers {
+			referenced[layer.Digest.Hex] = true
+		}
+	}
+
+	entries, err := os.ReadDir(m.layersDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var reclaimed int64
+	for _, entry := range entries {
+		if !entry.IsDir() || !isHexID(entry.Name(), 64) || referenced[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(m.layersDir, entry.Name())
+		size, _ := fsutil.DirSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			logrus.Warnf("刪除 layer %s 失敗: %v", entry.Name(), err)
+			continue
+		}
+		removeLayerLink(m.layersDir, entry.Name())
+		logrus.Infof("已刪除 layer %s", entry.Name())
+		reclaimed += size
+	}
+	return reclaimed, nil
+}
+
+// removeLayerLink 刪除指向已刪除 layer 的短名稱連結，短名稱相同但指向其他 layer 的連結會保留
+func removeLayerLink(layersDir, layerID string) {
+	link := filepath.Join(layersDir, LayerLinksDir, LayerShortID(layerID))
+	if target, err := os.Readlink(link); err == nil && target == filepath.Join("..", layerID, layerDiffDir) {
+		_ = os.Remove(link)
+	}
+}
+
+// listImageIDs 列出所有存在於本機的映像 ID (包含沒有 tag 的映像)
+func (m *Manager) listImageIDs() ([]string, error) {
+	entries, err := os.ReadDir(m.storageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() && isHexID(entry.Name(), 0) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// resolveImageRef 以 name:tag、完整 ID 或 ID 前綴尋找映像，回傳映像 ID 以及是否以 tag 指定
+func resolveImageRef(manifests []types.ImageManifest, ref string) (string, bool, error) {
+	repoTag := normalizeRepoTag(ref)
+	for _, entry := range manifests {
+		if entry.RepoTag == repoTag {
+			return entry.ImageID, true, nil
+		}
+	}
+
+	id := strings.TrimPrefix(ref, "sha256:")
+	if isHexID(id, 0) {
+		var matches []string
+		for _, entry := range manifests {
+			if strings.HasPrefix(entry.ImageID, id) && !slices.Contains(matches, entry.ImageID) {
+				matches = append(matches, entry.ImageID)
+			}
+		}
+		if len(matches) == 0 {
+			// 沒有 tag 的映像只存在於儲存目錄中
+			if _, err := os.Stat(ImageDir(id)); err == nil {
+				return id, false, nil
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0], false, nil
+		}
+		if len(matches) > 1 {
+			return "", false, fmt.Errorf("ID 前綴 %s 對應到多個映像，請指定更完整的 ID", ref)
+		}
+	}
+	return "", false, fmt.Errorf("找不到映像: %s", ref)
+}
+
+// tagsOf 回傳映像所有的 tag
+func tagsOf(manifests []types.ImageManifest, imageID string) []string {
+	var tags []string
+	for _, entry := range manifests {
+		if entry.ImageID == imageID {
+			tags = append(tags, entry.RepoTag)
+		}
+	}
+	return tags
+}
+
+// containersUsing 回傳使用指定映像的容器名稱，分為運行中與已停止兩類
+// 舊版容器沒有記錄映像 ID，改用 tag 比對
+func containersUsing(imageID string, tags []string) (running, stopped []string, err error) {
+	containers, err := ListContainers()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	for _, c := range containers {
+		uses := c.ImageID == imageID || (c.ImageID == "" && slices.Contains(tags, c.Image))
+		if !uses {
+			continue
+		}
+		if c.Status == types.Running {
+			running = append(running, c.Name)
+		} else {
+			stopped = append(stopped, c.Name)
+		}
+	}
+	return running, stopped, nil
+}
+
+// normalizeRepoTag 將參照轉換為 manifest.json 中的形式，無法解析時原樣回傳
+func normalizeRepoTag(ref string) string {
+	if normalized, err := NormalizeReference(ref); err == nil {
+		return normalized
+	}
+	return ref
+}
+
+// isHexID 檢查字串是否為小寫十六進位，length 為 0 時不檢查長度
+func isHexID(s string, length int) bool {
+	if s == "" || (length > 0 && len(s) != length) {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+// internal/image/save.go
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ociRefNameAnnotation 為 OCI layout 中記錄 tag 的 annotation
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	// containerdImageNameAnnotation 為 docker/containerd 在 OCI layout 中記錄完整映像名稱的 annotation
+	containerdImageNameAnnotation = "io.containerd.image.name"
+)
+
+// savedImage 為要匯出的映像與其名稱
+type savedImage struct {
+	imageID string
+	img     v1.Image
+	refs    []name.Reference
+}
+
+// SaveImages 將映像匯出成 tar 檔 (gocker save)
+// format 為 docker 時產生與 docker save 相同的格式，為 oci 時產生 OCI image layout
+func (m *Manager) SaveImages(refs []string, output string, format string) error {
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	images, err := m.resolveSaveImages(refs)
+	if err != nil {
+		return err
+	}
+
+	// 先寫入暫存檔，完成後才移到目標路徑，避免留下不完整的 tar 檔
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".gocker-save-*")
+	if err != nil {
+		return fmt.Errorf("建立輸出檔案失敗: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	switch format {
+	case "", types.ImageArchiveDocker:
+		err = writeDockerArchive(tmp, images)
+	case types.ImageArchiveOCI:
+		err = writeOCIArchive(tmp, images)
+	default:
+		err = fmt.Errorf("不支援的格式: %s (只支援 %s 或 %s)", format, types.ImageArchiveDocker, types.ImageArchiveOCI)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), output)
+}
+
+// resolveSaveImages 將參照轉換為要匯出的映像，同一個映像的多個 tag 會合併
+// 以 ID 指定時會匯出映像所有的 tag
+func (m *Manager) resolveSaveImages(refs []string) ([]*savedImage, error) {
+	manifests, err := readManifestIndex(storeManifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*savedImage
+	byID := map[string]*savedImage{}
+	for _, ref := range refs {
+		imageID, byTag, err := resolveImageRef(manifests, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		saved, ok := byID[imageID]
+		if !ok {
+			img, err := StoredImage(imageID)
+			if err != nil {
+				return nil, err
+			}
+			saved = &savedImage{imageID: imageID, img: img}
+			byID[imageID] = saved
+			images = append(images, saved)
+		}
+
+		tags := []string{normalizeRepoTag(ref)}
+		if !byTag {
+			tags = tagsOf(manifests, imageID)
+		}
+		for _, tag := range tags {
+			parsed, err := ParseReference(tag)
+			if err != nil {
+				return nil, err
+			}
+			saved.refs = append(saved.refs, parsed)
+		}
+	}
+	return images, nil
+}
+
+// writeDockerArchive 以 docker save 的格式寫出映像
+func writeDockerArchive(w io.Writer, images []*savedImage) error {
+	refToImage := map[name.Reference]v1.Image{}
+	for _, saved := range images {
+		if len(saved.refs) == 0 {
+			return fmt.Errorf("映像 %s 沒有任何 tag，請改用 --format %s 匯出", saved.imageID, types.ImageArchiveOCI)
+		}
+		for _, ref := range saved.refs {
+			refToImage[ref] = saved.img
+		}
+	}
+
+	if err := tarball.MultiRefWrite(refToImage, w); err != nil {
+		return fmt.Errorf("寫入 docker 格式的 tar 檔失敗: %w", err)
+	}
+	return nil
+}
+
+// writeOCIArchive 先在暫存目錄中建立 OCI image layout，再打包成 tar 檔
+func writeOCIArchive(w io.Writer, images []*savedImage) error {
+	tmpDir, err := os.MkdirTemp("", "gocker-save-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path, err := layout.Write(tmpDir, empty.Index)
+	if err != nil {
+		return fmt.Errorf("建立 OCI layout 失敗: %w", err)
+	}
+	for _, saved := range images {
+		if len(saved.refs) == 0 {
+			if err := path.AppendImage(saved.img); err != nil {
+				return fmt.Errorf("寫入映像 %s 失敗: %w", saved.imageID, err)
+			}
+			continue
+		}
+		// 每個名稱各有一筆 index 記錄，blob 只會寫入一次
+		for _, ref := range saved.refs {
+			annotations := map[string]string{
+				containerdImageNameAnnotation: ref.Name(),
+				ociRefNameAnnotation:          ref.Identifier(),
+			}
+			if err := path.AppendImage(saved.img, layout.WithAnnotations(annotations)); err != nil {
+				return fmt.Errorf("寫入映像 %s 失敗: %w", saved.imageID, err)
+			}
+		}
+	}
+
+	logrus.Debugf("正在打包 OCI layout %s", tmpDir)
+	return tarDirectory(w, tmpDir)
+}
+
+// tarDirectory 將目錄中的內容 (不含目錄本身) 打包成 tar 串流
+func tarDirectory(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("打包 %s 失敗: %w", dir, err)
+	}
+	return tw.Close()
+}
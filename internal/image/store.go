@@ -0,0 +1,316 @@
+// internal/image/store.go
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocker/internal/config"
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+映像儲存結構 (content-addressable)
+
+	/var/lib/gocker/images/
+	├── manifest.json                 # repoTag -> imageID 的索引
+	├── <imageID>/                    # imageID 為 manifest digest 的完整十六進位
+	│   ├── manifest.json             # 映像原始的 OCI/Docker manifest
+	│   └── config.json               # 映像原始的 config
+	└── layers/
+	    ├── <layer digest hex>/
+	    │   ├── blob                  # 下載的壓縮 layer，內容與 digest 相符
+	    │   └── diff/                 # 解壓縮後的 layer 內容，作為 overlay 的 lowerdir
+	    └── l/
+	        └── <short id> -> ../<layer digest hex>/diff  # 由 overlay driver 建立，縮短 lowerdir 的長度
+
+相同 digest 的 layer 只會被下載與解壓縮一次，由所有映像共用
+*/
+const (
+	imageManifestFile = "manifest.json"
+	imageConfigFile   = "config.json"
+	layerBlobFile     = "blob"
+	layerDiffDir      = "diff"
+	storeLockFile     = ".lock" // 跨行程鎖定映像儲存的檔案，見 LockStore
+
+	// legacyRootfsDir 為舊版扁平化儲存的 rootfs 目錄
+	legacyRootfsDir = "rootfs"
+)
+
+// 映像儲存的位置，預設為 config 中的路徑，測試時會改為暫存目錄
+var (
+	storeImagesDir    = config.ImagesDir
+	storeLayersDir    = config.LayersDir
+	storeManifestPath = config.ManifestPath
+)
+
+// LayerLinksDir 為 layers 目錄中存放 layer 短名稱符號連結的子目錄
+const LayerLinksDir = "l"
+
+// layerShortIDLen 為 layer 短名稱的長度 (layer digest 的前幾碼)
+const layerShortIDLen = 16
+
+// LayerShortID 回傳 layer 目錄 (layer digest 的十六進位) 在 LayerLinksDir 中的短名稱
+func LayerShortID(layerID string) string {
+	if len(layerID) <= layerShortIDLen {
+		return layerID
+	}
+	return layerID[:layerShortIDLen]
+}
+
+// ImageDir 回傳映像 metadata 的儲存目錄
+func ImageDir(imageID string) string {
+	return filepath.Join(storeImagesDir, imageID)
+}
+
+// LayerDir 回傳指定 digest 的 layer 儲存目錄
+func LayerDir(digest v1.Hash) string {
+	return filepath.Join(storeLayersDir, digest.Hex)
+}
+
+// LayerDiffPath 回傳 layer 解壓縮後的目錄
+func LayerDiffPath(digest v1.Hash) string {
+	return filepath.Join(LayerDir(digest), layerDiffDir)
+}
+
+// LayerBlobPath 回傳 layer 壓縮檔的路徑
+func LayerBlobPath(digest v1.Hash) string {
+	return filepath.Join(LayerDir(digest), layerBlobFile)
+}
+
+// LookupImage 依照參照在 manifest.json 中尋找映像
+// digest 參照也會比對以 tag 拉取、但 digest 相同的映像
+func LookupImage(ref string) (*types.ImageManifest, error) {
+	parsed, err := ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	repoTag := FamiliarString(parsed)
+
+	manifests, err := readManifestIndex(storeManifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range manifests {
+		if manifests[i].RepoTag == repoTag {
+			return &manifests[i], nil
+		}
+	}
+	if digest, ok := parsed.(name.Digest); ok {
+		repo := FamiliarName(digest.Context())
+		for i := range manifests {
+			if manifests[i].Digest == digest.DigestStr() && repositoryOf(manifests[i].RepoTag) == repo {
+				return &manifests[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("在 manifest 中找不到映像 '%s'", repoTag)
+}
+
+// repositoryOf 回傳 manifest.json 中 repoTag 的名稱部分
+func repositoryOf(repoTag string) string {
+	if i := strings.Index(repoTag, "@"); i >= 0 {
+		return repoTag[:i]
+	}
+	if i := strings.LastIndex(repoTag, ":"); i > strings.LastIndex(repoTag, "/") {
+		return repoTag[:i]
+	}
+	return repoTag
+}
+
+// ReadImageManifest 讀取映像的 OCI/Docker manifest
+func ReadImageManifest(imageID string) (*v1.Manifest, error) {
+	f, err := os.Open(filepath.Join(ImageDir(imageID), imageManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest, err := v1.ParseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("解析映像 %s 的 manifest 失敗: %w", imageID, err)
+	}
+	return manifest, nil
+}
+
+// LayerDirs 回傳映像所有 layer 的目錄，順序為最上層在前，可直接作為 overlay 的 lowerdir
+// 舊版扁平化儲存的映像會回傳單一的 rootfs 目錄
+func LayerDirs(imageID string) ([]string, error) {
+	legacy := filepath.Join(ImageDir(imageID), legacyRootfsDir)
+	if st, err := os.Stat(legacy); err == nil && st.IsDir() {
+		return []string{legacy}, nil
+	}
+
+	manifest, err := ReadImageManifest(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("讀取映像 %s 的 manifest 失敗: %w", imageID, err)
+	}
+
+	dirs := make([]string, 0, len(manifest.Layers))
+	for i := len(manifest.Layers) - 1; i >= 0; i-- {
+		diff := LayerDiffPath(manifest.Layers[i].Digest)
+		if _, err := os.Stat(diff); err != nil {
+			return nil, fmt.Errorf("映像 %s 的 layer %s 不存在: %w", imageID, manifest.Layers[i].Digest, err)
+		}
+		dirs = append(dirs, diff)
+	}
+	return dirs, nil
+}
+
+// readManifestIndex 讀取 manifest.json，檔案不存在時回傳空列表
+func readManifestIndex(manifestPath string) ([]types.ImageManifest, error) {
+	var manifests []types.ImageManifest
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifests, nil
+		}
+		return nil, fmt.Errorf("讀取 manifest.json 失敗: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("解析 manifest.json 失敗: %w", err)
+	}
+	return manifests, nil
+}
+
+// Decompress 依照檔案開頭的 magic number 判斷壓縮格式 (gzip/zstd/未壓縮) 並解壓縮
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// ReadImageConfig 讀取映像的 OCI config，舊版沒有保存 config 的映像會回傳空的 config
+func ReadImageConfig(imageID string) (*v1.ConfigFile, error) {
+	f, err := os.Open(filepath.Join(ImageDir(imageID), imageConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &v1.ConfigFile{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := v1.ParseConfigFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("解析映像 %s 的 config 失敗: %w", imageID, err)
+	}
+	return cfg, nil
+}
+
+// imageSize 計算映像所有 layer 解壓縮後的總大小
+func imageSize(imageID string) (int64, error) {
+	dirs, err := LayerDirs(imageID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, dir := range dirs {
+		size, err := fsutil.DirSize(dir)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// StoredImage 以映像儲存區中的 manifest、config 與 layer 壓縮檔重建 v1.Image
+// 重建的映像與拉取時的 digest 完全相同，可以直接匯出或推送
+func StoredImage(imageID string) (v1.Image, error) {
+	dir := ImageDir(imageID)
+	rawManifest, err := os.ReadFile(filepath.Join(dir, imageManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("映像 %s 為舊版格式或不存在，請重新拉取", imageID)
+		}
+		return nil, err
+	}
+	rawConfig, err := os.ReadFile(filepath.Join(dir, imageConfigFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("解析映像 %s 的 manifest 失敗: %w", imageID, err)
+	}
+	return partial.CompressedToImage(&storedImageCore{
+		manifest:    manifest,
+		rawManifest: rawManifest,
+		rawConfig:   rawConfig,
+	})
+}
+
+// storedImageCore 實作 partial.CompressedImageCore
+type storedImageCore struct {
+	manifest    *v1.Manifest
+	rawManifest []byte
+	rawConfig   []byte
+}
+
+func (i *storedImageCore) RawConfigFile() ([]byte, error) { return i.rawConfig, nil }
+
+func (i *storedImageCore) RawManifest() ([]byte, error) { return i.rawManifest, nil }
+
+func (i *storedImageCore) MediaType() (ggcrtypes.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return ggcrtypes.OCIManifestSchema1, nil
+}
+
+func (i *storedImageCore) LayerByDigest(digest v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.manifest.Layers {
+		if desc.Digest == digest {
+			return &storedLayer{desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("映像中沒有 layer %s", digest)
+}
+
+// storedLayer 實作 partial.CompressedLayer，內容來自 layer store 中的壓縮檔
+type storedLayer struct {
+	desc v1.Descriptor
+}
+
+func (l *storedLayer) Digest() (v1.Hash, error) { return l.desc.Digest, nil }
+
+func (l *storedLayer) Size() (int64, error) { return l.desc.Size, nil }
+
+func (l *storedLayer) MediaType() (ggcrtypes.MediaType, error) { return l.desc.MediaType, nil }
+
+func (l *storedLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(LayerBlobPath(l.desc.Digest))
+}
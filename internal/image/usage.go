@@ -0,0 +1,127 @@
+// internal/image/usage.go
+package image
+
+import (
+	"path/filepath"
+	"time"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+)
+
+// DiskUsage 計算映像與建置快取占用的空間 (gocker system df)，結果只填入映像與建置快取的欄位
+// 沒有 tag 但有快取 key 的中間映像視為建置快取，其餘為映像；同一個 layer 同時被兩者引用時算在映像
+func (m *Manager) DiskUsage() (*types.DiskUsage, error) {
+	m.gcMu.RLock()
+	defer m.gcMu.RUnlock()
+
+	manifests, err := readManifestIndex(filepath.Join(m.storageDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	imageIDs, err := m.listImageIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	type imageLayers struct {
+		usage  types.ImageUsage
+		layers []string
+		cache  bool
+	}
+	layerSizes := map[string]int64{}
+	refs := map[string]int{}
+	var all []imageLayers
+	for _, imageID := range imageIDs {
+		layers, err := LayerDirs(imageID)
+		if err != nil {
+			// 不完整的映像 (例如正在 pull) 不列入計算
+			continue
+		}
+		tags := tagsOf(manifests, imageID)
+		running, stopped, err := containersUsing(imageID, tags)
+		if err != nil {
+			return nil, err
+		}
+		entry := imageLayers{
+			usage: types.ImageUsage{
+				ImageID:    imageID,
+				RepoTags:   tags,
+				Created:    imageCreated(imageID),
+				Containers: len(running) + len(stopped),
+			},
+			layers: layers,
+			cache:  len(tags) == 0 && imageCacheKey(imageID) != "",
+		}
+		for _, layer := range layers {
+			if _, ok := layerSizes[layer]; !ok {
+				layerSizes[layer], _ = fsutil.DirSize(layer)
+			}
+			refs[layer]++
+		}
+		all = append(all, entry)
+	}
+
+	usage := &types.DiskUsage{Images: []types.ImageUsage{}, BuildCache: []types.ImageUsage{}}
+	// 每個 layer 依引用它的映像歸類，並記錄是否有容器正在使用
+	imageLayer := map[string]bool{}
+	inUse := map[string]bool{}
+	for _, entry := range all {
+		for _, layer := range entry.layers {
+			if !entry.cache {
+				imageLayer[layer] = true
+			}
+			if entry.usage.Containers > 0 {
+				inUse[layer] = true
+			}
+		}
+	}
+	for layer, size := range layerSizes {
+		if imageLayer[layer] {
+			usage.ImagesSize += size
+			if !inUse[layer] {
+				usage.ImagesReclaimable += size
+			}
+		} else {
+			usage.BuildCacheSize += size
+			if !inUse[layer] {
+				usage.BuildCacheReclaimable += size
+			}
+		}
+	}
+
+	for _, entry := range all {
+		for _, layer := range entry.layers {
+			entry.usage.Size += layerSizes[layer]
+			if refs[layer] > 1 {
+				entry.usage.SharedSize += layerSizes[layer]
+			}
+		}
+		entry.usage.UniqueSize = entry.usage.Size - entry.usage.SharedSize
+		if entry.cache {
+			usage.BuildCache = append(usage.BuildCache, entry.usage)
+		} else {
+			usage.Images = append(usage.Images, entry.usage)
+		}
+	}
+	return usage, nil
+}
+
+// imageCreated 回傳映像 config 中的建立時間，無法讀取時回傳零值
+func imageCreated(imageID string) time.Time {
+	cfg, err := ReadImageConfig(imageID)
+	if err != nil {
+		return time.Time{}
+	}
+	return cfg.Created.Time
+}
+
+// createdBefore 判斷映像是否在 until 之前建立，until 為零值時一律成立
+// 無法得知建立時間的映像不會被視為符合條件
+func createdBefore(imageID string, until time.Time) bool {
+	if until.IsZero() {
+		return true
+	}
+	created := imageCreated(imageID)
+	return !created.IsZero() && created.Before(until)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -245,6 +246,37 @@ func GetAllocatedIP(containerID string) (string, error) {
 	return ip, nil
 }
 
+// PruneIPAllocations releases the IPs held by containers for which inUse returns
+// false, e.g. allocations leaked by containers that were removed while running.
+// It returns the released addresses.
+func PruneIPAllocations(inUse func(containerID string) bool) ([]string, error) {
+	ipamMu.Lock()
+	defer ipamMu.Unlock()
+
+	state, err := loadIPAllocationState()
+	if err != nil {
+		return nil, err
+	}
+
+	var released []string
+	for containerID, ip := range state.ContainerToIP {
+		if inUse(containerID) {
+			continue
+		}
+		delete(state.ContainerToIP, containerID)
+		released = append(released, ip)
+		logrus.WithFields(logrus.Fields{
+			"containerID": containerID,
+			"ip":          ip,
+		}).Info("Released stale IP allocation")
+	}
+	if len(released) == 0 {
+		return nil, nil
+	}
+	sort.Strings(released)
+	return released, saveIPAllocationState(state)
+}
+
 // CleanupContainerNetwork releases all network allocations associated with the
 // container ID. At the moment, it only frees the allocated IP address, but it
 // provides a single entry point for future cleanup tasks.
@@ -8,11 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	"gocker/internal/config"
 	"gocker/internal/image"
+	"gocker/internal/storage"
 	"gocker/internal/types"
+	"gocker/internal/volume"
 
 	"github.com/sirupsen/logrus"
 )
@@ -94,13 +95,25 @@ func removeContainer(containerID string) error {
 		return fmt.Errorf("無法刪除正在運行的容器 %s，請先停止它", containerID)
 	}
 
-	// 4. 解除掛載 (Unmount)
+	// 4. 以容器的 storage driver 解除掛載並刪除根檔案系統
+	driver, err := storage.Get(info.StorageDriver)
+	if err != nil {
+		return err
+	}
 	if info.MountPoint != "" {
 		logrus.Infof("正在解除掛載 %s", info.MountPoint)
-		if err := syscall.Unmount(info.MountPoint, 0); err != nil {
+		if err := driver.Unmount(info.MountPoint); err != nil {
 			logrus.Warnf("解除掛載 %s 失敗: %v", info.MountPoint, err)
 		}
 	}
+	if quotaDriver, ok := driver.(storage.QuotaDriver); ok && info.StorageSize > 0 {
+		if err := quotaDriver.RemoveQuota(containerDir); err != nil {
+			logrus.Warnf("解除容器 %s 可寫入層的大小限制失敗: %v", containerID, err)
+		}
+	}
+	if err := driver.Remove(containerDir); err != nil {
+		return fmt.Errorf("刪除容器 %s 的根檔案系統失敗: %w", containerID, err)
+	}
 
 	// 5. 刪除cgroup
 	cgroupPath := filepath.Join(config.CgroupRoot, config.CgroupName, info.ID)
@@ -111,7 +124,14 @@ func removeContainer(containerID string) error {
 	}
 	logrus.Info("成功清理 cgroup")
 
-	// 6. 刪除整個容器目錄
+	// 6. 釋放容器對 volume 的引用 (volume 本身會被保留)
+	if len(info.Mounts) > 0 {
+		if err := volume.NewManager().Release(info.ID, info.Mounts); err != nil {
+			logrus.Warnf("釋放容器 %s 的 volume 引用失敗: %v", info.ID, err)
+		}
+	}
+
+	// 7. 刪除整個容器目錄
 	logrus.Infof("正在刪除容器目錄 %s", containerDir)
 	if err := os.RemoveAll(containerDir); err != nil {
 		return fmt.Errorf("刪除容器目錄 %s 失敗: %w", containerDir, err)
@@ -12,12 +12,15 @@ import (
 	"syscall"
 	"time"
 
+	"gocker/internal/build"
 	"gocker/internal/config"
 	"gocker/internal/container"
+	"gocker/internal/image"
 	"gocker/pkg"
 
 	"gocker/internal/network"
 	"gocker/internal/types"
+	"gocker/internal/volume"
 
 	"github.com/sirupsen/logrus"
 )
@@ -42,12 +45,48 @@ func RunContainer(req *types.RunRequest) error {
 
 	log := logrus.WithFields(logrus.Fields{
 		"containerID": containerID,
-		"image":       fmt.Sprintf("%s:%s", req.ImageName, req.ImageTag),
+		"image":       image.JoinReference(req.ImageName, req.ImageTag),
 		"name":        req.ContainerName,
 	})
 
 	log.Info("父行程: 準備啟動容器...")
 
+	// 1.1 解析映像 ID，容器會固定使用此 ID 對應的映像
+	imageEntry, err := image.LookupImage(image.JoinReference(req.ImageName, req.ImageTag))
+	if err != nil {
+		return fmt.Errorf("%w (請先執行 'gocker pull %s')", err, image.JoinReference(req.ImageName, req.ImageTag))
+	}
+	req.ImageID = imageEntry.ImageID
+
+	// 1.2 將初始化命令套用為映像的 layer，沒有變化的命令會沿用建置快取而不重新執行
+	// 建置在本行程中進行，因此持有映像儲存的共用鎖直到容器的設定檔寫入 (之後映像由容器引用)，
+	// 避免 daemon 同時執行的 rmi 或 prune 刪除建置中的映像與 layer
+	releaseImage := func() {}
+	defer func() { releaseImage() }()
+	if len(req.InitCommands) > 0 {
+		unlockStore, err := image.LockStore()
+		if err != nil {
+			return err
+		}
+		builder := build.NewBuilder(image.NewManager(), container.NewManager())
+		imageID, unpin, err := builder.BuildInit(req.ImageID, req.InitCommands, req.Env, os.Stdout)
+		if err != nil {
+			unlockStore()
+			return fmt.Errorf("執行初始化命令失敗: %w", err)
+		}
+		releaseImage = func() {
+			unpin()
+			unlockStore()
+		}
+		req.ImageID = imageID
+		req.InitCommands = nil
+	}
+
+	// 1.3 合併映像的 config (Entrypoint、Cmd、Env 等) 與使用者指定的參數
+	if err := container.ApplyImageConfig(req); err != nil {
+		return err
+	}
+
 	// 2. 建立容器的工作目錄
 	containerDir := filepath.Join(config.ContainerStoragePath, containerID)
 	if err := os.MkdirAll(containerDir, 0755); err != nil {
@@ -57,6 +96,13 @@ func RunContainer(req *types.RunRequest) error {
 	req.MountPoint = mountPoint
 	req.ContainerID = containerID
 
+	// 2.1 以 storage driver 準備容器的根檔案系統
+	storageDriver, err := container.PrepareRootfs(containerDir, req.ImageID, req.StorageSize)
+	if err != nil {
+		return err
+	}
+	req.StorageDriver = storageDriver
+
 	allocatedIP, err := network.AllocateContainerIP(containerID, req.RequestedIP)
 	if err != nil {
 		return fmt.Errorf("cannot allocate container IP: %w", err)
@@ -72,22 +118,49 @@ func RunContainer(req *types.RunRequest) error {
 		}
 	}()
 
+	// 2.2 準備 volume，並記錄容器對 volume 的引用
+	volumeManager := volume.NewManager()
+	if err := volumeManager.Acquire(containerID, req.Mounts); err != nil {
+		return fmt.Errorf("準備 volume 失敗: %w", err)
+	}
+	// 之後的步驟失敗時容器不會啟動，移除對 volume 的引用，否則 volume rm 與 prune 會一直認為它仍在使用中
+	started := false
+	defer func() {
+		if started {
+			return
+		}
+		if err := volumeManager.Release(containerID, req.Mounts); err != nil {
+			log.WithError(err).Warn("移除對 volume 的引用失敗")
+		}
+	}()
+
 	// 3. 建立並寫入初始的 config.json
 	info := &types.ContainerInfo{
-		ID:          containerID,
-		Name:        req.ContainerName,
-		Command:     req.ContainerCommand,
-		Status:      types.Created,
-		CreatedAt:   time.Now(),
-		Image:       fmt.Sprintf("%s:%s", req.ImageName, req.ImageTag),
-		MountPoint:  mountPoint,
-		Limits:      req.ContainerLimits,
-		RequestedIP: req.RequestedIP,
-		IPAddress:   allocatedIP,
+		ID:            containerID,
+		Name:          req.ContainerName,
+		Command:       req.ContainerCommand,
+		Args:          req.ContainerArgs,
+		Env:           req.Env,
+		WorkingDir:    req.WorkingDir,
+		User:          req.User,
+		ExposedPorts:  req.ExposedPorts,
+		Status:        types.Created,
+		CreatedAt:     time.Now(),
+		Image:         image.JoinReference(req.ImageName, req.ImageTag),
+		ImageID:       req.ImageID,
+		MountPoint:    mountPoint,
+		StorageDriver: req.StorageDriver,
+		StorageSize:   req.StorageSize,
+		Limits:        req.ContainerLimits,
+		RequestedIP:   req.RequestedIP,
+		IPAddress:     allocatedIP,
+		Mounts:        req.Mounts,
 	}
 	if err := pkg.WriteContainerInfo(containerDir, info); err != nil {
 		return fmt.Errorf("寫入容器設定檔失敗: %w", err)
 	}
+	releaseImage()
+	releaseImage = func() {}
 
 	// 4. 建立匿名管道用於父子行程通信
 	readPipe, writePipe, err := os.Pipe()
@@ -141,6 +214,7 @@ func RunContainer(req *types.RunRequest) error {
 	}
 
 	// 9. 更新 config.json，寫入 PID 並將狀態改為 Running
+	started = true
 	info.PID = childPid
 	info.Status = types.Running
 	if err := pkg.WriteContainerInfo(containerDir, info); err != nil {
@@ -0,0 +1,88 @@
+// internal/storage/driver.go
+package storage
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gocker/internal/types"
+)
+
+const (
+	// DriverOverlay 以 OverlayFS 將容器的變更存在 upper 目錄，為預設的 driver
+	DriverOverlay = "overlay"
+	// DriverVFS 將映像完整複製一份給容器使用，速度慢且占用空間，但不需要 overlay 的支援
+	DriverVFS = "vfs"
+)
+
+// Driver 管理容器的根檔案系統：建立容器時準備檔案、啟動時掛載，並計算容器對映像所做的變更
+// 各方法的 dir 為容器的目錄 (config.json 所在處)，lowerDirs 為映像各個 layer 的目錄 (最上層在前)
+type Driver interface {
+	// Name 回傳 driver 的名稱，會記錄在容器的設定中
+	Name() string
+	// Prepare 在建立容器時準備根檔案系統需要的檔案
+	Prepare(dir string, lowerDirs []string) error
+	// Mount 將容器的根檔案系統掛載到 mountPoint
+	Mount(dir string, lowerDirs []string, mountPoint string) error
+	// Unmount 卸載 Mount 掛載的根檔案系統
+	Unmount(mountPoint string) error
+	// Diff 將容器對映像所做的變更以 OCI layer 的格式寫入 w，exclude 中的路徑不會寫入
+	Diff(w io.Writer, dir string, lowerDirs []string, exclude []string) error
+	// Changes 依路徑排序列出容器對映像所做的變更，exclude 中的路徑不會列出
+	Changes(dir string, lowerDirs []string, exclude []string) ([]types.ContainerChange, error)
+	// Size 回傳容器可寫入層占用的空間
+	Size(dir string) (int64, error)
+	// Remove 刪除 Prepare 與 Mount 建立的檔案
+	Remove(dir string) error
+}
+
+// QuotaDriver 為可以限制容器可寫入層大小的 driver (--storage-opt size)
+type QuotaDriver interface {
+	Driver
+	// SetQuota 將容器可寫入層的大小上限設為 size 位元組，必須在 Mount 之前呼叫，重複呼叫會沿用已建立的設定
+	SetQuota(dir string, size int64) error
+	// RemoveQuota 解除 SetQuota 所做的設定，之後仍須呼叫 Remove 刪除檔案
+	RemoveQuota(dir string) error
+}
+
+var drivers = map[string]Driver{
+	DriverOverlay: overlayDriver{},
+	DriverVFS:     vfsDriver{},
+}
+
+// defaultDriver 為新容器使用的 driver
+var defaultDriver Driver = overlayDriver{}
+
+// Get 依名稱取得 driver，空字串表示 overlay (舊版容器沒有記錄 driver)
+func Get(name string) (Driver, error) {
+	if name == "" {
+		return drivers[DriverOverlay], nil
+	}
+	driver, ok := drivers[name]
+	if !ok {
+		names := make([]string, 0, len(drivers))
+		for n := range drivers {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("不支援的 storage driver %q，可用的有 %s", name, strings.Join(names, "、"))
+	}
+	return driver, nil
+}
+
+// SetDefault 設定新容器使用的 driver (daemon.json 的 storage-driver)，空字串表示 overlay
+func SetDefault(name string) error {
+	driver, err := Get(name)
+	if err != nil {
+		return err
+	}
+	defaultDriver = driver
+	return nil
+}
+
+// Default 回傳新容器使用的 driver
+func Default() Driver {
+	return defaultDriver
+}
@@ -0,0 +1,287 @@
+// internal/storage/overlay.go
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// overlayDriver 以映像的 layer 作為 lowerdir，容器的變更寫在 <dir>/upper
+// 以 loopback 檔案系統限制大小的容器，upper 與 work 位於掛載在 <dir>/layer 的檔案系統中
+type overlayDriver struct{}
+
+func (overlayDriver) Name() string { return DriverOverlay }
+
+func (overlayDriver) Prepare(dir string, lowerDirs []string) error {
+	base, err := writableDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"upper", "work"} {
+		if err := os.MkdirAll(filepath.Join(base, sub), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d overlayDriver) Mount(dir string, lowerDirs []string, mountPoint string) error {
+	// 舊版容器的 upper 與 work 目錄由掛載時建立
+	if err := d.Prepare(dir, lowerDirs); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return err
+	}
+	base, err := writableDir(dir)
+	if err != nil {
+		return err
+	}
+
+	mountPoint, err = filepath.Abs(mountPoint)
+	if err != nil {
+		return err
+	}
+	workDir, lower, err := overlayLowerDirs(lowerDirs)
+	if err != nil {
+		return err
+	}
+
+	// 多個 lowerdir 以 ":" 分隔，最左邊的為最上層
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
+		lower, filepath.Join(base, "upper"), filepath.Join(base, "work"))
+	if len(opts) >= os.Getpagesize() {
+		return fmt.Errorf("映像有 %d 個 layer，超過 OverlayFS 掛載選項的長度上限 (%d 位元組)", len(lowerDirs), os.Getpagesize())
+	}
+	logrus.Infof("正在掛載 OverlayFS, opts: %s", opts)
+	if err := mountIn(workDir, "overlay", mountPoint, "overlay", opts); err != nil {
+		// 掛載可能因為 mount propagation 留在主機上，已經是 overlay 時沿用
+		if errors.Is(err, syscall.EBUSY) && checkFSType(mountPoint, "overlay") {
+			logrus.Infof("掛載點 %s 已經掛載 OverlayFS，跳過掛載步驟", mountPoint)
+			return nil
+		}
+		return fmt.Errorf("掛載 OverlayFS 失敗: %w", err)
+	}
+	return nil
+}
+
+// overlayLowerDirs 回傳 lowerdir 選項，以及解析其中相對路徑時的工作目錄
+// mount(2) 的選項最多只有一頁 (4096 位元組)，完整的 layer 路徑約 100 位元組，layer 一多就會失敗，
+// 因此與 docker 的 overlay2 相同，在 layers/l/ 中建立指向各個 layer 的短名稱連結，並以相對於 layers 目錄的路徑掛載；
+// lowerdir 不是 image 儲存的 layers/<id>/diff 時 (例如舊版扁平化的映像) 使用完整路徑
+func overlayLowerDirs(lowerDirs []string) (string, string, error) {
+	if len(lowerDirs) < 2 {
+		return "", strings.Join(lowerDirs, ":"), nil
+	}
+	layersDir := filepath.Dir(filepath.Dir(lowerDirs[0]))
+	for _, dir := range lowerDirs {
+		if filepath.Base(dir) != "diff" || filepath.Dir(filepath.Dir(dir)) != layersDir {
+			return "", strings.Join(lowerDirs, ":"), nil
+		}
+	}
+
+	linksDir := filepath.Join(layersDir, image.LayerLinksDir)
+	if err := os.MkdirAll(linksDir, 0755); err != nil {
+		return "", "", fmt.Errorf("建立 layer 連結目錄失敗: %w", err)
+	}
+	relDirs := make([]string, len(lowerDirs))
+	for i, dir := range lowerDirs {
+		layerID := filepath.Base(filepath.Dir(dir))
+		rel, err := layerLink(linksDir, layerID)
+		if err != nil {
+			return "", "", err
+		}
+		relDirs[i] = rel
+	}
+	return layersDir, strings.Join(relDirs, ":"), nil
+}
+
+// layerLink 確保 layer 的短名稱連結存在，回傳相對於 layers 目錄的路徑
+// 短名稱已經被其他 layer 使用時改用 <id>/diff
+func layerLink(linksDir, layerID string) (string, error) {
+	shortID := image.LayerShortID(layerID)
+	link := filepath.Join(linksDir, shortID)
+	target := filepath.Join("..", layerID, "diff")
+	err := os.Symlink(target, link)
+	if errors.Is(err, os.ErrExist) {
+		// 可能是其他掛載同時建立的連結
+		existing, readErr := os.Readlink(link)
+		if readErr != nil || existing != target {
+			return filepath.Join(layerID, "diff"), nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("建立 layer %s 的連結失敗: %w", layerID, err)
+	}
+	return filepath.Join(image.LayerLinksDir, shortID), nil
+}
+
+// mountIn 以 dir 作為工作目錄執行 mount，讓選項中的相對路徑以 dir 為基準，dir 為空字串時直接掛載
+// 工作目錄屬於整個行程，因此在獨立的 OS thread 中先 unshare(CLONE_FS) 再切換目錄，
+// 該 thread 不會解除鎖定，goroutine 結束時就被丟棄，不影響其他 goroutine
+func mountIn(dir, source, target, fstype, data string) error {
+	if dir == "" {
+		return syscall.Mount(source, target, fstype, 0, data)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			errCh <- fmt.Errorf("unshare CLONE_FS 失敗: %w", err)
+			return
+		}
+		if err := unix.Chdir(dir); err != nil {
+			errCh <- err
+			return
+		}
+		errCh <- syscall.Mount(source, target, fstype, 0, data)
+	}()
+	return <-errCh
+}
+
+func (overlayDriver) Unmount(mountPoint string) error {
+	return syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+}
+
+func (overlayDriver) Diff(w io.Writer, dir string, lowerDirs []string, exclude []string) error {
+	base, err := writableDir(dir)
+	if err != nil {
+		return err
+	}
+	return image.WriteOverlayDiff(w, filepath.Join(base, "upper"), exclude)
+}
+
+func (overlayDriver) Changes(dir string, lowerDirs []string, exclude []string) ([]types.ContainerChange, error) {
+	base, err := writableDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	upperDir := filepath.Join(base, "upper")
+	if _, err := os.Stat(upperDir); errors.Is(err, os.ErrNotExist) {
+		// 容器尚未啟動過，沒有任何變更
+		return nil, nil
+	}
+	return image.OverlayChanges(upperDir, lowerDirs, exclude)
+}
+
+func (overlayDriver) Size(dir string) (int64, error) {
+	base, err := writableDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	return fsutil.DirSize(filepath.Join(base, "upper"))
+}
+
+func (overlayDriver) Remove(dir string) error {
+	if err := unmountLoopback(dir); err != nil {
+		return err
+	}
+	for _, sub := range []string{"upper", "work", loopbackDir, loopbackImage} {
+		if err := os.RemoveAll(filepath.Join(dir, sub)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetQuota 優先以 project quota 限制 upper 與 work 的大小 (需要以 prjquota 或 pquota 掛載的 ext4 或 XFS)，
+// 不支援時改為建立固定大小的 loopback 檔案系統存放 upper 與 work
+func (d overlayDriver) SetQuota(dir string, size int64) error {
+	loopback, err := hasLoopback(dir)
+	if err != nil {
+		return err
+	}
+	if loopback {
+		_, err := mountLoopback(dir)
+		return err
+	}
+
+	if err := d.Prepare(dir, nil); err != nil {
+		return err
+	}
+	upperDir, workDir := filepath.Join(dir, "upper"), filepath.Join(dir, "work")
+	quotaErr := setProjectQuota(dir, []string{upperDir, workDir}, size)
+	if quotaErr == nil {
+		logrus.Infof("已以 project quota 將可寫入層限制為 %d 位元組", size)
+		return nil
+	}
+	// 已經寫入資料的 upper 無法搬到 loopback 檔案系統
+	if empty, err := fsutil.IsEmptyDir(upperDir); err != nil || !empty {
+		return fmt.Errorf("限制可寫入層的大小失敗: %w", quotaErr)
+	}
+	logrus.Infof("無法使用 project quota (%v)，改以 loopback 檔案系統限制可寫入層的大小", quotaErr)
+	os.Remove(upperDir)
+	os.RemoveAll(workDir)
+	if _, err := createLoopback(dir, size); err != nil {
+		return fmt.Errorf("建立 loopback 檔案系統失敗: %w", err)
+	}
+	return d.Prepare(dir, nil)
+}
+
+func (overlayDriver) RemoveQuota(dir string) error {
+	loopback, err := hasLoopback(dir)
+	if err != nil {
+		return err
+	}
+	if loopback {
+		// 映像檔隨 Remove 刪除，這裡只需要卸載
+		return unmountLoopback(dir)
+	}
+	// project ID 隨目錄一併刪除，只需要清除該 project 的上限
+	upperDir := filepath.Join(dir, "upper")
+	if _, err := os.Stat(upperDir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return setProjectLimit(upperDir, projectID(dir), 0)
+}
+
+// writableDir 回傳存放 upper 與 work 的目錄，使用 loopback 檔案系統的容器會先確保已經掛載
+func writableDir(dir string) (string, error) {
+	loopback, err := hasLoopback(dir)
+	if err != nil || !loopback {
+		return dir, err
+	}
+	return mountLoopback(dir)
+}
+
+/*
+檢查mountPoint是否為指定的fstype
+
+/proc/mounts 格式
+
+* device mountPoint fstype options dump pass
+*/
+func checkFSType(mountPoint, fstype string) bool {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		logrus.Warnf("讀取 /proc/mounts 失敗: %v", err)
+		return false
+	}
+
+	for line := range strings.SplitSeq(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[1] == mountPoint {
+			if fields[2] != fstype {
+				logrus.Warnf("掛載點 %s 的 fstype 為 %s, 不是預期的 %s", mountPoint, fields[2], fstype)
+				return false
+			}
+			return true
+		}
+	}
+	logrus.Warnf("找不到掛載點 %s", mountPoint)
+	return false
+}
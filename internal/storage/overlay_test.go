@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gocker/internal/image"
+)
+
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("需要 root 權限")
+	}
+}
+
+// makeLayers 在 layersDir 中建立 n 個 layer (layers/<id>/diff)，每個 layer 中有一個以編號命名的檔案，
+// 回傳的目錄順序與 image.LayerDirs 相同 (最上層在前)
+func makeLayers(t *testing.T, layersDir string, n int) []string {
+	t.Helper()
+	dirs := make([]string, n)
+	for i := 0; i < n; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("layer-%d", i)))
+		diff := filepath.Join(layersDir, hex.EncodeToString(sum[:]), "diff")
+		if err := os.MkdirAll(diff, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(diff, fmt.Sprintf("file-%d", i)), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dirs[n-1-i] = diff
+	}
+	return dirs
+}
+
+func TestOverlayMountManyLayers(t *testing.T) {
+	requireRoot(t)
+	root := t.TempDir()
+	layersDir := filepath.Join(root, "layers")
+	// 完整路徑的 lowerdir 會超過一頁
+	lowerDirs := makeLayers(t, layersDir, 120)
+	if full := len(strings.Join(lowerDirs, ":")); full < os.Getpagesize() {
+		t.Fatalf("完整路徑的長度 %d 應該超過一頁", full)
+	}
+
+	containerDir := filepath.Join(root, "container")
+	mountPoint := filepath.Join(containerDir, "rootfs")
+	d := overlayDriver{}
+	if err := d.Mount(containerDir, lowerDirs, mountPoint); err != nil {
+		t.Fatalf("掛載 %d 個 layer 失敗: %v", len(lowerDirs), err)
+	}
+	defer d.Unmount(mountPoint)
+
+	for i := range lowerDirs {
+		if _, err := os.Stat(filepath.Join(mountPoint, fmt.Sprintf("file-%d", i))); err != nil {
+			t.Errorf("掛載點中缺少第 %d 個 layer 的檔案: %v", i, err)
+		}
+	}
+	link := filepath.Join(layersDir, image.LayerLinksDir, image.LayerShortID(filepath.Base(filepath.Dir(lowerDirs[0]))))
+	if target, err := os.Readlink(link); err != nil || !strings.HasSuffix(target, "/diff") {
+		t.Errorf("layer 的短名稱連結 = %q, %v", target, err)
+	}
+
+	// 工作目錄只在掛載用的 thread 中改變
+	if wd, err := os.Getwd(); err != nil || wd == layersDir {
+		t.Errorf("目前的工作目錄被改變為 %q, %v", wd, err)
+	}
+}
+
+func TestOverlayLowerDirsTooMany(t *testing.T) {
+	root := t.TempDir()
+	lowerDirs := makeLayers(t, filepath.Join(root, "layers"), 300)
+
+	err := overlayDriver{}.Mount(filepath.Join(root, "container"), lowerDirs, filepath.Join(root, "rootfs"))
+	if err == nil || !strings.Contains(err.Error(), "超過 OverlayFS 掛載選項的長度上限") {
+		t.Errorf("layer 過多時應該回傳清楚的錯誤，得到 %v", err)
+	}
+}
+
+func TestOverlayLowerDirsOutsideStore(t *testing.T) {
+	dirs := []string{"/a/rootfs", "/b/rootfs"}
+	workDir, lower, err := overlayLowerDirs(dirs)
+	if err != nil || workDir != "" || lower != "/a/rootfs:/b/rootfs" {
+		t.Errorf("overlayLowerDirs(%v) = %q, %q, %v", dirs, workDir, lower, err)
+	}
+}
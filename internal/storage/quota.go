@@ -0,0 +1,260 @@
+// internal/storage/quota.go
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// loopbackImage 為不支援 project quota 時承載可寫入層的 ext4 映像檔 (位於容器目錄之下)
+	loopbackImage = "layer.img"
+	// loopbackDir 為 loopbackImage 的掛載點
+	loopbackDir = "layer"
+)
+
+// fsxattr 對應 <linux/fs.h> 的 struct fsxattr
+type fsxattr struct {
+	XFlags     uint32
+	ExtSize    uint32
+	NextEnts   uint32
+	ProjID     uint32
+	CowExtSize uint32
+	_          [8]byte
+}
+
+// ifDqblk 對應 <linux/quota.h> 的 struct if_dqblk
+type ifDqblk struct {
+	BHardLimit uint64 // 以 1KB 為單位
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	_          uint32
+}
+
+const (
+	fsIocFsgetxattr    = 0x801c581f // _IOR('X', 31, struct fsxattr)
+	fsIocFssetxattr    = 0x401c5820 // _IOW('X', 32, struct fsxattr)
+	fsXflagProjinherit = 0x200      // 目錄中新建立的檔案沿用目錄的 project ID
+	qSetQuota          = 0x800008
+	prjQuota           = 2
+	qifBlimits         = 1
+)
+
+// projectID 由容器目錄的名稱 (容器 ID) 產生 project ID，0 保留給不屬於任何 project 的檔案
+func projectID(dir string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(filepath.Base(dir)))
+	if id := h.Sum32(); id != 0 {
+		return id
+	}
+	return 1
+}
+
+// setProjectQuota 將 paths 標記為容器 dir 專屬的 project，並把該 project 的空間上限設為 size
+// 檔案系統必須是以 prjquota (ext4) 或 pquota (XFS) 選項掛載的，否則回傳錯誤
+func setProjectQuota(dir string, paths []string, size int64) error {
+	id := projectID(dir)
+	for _, path := range paths {
+		if err := setProjectID(path, id); err != nil {
+			return err
+		}
+	}
+	return setProjectLimit(paths[0], id, size)
+}
+
+// setProjectID 設定目錄的 project ID，並讓其中新建立的檔案沿用
+func setProjectID(path string, id uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var attr fsxattr
+	if err := ioctl(f.Fd(), fsIocFsgetxattr, unsafe.Pointer(&attr)); err != nil {
+		return fmt.Errorf("讀取 %s 的 project ID 失敗: %w", path, err)
+	}
+	attr.ProjID = id
+	attr.XFlags |= fsXflagProjinherit
+	if err := ioctl(f.Fd(), fsIocFssetxattr, unsafe.Pointer(&attr)); err != nil {
+		return fmt.Errorf("設定 %s 的 project ID 失敗: %w", path, err)
+	}
+	return nil
+}
+
+// setProjectLimit 以 quotactl_fd 設定 project 的空間上限，path 可以是該檔案系統上的任何檔案，size 為 0 表示不限制
+func setProjectLimit(path string, id uint32, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	blocks := (uint64(size) + 1023) / 1024
+	limit := ifDqblk{BHardLimit: blocks, BSoftLimit: blocks, Valid: qifBlimits}
+	cmd := uintptr(qSetQuota<<8 | prjQuota)
+	_, _, errno := syscall.Syscall6(unix.SYS_QUOTACTL_FD, f.Fd(), cmd, uintptr(id), uintptr(unsafe.Pointer(&limit)), 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("設定 project %d 的空間上限失敗: %w", id, errno)
+	}
+	return nil
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// hasLoopback 判斷容器是否以 loopback 檔案系統限制可寫入層的大小
+func hasLoopback(dir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, loopbackImage))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// createLoopback 建立大小為 size 的 ext4 映像檔 (sparse file) 並掛載到 <dir>/layer
+func createLoopback(dir string, size int64) (string, error) {
+	img := filepath.Join(dir, loopbackImage)
+	// 先寫到暫存檔，格式化完成後才改名，映像檔存在即表示可以掛載
+	tmp := img + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = f.Truncate(size)
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("建立 %s 失敗: %w", img, err)
+	}
+	if out, err := exec.Command("mkfs.ext4", "-q", "-F", "-m", "0", tmp).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("格式化 %s 失敗: %v: %s", img, err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, img); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return mountLoopback(dir)
+}
+
+// mountLoopback 將 <dir>/layer.img 掛載到 <dir>/layer 並回傳掛載點，已經掛載時直接回傳
+func mountLoopback(dir string) (string, error) {
+	target := filepath.Join(dir, loopbackDir)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", err
+	}
+	if isMountPoint(target) {
+		return target, nil
+	}
+
+	img := filepath.Join(dir, loopbackImage)
+	loop, err := attachLoop(img)
+	if err != nil {
+		return "", fmt.Errorf("連接 %s 到 loop 裝置失敗: %w", img, err)
+	}
+	// loop 裝置設定了 autoclear，掛載完成前必須保持開啟
+	defer loop.Close()
+	if err := syscall.Mount(loop.Name(), target, "ext4", 0, ""); err != nil {
+		return "", fmt.Errorf("掛載 %s 失敗: %w", img, err)
+	}
+	return target, nil
+}
+
+// attachLoop 開啟 img 所連接的 loop 裝置，尚未連接時連接到空閒的裝置
+// 同一個映像檔只會連接到一個 loop 裝置，因此在不同的 mount namespace 中掛載也會共用同一個檔案系統
+func attachLoop(img string) (*os.File, error) {
+	img, err := filepath.Abs(img)
+	if err != nil {
+		return nil, err
+	}
+	if dev := findLoop(img); dev != "" {
+		return os.OpenFile(dev, os.O_RDWR, 0)
+	}
+
+	ctl, err := os.OpenFile("/dev/loop-control", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer ctl.Close()
+	backing, err := os.OpenFile(img, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer backing.Close()
+
+	// 其他行程可能同時取得同一個空閒裝置，設定失敗時重新取得
+	for range 5 {
+		n, err := unix.IoctlRetInt(int(ctl.Fd()), unix.LOOP_CTL_GET_FREE)
+		if err != nil {
+			return nil, err
+		}
+		loop, err := os.OpenFile(fmt.Sprintf("/dev/loop%d", n), os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		cfg := unix.LoopConfig{Fd: uint32(backing.Fd())}
+		cfg.Info.Flags = unix.LO_FLAGS_AUTOCLEAR
+		copy(cfg.Info.File_name[:], img)
+		err = unix.IoctlLoopConfigure(int(loop.Fd()), &cfg)
+		if err == nil {
+			return loop, nil
+		}
+		loop.Close()
+		if !errors.Is(err, unix.EBUSY) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("找不到空閒的 loop 裝置")
+}
+
+// findLoop 透過 /sys/block/loop*/loop/backing_file 尋找已連接 img 的 loop 裝置
+func findLoop(img string) string {
+	files, _ := filepath.Glob("/sys/block/loop*/loop/backing_file")
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil && strings.TrimSpace(string(data)) == img {
+			return "/dev/" + filepath.Base(filepath.Dir(filepath.Dir(file)))
+		}
+	}
+	return ""
+}
+
+// unmountLoopback 卸載 <dir>/layer，映像檔的 loop 裝置會在最後一個掛載卸載後自動釋放
+func unmountLoopback(dir string) error {
+	target := filepath.Join(dir, loopbackDir)
+	for isMountPoint(target) {
+		if err := syscall.Unmount(target, syscall.MNT_DETACH); err != nil {
+			return fmt.Errorf("卸載 %s 失敗: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// isMountPoint 判斷 path 是否為掛載點 (與父目錄位於不同的檔案系統)
+func isMountPoint(path string) bool {
+	var st, parent syscall.Stat_t
+	if syscall.Lstat(path, &st) != nil || syscall.Lstat(filepath.Dir(path), &parent) != nil {
+		return false
+	}
+	return st.Dev != parent.Dev
+}
@@ -0,0 +1,87 @@
+// internal/storage/vfs.go
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/image"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// vfsFsDir 為 vfs 存放容器完整檔案系統的目錄 (位於容器目錄之下)
+const vfsFsDir = "fs"
+
+// vfsDriver 在建立容器時將映像合併後的內容完整複製到 <dir>/fs，啟動時以 bind mount 掛載
+// 變更是逐一比對 fs 與映像的 layer 得到的，適用於不支援 overlay 的檔案系統或巢狀環境
+type vfsDriver struct{}
+
+func (vfsDriver) Name() string { return DriverVFS }
+
+func (vfsDriver) Prepare(dir string, lowerDirs []string) error {
+	fsDir := filepath.Join(dir, vfsFsDir)
+	if _, err := os.Stat(fsDir); err == nil {
+		return nil
+	}
+
+	// 先複製到暫存目錄，完成後才改名，中途失敗不會留下不完整的檔案系統
+	tmp, err := os.MkdirTemp(dir, vfsFsDir+"-")
+	if err != nil {
+		return err
+	}
+	logrus.Infof("正在複製映像的 %d 個 layer 到 %s", len(lowerDirs), fsDir)
+	if err := image.FlattenLayers(lowerDirs, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("複製映像內容失敗: %w", err)
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, fsDir)
+}
+
+func (vfsDriver) Mount(dir string, lowerDirs []string, mountPoint string) error {
+	fsDir := filepath.Join(dir, vfsFsDir)
+	if _, err := os.Stat(fsDir); err != nil {
+		return fmt.Errorf("找不到容器的檔案系統 %s: %w", fsDir, err)
+	}
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return err
+	}
+	// pivot_root 要求新的根目錄是掛載點
+	if err := syscall.Mount(fsDir, mountPoint, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("綁定掛載 %s 失敗: %w", fsDir, err)
+	}
+	return nil
+}
+
+func (vfsDriver) Unmount(mountPoint string) error {
+	return syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+}
+
+func (d vfsDriver) Diff(w io.Writer, dir string, lowerDirs []string, exclude []string) error {
+	changes, err := d.Changes(dir, lowerDirs, exclude)
+	if err != nil {
+		return err
+	}
+	return image.WriteChanges(w, filepath.Join(dir, vfsFsDir), changes)
+}
+
+func (vfsDriver) Changes(dir string, lowerDirs []string, exclude []string) ([]types.ContainerChange, error) {
+	return image.NaiveChanges(filepath.Join(dir, vfsFsDir), lowerDirs, exclude)
+}
+
+func (vfsDriver) Size(dir string) (int64, error) {
+	return fsutil.DirSize(filepath.Join(dir, vfsFsDir))
+}
+
+func (vfsDriver) Remove(dir string) error {
+	return os.RemoveAll(filepath.Join(dir, vfsFsDir))
+}
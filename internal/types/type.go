@@ -8,6 +8,7 @@ import (
 type RunRequest struct {
 	ImageName        string
 	ImageTag         string
+	ImageID          string
 	ContainerName    string
 	ContainerCommand string
 	ContainerID      string
@@ -17,13 +18,44 @@ type RunRequest struct {
 	InitCommands     []string
 	RequestedIP      string
 	IPAddress        string
+	Mounts           []Mount
+	Entrypoint       *string // --entrypoint，nil 表示沿用映像的設定
+	Env              []string
+	WorkingDir       string
+	User             string
+	ExposedPorts     []string
+	Platform         string // --platform，映像的平台必須相符
+	Build            bool   // 建置映像步驟的容器，不安裝 eBPF 監控服務，避免寫入映像的 layer
+	StorageDriver    string // 容器根檔案系統使用的 storage driver
+	StorageSize      int64  // --storage-opt size，容器可寫入層的大小上限 (位元組)，0 表示不限制
 	ContainerLimits
 }
 
 type ContainerLimits struct {
-	MemoryLimit int
-	PidsLimit   int
-	CPULimit    int
+	MemoryLimit       int64 // memory.max (位元組)，0 表示不限制
+	MemorySwap        int64 // 記憶體加上 swap 的上限 (與 docker 的 --memory-swap 相同)，0 表示 swap 與 MemoryLimit 一樣大，-1 表示不限制
+	MemoryReservation int64 // memory.low，主機記憶體不足時盡量保留給容器的大小，0 表示不保留
+	MemoryHigh        int64 // memory.high，超過時容器會被節流並優先回收記憶體，0 表示不限制
+	OOMKillDisable    *bool // 記憶體不足時不殺死容器中的行程 (oom_score_adj 設為 -1000)，nil 表示使用預設值
+	OOMKillGroup      *bool // 記憶體不足時整個容器一起被殺死 (memory.oom.group)，nil 表示使用核心的預設值 (只殺死單一行程)
+	PidsLimit         int
+	CPUMillis         int64            // CPU 上限 (millicore，1000 為一個 CPU)，寫入 cpu.max，0 表示不限制
+	CPUWeight         int              // cpu.weight (1-10000)，0 表示使用預設值
+	CpusetCpus        *string          // 容器可以使用的 CPU，例如 "0-2,4"，空字串表示不限制 (清除)，nil 表示沒有指定
+	CpusetMems        *string          // 容器可以使用的 NUMA 記憶體節點，空字串表示不限制 (清除)，nil 表示沒有指定
+	BlkioWeight       int              // 區塊 IO 的相對權重 (10-1000，與 docker 相同)，換算後寫入 io.weight，0 表示使用預設值
+	DeviceReadBps     []ThrottleDevice // 每個裝置每秒最多讀取的位元組數 (io.max 的 rbps)
+	DeviceWriteBps    []ThrottleDevice // 每個裝置每秒最多寫入的位元組數 (io.max 的 wbps)
+	DeviceReadIOps    []ThrottleDevice // 每個裝置每秒最多的讀取次數 (io.max 的 riops)
+	DeviceWriteIOps   []ThrottleDevice // 每個裝置每秒最多的寫入次數 (io.max 的 wiops)
+}
+
+// ThrottleDevice 為一個區塊裝置的 IO 速率上限
+type ThrottleDevice struct {
+	Path  string // 使用者指定的裝置路徑，只用於顯示
+	Major int64
+	Minor int64
+	Rate  uint64 // 0 表示不限制
 }
 
 // ContainerStatus 容器的狀態
@@ -35,24 +67,78 @@ const (
 
 // ContainerInfo 用於儲存容器的metadata
 type ContainerInfo struct {
-	ID          string          `json:"id"`
-	PID         int             `json:"pid"`
-	Name        string          `json:"name"`
-	Command     string          `json:"command"`
-	Status      string          `json:"status"`
-	CreatedAt   time.Time       `json:"createdAt"`
-	Image       string          `json:"image"`
-	MountPoint  string          `json:"mountPoint"`
-	RequestedIP string          `json:"requestedIP,omitempty"`
-	IPAddress   string          `json:"ipAddress,omitempty"`
-	FinishedAt  time.Time       `json:"finishedAt,omitempty"`
-	Limits      ContainerLimits `json:"limits,omitempty"`
+	ID            string          `json:"id"`
+	PID           int             `json:"pid"`
+	Name          string          `json:"name"`
+	Command       string          `json:"command"`
+	Args          []string        `json:"args,omitempty"`
+	Env           []string        `json:"env,omitempty"`
+	WorkingDir    string          `json:"workingDir,omitempty"`
+	User          string          `json:"user,omitempty"`
+	ExposedPorts  []string        `json:"exposedPorts,omitempty"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Image         string          `json:"image"`
+	ImageID       string          `json:"imageID,omitempty"`
+	MountPoint    string          `json:"mountPoint"`
+	StorageDriver string          `json:"storageDriver,omitempty"` // 空字串表示 overlay
+	StorageSize   int64           `json:"storageSize,omitempty"`   // 可寫入層的大小上限 (位元組)，0 表示不限制
+	RequestedIP   string          `json:"requestedIP,omitempty"`
+	IPAddress     string          `json:"ipAddress,omitempty"`
+	FinishedAt    time.Time       `json:"finishedAt,omitempty"`
+	Limits        ContainerLimits `json:"limits,omitempty"`
+	Mounts        []Mount         `json:"mounts,omitempty"`
+	SizeRw        int64           `json:"sizeRw,omitempty"`     // 可寫入層的大小，只在 gocker ps -s 時計算
+	SizeRootFs    int64           `json:"sizeRootFs,omitempty"` // 可寫入層加上映像的大小，只在 gocker ps -s 時計算
+}
+
+// Mount 類型
+const (
+	MountTypeVolume = "volume"
+	MountTypeBind   = "bind"
+)
+
+// Mount 描述一個掛載到容器內的 volume 或主機目錄
+type Mount struct {
+	Type        string `json:"type"`        // "volume" 或 "bind"
+	Source      string `json:"source"`      // volume 名稱或主機路徑
+	Destination string `json:"destination"` // 容器內的掛載路徑
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+}
+
+// VolumeInfo 用於儲存 volume 的 metadata
+type VolumeInfo struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Mountpoint string            `json:"mountpoint"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Anonymous  bool              `json:"anonymous,omitempty"`
+	Containers []string          `json:"containers,omitempty"` // 正在引用此 volume 的容器 ID
+	Size       int64             `json:"size,omitempty"`       // volume 的大小，只在 gocker system df 時計算
+}
+
+// VolumeRequest 用於 volume 相關命令的請求結構
+type VolumeRequest struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Force  bool              `json:"force,omitempty"`
+}
+
+// VolumePruneReport 為 volume prune 的結果
+type VolumePruneReport struct {
+	Deleted        []string `json:"deleted"`
+	SpaceReclaimed int64    `json:"spaceReclaimed"`
 }
 
 // ImageManifest Image 的結構
 type ImageManifest struct {
-	ImageID string `json:"imageID"` // 映像的唯一 ID
-	RepoTag string `json:"repoTag"` // 映像的標籤
+	ImageID  string    `json:"imageID"`            // 映像的唯一 ID (manifest digest 的完整十六進位)
+	RepoTag  string    `json:"repoTag"`            // 映像的標籤，例如 alpine:latest 或 alpine@sha256:...
+	Digest   string    `json:"digest,omitempty"`   // 遠端倉庫中的 manifest digest (sha256:...)
+	Size     int64     `json:"size,omitempty"`     // 所有 layer 解壓縮後的大小
+	Platform string    `json:"platform,omitempty"` // 映像的平台，例如 linux/arm64/v8
+	Created  time.Time `json:"created,omitempty"`  // 映像的建立時間，來自映像的 config
 }
 
 // Request 是 CLI 向 Daemon 發送的通用結構
@@ -63,12 +149,16 @@ type Request struct {
 
 // Response 是 Daemon 向 CLI 回應的通用結構
 type Response struct {
-	Status  string          `json:"status"`            // "success" 或 "error"
+	Status  string          `json:"status"`            // "success"、"error" 或串流中的 "progress"
 	Message string          `json:"message,omitempty"` // 簡單的文字訊息或錯誤資訊
 	Data    json.RawMessage `json:"data,omitempty"`    // 承載複雜的數據
 }
 
 // ExecRequest 用於執行命令的請求結構
+type PsRequest struct {
+	Size bool `json:"size,omitempty"` // 是否計算容器的大小 (gocker ps -s)
+}
+
 type ExecRequest struct {
 	ContainerID string   `json:"container_id"` // 容器 ID
 	Command     []string `json:"command"`      // 要執行的命令及其參數
@@ -82,5 +172,201 @@ type StartRequest struct {
 }
 
 type PullRequest struct {
-	Image string `json:"image"` // 例如 "alpine:latest"
+	Image    string        `json:"image"`              // 例如 "alpine:latest"
+	Platform string        `json:"platform,omitempty"` // os/arch[/variant]，空字串表示主機的平台
+	Auth     *RegistryAuth `json:"auth,omitempty"`     // CLI 使用者的倉庫憑證，nil 表示匿名存取
+}
+
+// pull 進度事件的狀態
+const (
+	ProgressResolving     = "resolving"   // 正在解析映像的 manifest
+	ProgressWaiting       = "waiting"     // layer 正由其他 pull 下載中
+	ProgressDownloading   = "downloading" // 正在下載 layer，Current/Total 為已下載/總位元組數
+	ProgressExtracting    = "extracting"  // 正在解壓縮 layer，Current/Total 為已讀取/總位元組數
+	ProgressLayerExists   = "exists"      // layer 已存在於本機
+	ProgressLayerComplete = "complete"    // layer 處理完成
+	ProgressDone          = "done"        // 映像處理完成，Message 為映像的 digest
+)
+
+// ProgressEvent 為 pull 過程中以 Status 為 "progress" 的 Response 串流回傳的進度事件
+type ProgressEvent struct {
+	Status  string `json:"status"`
+	ID      string `json:"id,omitempty"`      // layer digest 的前 12 碼，整個映像的事件為空字串
+	Current int64  `json:"current,omitempty"` // 目前進度的位元組數
+	Total   int64  `json:"total,omitempty"`   // 總位元組數
+	Message string `json:"message,omitempty"`
+}
+
+// BuildRequest 用於 build 命令
+type BuildRequest struct {
+	ContextDir string                   `json:"contextDir"`        // 建置環境目錄的絕對路徑，COPY/ADD 的來源都在此目錄下
+	Gockerfile string                   `json:"gockerfile"`        // Gockerfile 的絕對路徑
+	Tags       []string                 `json:"tags,omitempty"`    // 建置完成後加上的 tag
+	Auth       map[string]*RegistryAuth `json:"auth,omitempty"`    // FROM 映像所屬倉庫的憑證，key 為倉庫位址
+	NoCache    bool                     `json:"noCache,omitempty"` // 不使用建置快取
+}
+
+// CommitRequest 用於 commit 命令
+type CommitRequest struct {
+	Container string   `json:"container"`           // 容器名稱或 ID
+	Reference string   `json:"reference,omitempty"` // 新映像的 repo:tag，空字串表示不加上 tag
+	Changes   []string `json:"changes,omitempty"`   // 套用在新映像 config 上的 Gockerfile 指令
+	Message   string   `json:"message,omitempty"`   // 記錄在映像歷史中的說明
+	Author    string   `json:"author,omitempty"`    // 映像的作者
+	Pause     bool     `json:"pause"`               // 讀取變更時是否暫停運行中的容器
+}
+
+// ExportRequest 用於 export 命令
+type ExportRequest struct {
+	Container string `json:"container"` // 容器名稱或 ID
+}
+
+// ArchiveChunk 為一段 tar 資料
+// export 與 cp (從容器複製) 以 Status 為 "progress" 的 Response 串流回傳；
+// cp (複製到容器) 則由客戶端在請求之後依序傳送，最後以 EOF 為 true 的項目結束
+type ArchiveChunk struct {
+	Data []byte `json:"data,omitempty"`
+	EOF  bool   `json:"eof,omitempty"`
+}
+
+// CopyFromRequest 用於 cp_from 命令，將容器中的檔案以 tar 串流回傳
+type CopyFromRequest struct {
+	Container string `json:"container"` // 容器名稱或 ID
+	Path      string `json:"path"`      // 容器中的路徑
+	Name      string `json:"name"`      // 來源在 tar 中的名稱，"." 表示只複製目錄的內容
+	FileOnly  bool   `json:"fileOnly"`  // 目的地為已存在的檔案，來源不能是目錄
+}
+
+// CopyToRequest 用於 cp_to 命令，請求之後跟著 ArchiveChunk 串流
+type CopyToRequest struct {
+	Container string `json:"container"`       // 容器名稱或 ID
+	Path      string `json:"path"`            // 容器中的目的地路徑
+	Name      string `json:"name,omitempty"`  // 來源在 tar 中的名稱，"." 表示只複製目錄的內容，空字串表示 tar 直接解開到 Path 目錄
+	IsDir     bool   `json:"isDir,omitempty"` // 來源是否為目錄
+}
+
+// DiffRequest 用於 diff 命令
+type DiffRequest struct {
+	Container string `json:"container"` // 容器名稱或 ID
+}
+
+// 容器檔案系統的變更類型
+const (
+	ChangeAdded    = "A"
+	ChangeModified = "C"
+	ChangeDeleted  = "D"
+)
+
+// ContainerChange 為容器相對於映像的一項檔案系統變更
+type ContainerChange struct {
+	Kind string `json:"kind"` // ChangeAdded、ChangeModified 或 ChangeDeleted
+	Path string `json:"path"` // 容器中的絕對路徑
+}
+
+// ImportRequest 用於 import 命令
+type ImportRequest struct {
+	Source    string   `json:"source"`              // 根檔案系統的 tar 檔或目錄的絕對路徑
+	Reference string   `json:"reference,omitempty"` // 新映像的 repo:tag，空字串表示不加上 tag
+	Changes   []string `json:"changes,omitempty"`   // 套用在新映像 config 上的 Gockerfile 指令
+	Message   string   `json:"message,omitempty"`   // 記錄在映像歷史中的說明
+}
+
+// BuildEvent 為 build 過程中以 Status 為 "progress" 的 Response 串流回傳的輸出
+type BuildEvent struct {
+	Stream string `json:"stream"`
+}
+
+// BuildResult 為 build 成功時回傳的結果
+type BuildResult struct {
+	ImageID string   `json:"imageID"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// PushRequest 用於 push 命令
+type PushRequest struct {
+	Image    string        `json:"image"`              // 例如 "localhost:5000/app:v1"
+	Insecure bool          `json:"insecure,omitempty"` // 允許使用 HTTP 連線到倉庫
+	Auth     *RegistryAuth `json:"auth,omitempty"`
+}
+
+// RegistryAuth 為 CLI 解析出的倉庫憑證，隨請求傳給 daemon，
+// daemon 只使用請求中的憑證，不會讀取 root 的 keychain
+type RegistryAuth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identityToken,omitempty"`
+	RegistryToken string `json:"registryToken,omitempty"`
+}
+
+// ImageRequest 用於 rmi、tag 與 image prune 等映像命令的請求結構
+type ImageRequest struct {
+	Image  string `json:"image,omitempty"`  // 來源映像 (name:tag 或 ID)
+	Target string `json:"target,omitempty"` // tag 的目標名稱
+	Force  bool   `json:"force,omitempty"`
+	All    bool   `json:"all,omitempty"`
+}
+
+// ImageArchive 格式
+const (
+	ImageArchiveDocker = "docker" // docker save 產生的格式 (manifest.json + repositories)
+	ImageArchiveOCI    = "oci"    // OCI image layout (oci-layout + index.json)
+)
+
+// ImageSaveRequest 用於 save 命令，將映像匯出成 tar 檔
+type ImageSaveRequest struct {
+	Images []string `json:"images"`
+	Output string   `json:"output"`           // 輸出的 tar 檔路徑 (絕對路徑)
+	Format string   `json:"format,omitempty"` // docker 或 oci，預設為 docker
+}
+
+// ImageLoadRequest 用於 load 命令，從 tar 檔匯入映像
+type ImageLoadRequest struct {
+	Input string `json:"input"` // 輸入的 tar 檔路徑 (絕對路徑)
+}
+
+// ImageDeleteReport 為刪除或清理映像的結果
+type ImageDeleteReport struct {
+	Untagged       []string `json:"untagged,omitempty"`
+	Deleted        []string `json:"deleted,omitempty"`
+	SpaceReclaimed int64    `json:"spaceReclaimed"`
+}
+
+// ImageUsage 為 system df 中單一映像或建置快取占用的空間
+type ImageUsage struct {
+	ImageID    string    `json:"imageID"`
+	RepoTags   []string  `json:"repoTags,omitempty"`
+	Created    time.Time `json:"created,omitempty"`
+	Size       int64     `json:"size"`       // 映像所有 layer 的大小
+	SharedSize int64     `json:"sharedSize"` // 與其他映像共用的 layer 大小
+	UniqueSize int64     `json:"uniqueSize"` // 只被此映像引用的 layer 大小
+	Containers int       `json:"containers"` // 使用此映像的容器數量
+}
+
+// DiskUsage 為 system df 的結果，共用的 layer 在各項總計中只計算一次
+type DiskUsage struct {
+	Images                []ImageUsage     `json:"images"`
+	ImagesSize            int64            `json:"imagesSize"`            // 映像引用的 layer 大小總和
+	ImagesReclaimable     int64            `json:"imagesReclaimable"`     // 其中沒有被容器使用的部分
+	BuildCache            []ImageUsage     `json:"buildCache"`            // 沒有 tag 的建置快取映像
+	BuildCacheSize        int64            `json:"buildCacheSize"`        // 只被建置快取引用的 layer 大小總和
+	BuildCacheReclaimable int64            `json:"buildCacheReclaimable"` // 其中沒有被容器使用的部分
+	Containers            []*ContainerInfo `json:"containers"`            // SizeRw 為可寫入層的大小
+	Volumes               []*VolumeInfo    `json:"volumes"`               // Size 為 volume 的大小
+}
+
+// SystemPruneRequest 用於 system prune 命令
+type SystemPruneRequest struct {
+	All     bool      `json:"all,omitempty"`     // 刪除所有沒有被容器使用的映像，而不只是沒有 tag 的映像
+	Volumes bool      `json:"volumes,omitempty"` // 一併刪除沒有被容器使用的 volume
+	Until   time.Time `json:"until,omitempty"`   // 只刪除在此時間之前建立的容器、映像與建置快取
+}
+
+// SystemPruneReport 為 system prune 的結果
+type SystemPruneReport struct {
+	Containers     []string           `json:"containers,omitempty"`  // 刪除的容器 ID
+	ReleasedIPs    []string           `json:"releasedIPs,omitempty"` // 釋放的殘留 IP 配置
+	Volumes        []string           `json:"volumes,omitempty"`
+	Images         *ImageDeleteReport `json:"images,omitempty"`
+	BuildCache     []string           `json:"buildCache,omitempty"` // 刪除的建置快取映像 ID
+	SpaceReclaimed int64              `json:"spaceReclaimed"`
 }
@@ -0,0 +1,362 @@
+// internal/volume/manager.go
+package volume
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gocker/internal/config"
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultDriver 是目前唯一支援的 volume driver
+	DefaultDriver = "local"
+
+	metadataFile = "volume.json"
+	dataDir      = "_data"
+	lockFile     = ".lock"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// Manager volume 管理器
+type Manager struct {
+	storageDir string
+	mu         sync.Mutex
+}
+
+// NewManager 建立新的 volume 管理器
+func NewManager() *Manager {
+	manager := &Manager{
+		storageDir: config.VolumesDir,
+	}
+
+	// 確保儲存目錄存在
+	os.MkdirAll(manager.storageDir, 0755)
+
+	return manager
+}
+
+// Create 建立一個新的 volume，若同名 volume 已存在則直接回傳
+func (m *Manager) Create(name string, labels map[string]string) (*types.VolumeInfo, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return m.create(name, labels, false)
+}
+
+func (m *Manager) create(name string, labels map[string]string, anonymous bool) (*types.VolumeInfo, error) {
+	if name == "" {
+		randBytes := make([]byte, 32)
+		if _, err := rand.Read(randBytes); err != nil {
+			return nil, fmt.Errorf("無法產生 volume 名稱: %w", err)
+		}
+		name = hex.EncodeToString(randBytes)
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	if info, err := m.load(name); err == nil {
+		return info, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	info := &types.VolumeInfo{
+		Name:       name,
+		Driver:     DefaultDriver,
+		Mountpoint: filepath.Join(m.storageDir, name, dataDir),
+		CreatedAt:  time.Now(),
+		Labels:     labels,
+		Anonymous:  anonymous,
+	}
+	if err := os.MkdirAll(info.Mountpoint, 0755); err != nil {
+		return nil, fmt.Errorf("建立 volume 目錄 %s 失敗: %w", info.Mountpoint, err)
+	}
+	if err := m.save(info); err != nil {
+		return nil, err
+	}
+
+	logrus.WithField("volume", name).Info("已建立 volume")
+	return info, nil
+}
+
+// Inspect 取得指定 volume 的資訊
+func (m *Manager) Inspect(name string) (*types.VolumeInfo, error) {
+	info, err := m.load(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("找不到 volume: %s", name)
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// List 列出所有 volume
+func (m *Manager) List() ([]*types.VolumeInfo, error) {
+	entries, err := os.ReadDir(m.storageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*types.VolumeInfo{}, nil
+		}
+		return nil, fmt.Errorf("讀取 volume 儲存目錄失敗: %w", err)
+	}
+
+	volumes := []*types.VolumeInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := m.load(entry.Name())
+		if err != nil {
+			logrus.Warnf("讀取 volume %s 的 metadata 失敗: %v", entry.Name(), err)
+			continue
+		}
+		volumes = append(volumes, info)
+	}
+
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// Remove 刪除指定 volume，正在被容器使用的 volume 無法刪除
+func (m *Manager) Remove(name string) error {
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := m.Inspect(name)
+	if err != nil {
+		return err
+	}
+	if len(info.Containers) > 0 {
+		return fmt.Errorf("volume %s 正在被容器使用中: %v", name, info.Containers)
+	}
+
+	return m.remove(name)
+}
+
+// Prune 刪除所有沒有被任何容器引用的 volume
+func (m *Manager) Prune() (*types.VolumePruneReport, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	volumes, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.VolumePruneReport{Deleted: []string{}}
+	for _, info := range volumes {
+		if len(info.Containers) > 0 {
+			logrus.Debugf("volume %s 正在被使用，略過", info.Name)
+			continue
+		}
+		size, _ := fsutil.DirSize(info.Mountpoint)
+		if err := m.remove(info.Name); err != nil {
+			logrus.Warnf("刪除 volume %s 失敗: %v", info.Name, err)
+			continue
+		}
+		report.Deleted = append(report.Deleted, info.Name)
+		report.SpaceReclaimed += size
+	}
+	return report, nil
+}
+
+// DiskUsage 列出所有 volume 並計算各自的大小 (gocker system df)
+func (m *Manager) DiskUsage() ([]*types.VolumeInfo, error) {
+	volumes, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range volumes {
+		size, err := fsutil.DirSize(info.Mountpoint)
+		if err != nil {
+			logrus.Warnf("計算 volume %s 的大小失敗: %v", info.Name, err)
+		}
+		info.Size = size
+	}
+	return volumes, nil
+}
+
+// Acquire 為容器準備 volume 類型的掛載: 若 volume 不存在則建立，並記錄容器的引用
+// 中途失敗時會移除已經記錄的引用，不會留下指向不存在的容器的引用
+func (m *Manager) Acquire(containerID string, mounts []types.Mount) error {
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range mounts {
+		if err := m.acquire(containerID, &mounts[i]); err != nil {
+			if releaseErr := m.release(containerID, mounts[:i]); releaseErr != nil {
+				logrus.Warnf("移除容器 %s 對 volume 的引用失敗: %v", containerID, releaseErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) acquire(containerID string, mount *types.Mount) error {
+	if mount.Type != types.MountTypeVolume {
+		return nil
+	}
+	info, err := m.create(mount.Source, nil, mount.Source == "")
+	if err != nil {
+		return err
+	}
+	// 匿名 volume 在建立後才有名稱
+	mount.Source = info.Name
+
+	if slices.Contains(info.Containers, containerID) {
+		return nil
+	}
+	info.Containers = append(info.Containers, containerID)
+	if err := m.save(info); err != nil {
+		if info.Anonymous && len(info.Containers) == 1 {
+			_ = m.remove(info.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Release 移除容器對 volume 的引用，匿名 volume 在不再被引用後會一併刪除
+func (m *Manager) Release(containerID string, mounts []types.Mount) error {
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.release(containerID, mounts)
+}
+
+func (m *Manager) release(containerID string, mounts []types.Mount) error {
+	for _, mount := range mounts {
+		if mount.Type != types.MountTypeVolume {
+			continue
+		}
+		info, err := m.load(mount.Source)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		info.Containers = slices.DeleteFunc(info.Containers, func(id string) bool { return id == containerID })
+
+		if info.Anonymous && len(info.Containers) == 0 {
+			if err := m.remove(info.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.save(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DataPath 回傳 volume 實際存放資料的目錄
+func DataPath(name string) string {
+	return filepath.Join(config.VolumesDir, name, dataDir)
+}
+
+// validateName 檢查 volume 名稱，名稱會被接在儲存目錄之下，因此所有來自外部的名稱都必須先檢查
+func validateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("無效的 volume 名稱 %q: 只能包含 [a-zA-Z0-9][a-zA-Z0-9_.-]", name)
+	}
+	return nil
+}
+
+func (m *Manager) remove(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	path := filepath.Join(m.storageDir, name)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("刪除 volume 目錄 %s 失敗: %w", path, err)
+	}
+	logrus.WithField("volume", name).Info("已刪除 volume")
+	return nil
+}
+
+func (m *Manager) load(name string) (*types.VolumeInfo, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(m.storageDir, name, metadataFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.VolumeInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("解析 volume %s 的 metadata 失敗: %w", name, err)
+	}
+	return &info, nil
+}
+
+func (m *Manager) save(info *types.VolumeInfo) error {
+	data, err := json.MarshalIndent(info, "", "    ")
+	if err != nil {
+		return fmt.Errorf("序列化 volume metadata 失敗: %w", err)
+	}
+
+	path := filepath.Join(m.storageDir, info.Name, metadataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("寫入 volume metadata 失敗: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// lock 同時鎖定行程內與跨行程 (CLI 與 daemon) 的 volume metadata 存取
+func (m *Manager) lock() (func(), error) {
+	m.mu.Lock()
+
+	f, err := os.OpenFile(filepath.Join(m.storageDir, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("開啟 volume lock 檔案失敗: %w", err)
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		m.mu.Unlock()
+		return nil, fmt.Errorf("鎖定 volume 儲存目錄失敗: %w", err)
+	}
+
+	return func() {
+		_ = unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		f.Close()
+		m.mu.Unlock()
+	}, nil
+}
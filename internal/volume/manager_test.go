@@ -0,0 +1,109 @@
+package volume
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocker/internal/types"
+)
+
+func TestManagerRejectsInvalidNames(t *testing.T) {
+	outside := t.TempDir()
+	storageDir := filepath.Join(outside, "volumes")
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(outside, "victim")
+	if err := os.MkdirAll(victim, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{storageDir: storageDir}
+
+	for _, name := range []string{"../victim", "..", "a/../../victim", "/etc", ".hidden", "x"} {
+		if _, err := m.Create(name, nil); err == nil {
+			t.Errorf("Create(%q) 應該回傳錯誤", name)
+		}
+		if _, err := m.Inspect(name); err == nil {
+			t.Errorf("Inspect(%q) 應該回傳錯誤", name)
+		}
+		if err := m.Remove(name); err == nil {
+			t.Errorf("Remove(%q) 應該回傳錯誤", name)
+		}
+		mounts := []types.Mount{{Type: types.MountTypeVolume, Source: name}}
+		if err := m.Release("container", mounts); err == nil {
+			t.Errorf("Release(%q) 應該回傳錯誤", name)
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("儲存目錄之外的目錄被刪除: %v", err)
+	}
+}
+
+func TestManagerCreateInspectRemove(t *testing.T) {
+	m := &Manager{storageDir: t.TempDir()}
+	info, err := m.Create("data", map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatalf("Create 失敗: %v", err)
+	}
+	if info.Mountpoint != filepath.Join(m.storageDir, "data", dataDir) {
+		t.Errorf("Mountpoint = %s", info.Mountpoint)
+	}
+	if got, err := m.Inspect("data"); err != nil || got.Labels["k"] != "v" {
+		t.Errorf("Inspect = %+v, %v", got, err)
+	}
+	if err := m.Remove("data"); err != nil {
+		t.Fatalf("Remove 失敗: %v", err)
+	}
+	if _, err := m.Inspect("data"); err == nil {
+		t.Errorf("刪除後 Inspect 應該回傳錯誤")
+	}
+}
+
+func TestAcquireRollsBackOnFailure(t *testing.T) {
+	m := &Manager{storageDir: t.TempDir()}
+	if _, err := m.Create("data", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第三個掛載的名稱無效，前兩個掛載的引用必須被移除
+	mounts := []types.Mount{
+		{Type: types.MountTypeVolume, Source: "data", Destination: "/data"},
+		{Type: types.MountTypeVolume, Source: "", Destination: "/anon"},
+		{Type: types.MountTypeVolume, Source: "../bad", Destination: "/bad"},
+	}
+	if err := m.Acquire("container", mounts); err == nil {
+		t.Fatal("Acquire 應該回傳錯誤")
+	}
+	if info, err := m.Inspect("data"); err != nil || len(info.Containers) != 0 {
+		t.Errorf("失敗後 volume 仍然被引用: %+v, %v", info, err)
+	}
+	if volumes, err := m.List(); err != nil || len(volumes) != 1 {
+		t.Errorf("失敗後匿名 volume 應該被刪除，剩下 %d 個 volume, %v", len(volumes), err)
+	}
+}
+
+func TestReleaseAfterFailedRun(t *testing.T) {
+	m := &Manager{storageDir: t.TempDir()}
+	mounts := []types.Mount{
+		{Type: types.MountTypeVolume, Source: "data", Destination: "/data"},
+		{Type: types.MountTypeVolume, Source: "", Destination: "/anon"},
+	}
+	if err := m.Acquire("container", mounts); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("data"); err == nil {
+		t.Fatal("被容器引用的 volume 不應該可以刪除")
+	}
+
+	// gocker run 在 Acquire 之後失敗時會呼叫 Release，volume 必須可以再被刪除
+	if err := m.Release("container", mounts); err != nil {
+		t.Fatalf("Release 失敗: %v", err)
+	}
+	if _, err := m.Inspect(mounts[1].Source); err == nil {
+		t.Errorf("匿名 volume %s 應該被刪除", mounts[1].Source)
+	}
+	if err := m.Remove("data"); err != nil {
+		t.Errorf("Release 之後 volume rm 失敗: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+// internal/volume/mount.go
+package volume
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"gocker/internal/fsutil"
+	"gocker/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ParseMount 解析 -v 參數，支援以下格式:
+//
+//	/path                 匿名 volume
+//	name:/path[:ro|rw]    具名 volume
+//	/host:/path[:ro|rw]   綁定主機目錄
+func ParseMount(spec string) (types.Mount, error) {
+	var mount types.Mount
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		mount.Type = types.MountTypeVolume
+		mount.Destination = parts[0]
+	case 2, 3:
+		mount.Source = parts[0]
+		mount.Destination = parts[1]
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "ro":
+				mount.ReadOnly = true
+			case "rw":
+			default:
+				return mount, fmt.Errorf("無效的掛載模式 %q: 只支援 ro 或 rw", parts[2])
+			}
+		}
+		if mount.Source == "" {
+			return mount, fmt.Errorf("無效的掛載設定 %q: 來源不可為空", spec)
+		}
+		if strings.HasPrefix(mount.Source, "/") || strings.HasPrefix(mount.Source, ".") {
+			abs, err := filepath.Abs(mount.Source)
+			if err != nil {
+				return mount, fmt.Errorf("解析主機路徑 %s 失敗: %w", mount.Source, err)
+			}
+			mount.Type = types.MountTypeBind
+			mount.Source = abs
+		} else {
+			mount.Type = types.MountTypeVolume
+		}
+	default:
+		return mount, fmt.Errorf("無效的掛載設定 %q", spec)
+	}
+
+	if !filepath.IsAbs(mount.Destination) {
+		return mount, fmt.Errorf("容器內的掛載路徑必須為絕對路徑: %s", mount.Destination)
+	}
+	mount.Destination = filepath.Clean(mount.Destination)
+	return mount, nil
+}
+
+// SetupMounts 在 pivot_root 之前，將 volume 與主機目錄綁定掛載到容器的 rootfs 中
+// 具名 volume 第一次被使用 (內容為空) 時，會先把映像中對應路徑的內容複製進 volume
+func SetupMounts(rootfs string, mounts []types.Mount) error {
+	for _, mount := range mounts {
+		log := logrus.WithFields(logrus.Fields{
+			"type":        mount.Type,
+			"source":      mount.Source,
+			"destination": mount.Destination,
+		})
+
+		// 映像中的符號連結不能讓掛載點逃出容器的 rootfs
+		target, err := fsutil.SecureJoin(rootfs, mount.Destination)
+		if err != nil {
+			return fmt.Errorf("解析掛載路徑 %s 失敗: %w", mount.Destination, err)
+		}
+
+		var source string
+		switch mount.Type {
+		case types.MountTypeVolume:
+			source = DataPath(mount.Source)
+			if err := copyUp(target, source); err != nil {
+				return fmt.Errorf("初始化 volume %s 失敗: %w", mount.Source, err)
+			}
+		case types.MountTypeBind:
+			source = mount.Source
+		default:
+			return fmt.Errorf("不支援的掛載類型: %s", mount.Type)
+		}
+
+		st, err := os.Stat(source)
+		if err != nil {
+			return fmt.Errorf("掛載來源 %s 不存在: %w", source, err)
+		}
+		if err := ensureTarget(target, st.IsDir()); err != nil {
+			return fmt.Errorf("建立掛載點 %s 失敗: %w", target, err)
+		}
+
+		log.Info("正在掛載 volume...")
+		if err := syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("綁定掛載 %s -> %s 失敗: %w", source, target, err)
+		}
+		if mount.ReadOnly {
+			flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_REC)
+			if err := syscall.Mount("", target, "", flags, ""); err != nil {
+				return fmt.Errorf("將 %s 重新掛載為唯讀失敗: %w", target, err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyUp 若 volume 為空且映像中對應的路徑有內容，將其複製到 volume
+func copyUp(imagePath, volumePath string) error {
+	empty, err := fsutil.IsEmptyDir(volumePath)
+	if err != nil || !empty {
+		return err
+	}
+
+	st, err := os.Stat(imagePath)
+	if err != nil || !st.IsDir() {
+		// 映像中沒有此目錄，沒有內容需要複製
+		return nil
+	}
+
+	logrus.Infof("正在將映像內容 %s 複製到 volume %s", imagePath, volumePath)
+	if err := fsutil.CopyTree(imagePath, volumePath); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ensureTarget(target string, isDir bool) error {
+	if isDir {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
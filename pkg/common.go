@@ -6,21 +6,21 @@ import (
 	"os"
 
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"gocker/internal/image"
 	"gocker/internal/types"
 )
 
+// Parse 將映像參照拆成名稱與 tag (digest 參照時為 "sha256:...")，無效的參照回傳空字串
 func Parse(input string) (string, string) {
-	s := strings.Split(input, ":")
-	if len(s) == 1 {
-		return s[0], "latest"
-	}
-	if len(s) == 2 {
-		return s[0], s[1]
+	repo, tag, err := image.SplitReference(input)
+	if err != nil {
+		return "", ""
 	}
-	return "", ""
+	return repo, tag
 }
 
 // writeContainerInfo 將容器資訊寫回檔案
@@ -72,3 +72,76 @@ func ResolveContainer(identifier string) (*types.ContainerInfo, error) {
 		return nil, fmt.Errorf("found multiple containers matching %s, please specify a more precise ID", identifier)
 	}
 }
+
+// HumanSize 將位元組數轉換為易讀的格式，例如 1.5MB
+func HumanSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.3g%s", value, units[i])
+}
+
+// ParseSize 將 512m、10G 這類的大小轉換為位元組數，單位 k、m、g、t、p 皆為 1024 的倍數
+// 單位不分大小寫，可以加上 b 或 ib 結尾 (例如 10GB、10GiB)，沒有單位時為位元組
+func ParseSize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "b"), "i")
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		if i := strings.IndexByte("kmgtp", str[n-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			str = strings.TrimSpace(str[:n-1])
+		}
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || strings.Trim(str, "0123456789.") != "" {
+		return 0, fmt.Errorf("無效的大小 %q", s)
+	}
+	size := value * float64(multiplier)
+	if size >= 1<<63 {
+		return 0, fmt.Errorf("大小 %q 超出範圍", s)
+	}
+	return int64(size), nil
+}
+
+// TruncateID 將完整的 ID 縮短為 12 個字元顯示
+func TruncateID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// HumanDuration 將時間長度轉換為易讀的格式，例如 "2 hours"、"3 weeks"
+func HumanDuration(d time.Duration) string {
+	if seconds := int(d.Seconds()); seconds < 1 {
+		return "Less than a second"
+	} else if seconds == 1 {
+		return "1 second"
+	} else if seconds < 60 {
+		return fmt.Sprintf("%d seconds", seconds)
+	} else if minutes := int(d.Minutes()); minutes == 1 {
+		return "About a minute"
+	} else if minutes < 60 {
+		return fmt.Sprintf("%d minutes", minutes)
+	} else if hours := int(d.Hours() + 0.5); hours == 1 {
+		return "About an hour"
+	} else if hours < 48 {
+		return fmt.Sprintf("%d hours", hours)
+	} else if hours < 24*7*2 {
+		return fmt.Sprintf("%d days", hours/24)
+	} else if hours < 24*30*2 {
+		return fmt.Sprintf("%d weeks", hours/24/7)
+	} else if hours < 24*365*2 {
+		return fmt.Sprintf("%d months", hours/24/30)
+	}
+	return fmt.Sprintf("%d years", int(d.Hours())/24/365)
+}